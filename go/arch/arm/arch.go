@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_ARM,
 	PC:      uc.ARM_REG_PC,
 	SP:      uc.ARM_REG_SP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.ARM_REG_R0:  "r0",
 		uc.ARM_REG_R1:  "r1",
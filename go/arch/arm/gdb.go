@@ -0,0 +1,24 @@
+package arm
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "arm",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.arm.core", append(models.GdbNumbered("r", []int{
+			uc.ARM_REG_R0, uc.ARM_REG_R1, uc.ARM_REG_R2, uc.ARM_REG_R3,
+			uc.ARM_REG_R4, uc.ARM_REG_R5, uc.ARM_REG_R6, uc.ARM_REG_R7,
+			uc.ARM_REG_R8, uc.ARM_REG_R9, uc.ARM_REG_R10, uc.ARM_REG_R11,
+			uc.ARM_REG_R12,
+		}, 32, ""), []models.GdbReg{
+			{"sp", uc.ARM_REG_SP, 32, "data_ptr"},
+			{"lr", uc.ARM_REG_LR, 32, ""},
+			{"pc", uc.ARM_REG_PC, 32, "code_ptr"},
+			{"cpsr", uc.ARM_REG_CPSR, 32, ""},
+		}...)},
+	},
+}
@@ -16,7 +16,9 @@ type ArmLinuxKernel struct {
 	linux.LinuxKernel
 }
 
-func (k *ArmLinuxKernel) SetTls(addr uint64) {}
+func (k *ArmLinuxKernel) SetTls(addr uint64) {
+	k.U.RegWrite(uc.ARM_REG_C13_C0_3, addr)
+}
 
 func LinuxKernels(u models.Usercorn) []interface{} {
 	kernel := &ArmLinuxKernel{*linux.DefaultKernel()}
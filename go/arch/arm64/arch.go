@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_ARM,
 	PC:      uc.ARM64_REG_PC,
 	SP:      uc.ARM64_REG_SP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.ARM64_REG_X1:  "x1",
 		uc.ARM64_REG_X2:  "x2",
@@ -0,0 +1,27 @@
+package arm64
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "aarch64",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.aarch64.core", append(models.GdbNumbered("x", []int{
+			uc.ARM64_REG_X0, uc.ARM64_REG_X1, uc.ARM64_REG_X2, uc.ARM64_REG_X3,
+			uc.ARM64_REG_X4, uc.ARM64_REG_X5, uc.ARM64_REG_X6, uc.ARM64_REG_X7,
+			uc.ARM64_REG_X8, uc.ARM64_REG_X9, uc.ARM64_REG_X10, uc.ARM64_REG_X11,
+			uc.ARM64_REG_X12, uc.ARM64_REG_X13, uc.ARM64_REG_X14, uc.ARM64_REG_X15,
+			uc.ARM64_REG_X16, uc.ARM64_REG_X17, uc.ARM64_REG_X18, uc.ARM64_REG_X19,
+			uc.ARM64_REG_X20, uc.ARM64_REG_X21, uc.ARM64_REG_X22, uc.ARM64_REG_X23,
+			uc.ARM64_REG_X24, uc.ARM64_REG_X25, uc.ARM64_REG_X26, uc.ARM64_REG_X27,
+			uc.ARM64_REG_X28, uc.ARM64_REG_X29, uc.ARM64_REG_X30,
+		}, 64, ""), []models.GdbReg{
+			{"sp", uc.ARM64_REG_SP, 64, "data_ptr"},
+			{"pc", uc.ARM64_REG_PC, 64, "code_ptr"},
+			{"cpsr", uc.ARM64_REG_NZCV, 32, ""},
+		}...)},
+	},
+}
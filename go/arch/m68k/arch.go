@@ -17,6 +17,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_BIG_ENDIAN,
 	PC:      uc.M68K_REG_PC,
 	SP:      uc.M68K_REG_A7,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.M68K_REG_D0: "d0",
 		uc.M68K_REG_D1: "d1",
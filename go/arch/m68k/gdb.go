@@ -0,0 +1,27 @@
+package m68k
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "m68k",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.m68k.core", append(append(
+			models.GdbNumbered("d", []int{
+				uc.M68K_REG_D0, uc.M68K_REG_D1, uc.M68K_REG_D2, uc.M68K_REG_D3,
+				uc.M68K_REG_D4, uc.M68K_REG_D5, uc.M68K_REG_D6, uc.M68K_REG_D7,
+			}, 32, ""),
+			models.GdbNumbered("a", []int{
+				uc.M68K_REG_A0, uc.M68K_REG_A1, uc.M68K_REG_A2, uc.M68K_REG_A3,
+				uc.M68K_REG_A4, uc.M68K_REG_A5,
+			}, 32, "data_ptr")...), []models.GdbReg{
+			{"fp", uc.M68K_REG_A6, 32, "data_ptr"},
+			{"sp", uc.M68K_REG_A7, 32, "data_ptr"},
+			{"ps", uc.M68K_REG_SR, 32, ""},
+			{"pc", uc.M68K_REG_PC, 32, "code_ptr"},
+		}...)},
+	},
+}
@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_MIPS32 + uc.MODE_LITTLE_ENDIAN,
 	PC:      uc.MIPS_REG_PC,
 	SP:      uc.MIPS_REG_SP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.MIPS_REG_AT: "at",
 		uc.MIPS_REG_V0: "v0",
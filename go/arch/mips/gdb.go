@@ -0,0 +1,36 @@
+package mips
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "mips",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.mips.cpu", append(models.GdbNumbered("r", []int{
+			uc.MIPS_REG_ZERO, uc.MIPS_REG_AT, uc.MIPS_REG_V0, uc.MIPS_REG_V1,
+			uc.MIPS_REG_A0, uc.MIPS_REG_A1, uc.MIPS_REG_A2, uc.MIPS_REG_A3,
+			uc.MIPS_REG_T0, uc.MIPS_REG_T1, uc.MIPS_REG_T2, uc.MIPS_REG_T3,
+			uc.MIPS_REG_T4, uc.MIPS_REG_T5, uc.MIPS_REG_T6, uc.MIPS_REG_T7,
+			uc.MIPS_REG_S0, uc.MIPS_REG_S1, uc.MIPS_REG_S2, uc.MIPS_REG_S3,
+			uc.MIPS_REG_S4, uc.MIPS_REG_S5, uc.MIPS_REG_S6, uc.MIPS_REG_S7,
+			uc.MIPS_REG_T8, uc.MIPS_REG_T9, uc.MIPS_REG_K0, uc.MIPS_REG_K1,
+			uc.MIPS_REG_GP, uc.MIPS_REG_SP, uc.MIPS_REG_S8, uc.MIPS_REG_RA,
+		}, 32, ""), []models.GdbReg{
+			{"lo", uc.MIPS_REG_LO, 32, ""},
+			{"hi", uc.MIPS_REG_HI, 32, ""},
+			{"pc", uc.MIPS_REG_PC, 32, "code_ptr"},
+		}...)},
+		{"org.gnu.gdb.mips.cp0", []models.GdbReg{
+			{"status", -1, 32, ""},
+			{"badvaddr", -1, 32, ""},
+			{"cause", -1, 32, ""},
+		}},
+		{"org.gnu.gdb.mips.fpu", append(models.GdbUnsupported("f", 32, 32, "ieee_single"), []models.GdbReg{
+			{"fcsr", -1, 32, ""},
+			{"fir", -1, 32, ""},
+		}...)},
+	},
+}
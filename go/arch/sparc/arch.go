@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_32,
 	PC:      uc.SPARC_REG_PC,
 	SP:      uc.SPARC_REG_SP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		// uc.SPARC_REG_G0: "g0", // g0 is always zero
 		uc.SPARC_REG_G1: "g1",
@@ -0,0 +1,41 @@
+package sparc
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "sparc",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.sparc.cpu", append(append(append(
+			models.GdbNumbered("g", []int{
+				uc.SPARC_REG_G0, uc.SPARC_REG_G1, uc.SPARC_REG_G2, uc.SPARC_REG_G3,
+				uc.SPARC_REG_G4, uc.SPARC_REG_G5, uc.SPARC_REG_G6, uc.SPARC_REG_G7,
+			}, 32, ""),
+			models.GdbNumbered("o", []int{
+				uc.SPARC_REG_O0, uc.SPARC_REG_O1, uc.SPARC_REG_O2, uc.SPARC_REG_O3,
+				uc.SPARC_REG_O4, uc.SPARC_REG_O5, uc.SPARC_REG_O6, uc.SPARC_REG_O7,
+			}, 32, "")...),
+			models.GdbNumbered("l", []int{
+				uc.SPARC_REG_L0, uc.SPARC_REG_L1, uc.SPARC_REG_L2, uc.SPARC_REG_L3,
+				uc.SPARC_REG_L4, uc.SPARC_REG_L5, uc.SPARC_REG_L6, uc.SPARC_REG_L7,
+			}, 32, "")...),
+			models.GdbNumbered("i", []int{
+				uc.SPARC_REG_I0, uc.SPARC_REG_I1, uc.SPARC_REG_I2, uc.SPARC_REG_I3,
+				uc.SPARC_REG_I4, uc.SPARC_REG_I5, uc.SPARC_REG_I6, uc.SPARC_REG_I7,
+			}, 32, "")...)},
+		{"org.gnu.gdb.sparc.cp0", []models.GdbReg{
+			{"y", uc.SPARC_REG_Y, 32, ""},
+			{"psr", -1, 32, ""},
+			{"wim", -1, 32, ""},
+			{"tbr", -1, 32, ""},
+			{"pc", uc.SPARC_REG_PC, 32, "code_ptr"},
+			{"npc", -1, 32, "code_ptr"},
+			{"fsr", -1, 32, ""},
+			{"csr", -1, 32, ""},
+		}},
+		{"org.gnu.gdb.sparc.fpu", models.GdbUnsupported("f", 32, 32, "ieee_single")},
+	},
+}
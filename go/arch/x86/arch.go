@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_32,
 	PC:      uc.X86_REG_EIP,
 	SP:      uc.X86_REG_ESP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.X86_REG_EAX: "eax",
 		uc.X86_REG_EBX: "ebx",
@@ -42,8 +42,11 @@ func CgcSyscall(u models.Usercorn) {
 		u.MemWrite(args[1], tmp[:n])
 		writeAddr(u, args[3], uint64(n))
 	case 5: // allocate
-		addr, _ := u.Mmap(0, args[0])
-		// args[1] == is executable
+		prot := uc.PROT_READ | uc.PROT_WRITE
+		if args[1] != 0 {
+			prot |= uc.PROT_EXEC
+		}
+		addr, _ := u.MmapRegion(models.Mmap{Size: args[0], Prot: prot, Desc: "anon"}, false)
 		writeAddr(u, args[2], addr)
 	case 6: // fdwait
 		nfds := int(args[0])
@@ -0,0 +1,40 @@
+package x86
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "i386",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.i386.core", append([]models.GdbReg{
+			{"eax", uc.X86_REG_EAX, 32, ""},
+			{"ecx", uc.X86_REG_ECX, 32, ""},
+			{"edx", uc.X86_REG_EDX, 32, ""},
+			{"ebx", uc.X86_REG_EBX, 32, ""},
+			{"esp", uc.X86_REG_ESP, 32, "data_ptr"},
+			{"ebp", uc.X86_REG_EBP, 32, "data_ptr"},
+			{"esi", uc.X86_REG_ESI, 32, ""},
+			{"edi", uc.X86_REG_EDI, 32, ""},
+			{"eip", uc.X86_REG_EIP, 32, "code_ptr"},
+			{"eflags", uc.X86_REG_EFLAGS, 32, ""},
+			{"cs", uc.X86_REG_CS, 32, ""},
+			{"ss", uc.X86_REG_SS, 32, ""},
+			{"ds", uc.X86_REG_DS, 32, ""},
+			{"es", uc.X86_REG_ES, 32, ""},
+			{"fs", uc.X86_REG_FS, 32, ""},
+			{"gs", uc.X86_REG_GS, 32, ""},
+		}, append(models.GdbUnsupported("st", 8, 80, "i387_ext"), []models.GdbReg{
+			{"fctrl", -1, 32, ""},
+			{"fstat", -1, 32, ""},
+			{"ftag", -1, 32, ""},
+			{"fiseg", -1, 32, ""},
+			{"fioff", -1, 32, ""},
+			{"foseg", -1, 32, ""},
+			{"fooff", -1, 32, ""},
+			{"fop", -1, 32, ""},
+		}...)...)},
+	},
+}
@@ -16,6 +16,7 @@ var Arch = &models.Arch{
 	UC_MODE: uc.MODE_64,
 	PC:      uc.X86_REG_RIP,
 	SP:      uc.X86_REG_RSP,
+	Gdb:     gdbTarget,
 	Regs: map[int]string{
 		uc.X86_REG_RAX: "rax",
 		uc.X86_REG_RBX: "rbx",
@@ -0,0 +1,48 @@
+package x86_64
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var gdbTarget = &models.GdbTarget{
+	Arch: "i386:x86-64",
+	Features: []models.GdbFeature{
+		{"org.gnu.gdb.i386.core", append([]models.GdbReg{
+			{"rax", uc.X86_REG_RAX, 64, ""},
+			{"rbx", uc.X86_REG_RBX, 64, ""},
+			{"rcx", uc.X86_REG_RCX, 64, ""},
+			{"rdx", uc.X86_REG_RDX, 64, ""},
+			{"rsi", uc.X86_REG_RSI, 64, ""},
+			{"rdi", uc.X86_REG_RDI, 64, ""},
+			{"rbp", uc.X86_REG_RBP, 64, "data_ptr"},
+			{"rsp", uc.X86_REG_RSP, 64, "data_ptr"},
+			{"r8", uc.X86_REG_R8, 64, ""},
+			{"r9", uc.X86_REG_R9, 64, ""},
+			{"r10", uc.X86_REG_R10, 64, ""},
+			{"r11", uc.X86_REG_R11, 64, ""},
+			{"r12", uc.X86_REG_R12, 64, ""},
+			{"r13", uc.X86_REG_R13, 64, ""},
+			{"r14", uc.X86_REG_R14, 64, ""},
+			{"r15", uc.X86_REG_R15, 64, ""},
+			{"rip", uc.X86_REG_RIP, 64, "code_ptr"},
+			{"eflags", uc.X86_REG_EFLAGS, 32, ""},
+			{"cs", uc.X86_REG_CS, 32, ""},
+			{"ss", uc.X86_REG_SS, 32, ""},
+			{"ds", uc.X86_REG_DS, 32, ""},
+			{"es", uc.X86_REG_ES, 32, ""},
+			{"fs", uc.X86_REG_FS, 32, ""},
+			{"gs", uc.X86_REG_GS, 32, ""},
+		}, append(models.GdbUnsupported("st", 8, 80, "i387_ext"), []models.GdbReg{
+			{"fctrl", -1, 32, ""},
+			{"fstat", -1, 32, ""},
+			{"ftag", -1, 32, ""},
+			{"fiseg", -1, 32, ""},
+			{"fioff", -1, 32, ""},
+			{"foseg", -1, 32, ""},
+			{"fooff", -1, 32, ""},
+			{"fop", -1, 32, ""},
+		}...)...)},
+	},
+}
@@ -40,7 +40,9 @@ func (k *LinuxKernel) ArchPrctl(code int, addr uint64) {
 	}
 }
 
-func (k *LinuxKernel) SetTidAddress() {}
+func (k *LinuxKernel) Clone(flags, stack, ptid, ctid, tls uint64) uint64 {
+	return k.LinuxKernel.Clone(flags, stack, ptid, tls, ctid)
+}
 
 func LinuxKernels(u models.Usercorn) []interface{} {
 	kernel := &LinuxKernel{*linux.DefaultKernel()}
@@ -0,0 +1,132 @@
+package usercorn
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type callEdge struct {
+	from, to uint64
+}
+
+// callGraph counts calls between functions, as seen by the stack tracker.
+type callGraph struct {
+	edges map[callEdge]uint64
+}
+
+func newCallGraph() *callGraph {
+	return &callGraph{edges: make(map[callEdge]uint64)}
+}
+
+func (c *callGraph) call(from, to uint64) {
+	c.edges[callEdge{from, to}]++
+}
+
+// sorted returns the edges ordered by caller, then callee.
+func (c *callGraph) sorted() []callEdge {
+	edges := make([]callEdge, 0, len(c.edges))
+	for e := range c.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	return edges
+}
+
+// updateStack updates the stacktrace, records new frames in the call graph and sets the profiled stack.
+// Size is the size of the block at pc, or 0 if unknown.
+func (u *Usercorn) updateStack(pc uint64, size uint32, sp uint64, sym string) {
+	depth := u.stacktrace.Len()
+	if u.calls != nil {
+		u.calls.update(u, pc, size, sp, sym)
+	} else {
+		u.stacktrace.Update(pc, sp, sym)
+	}
+	if u.callgraph != nil && depth > 0 && u.stacktrace.Len() > depth {
+		// frames start at the first block seen, which is the function entry
+		caller := u.stacktrace.Stack[u.stacktrace.Len()-2]
+		u.callgraph.call(caller.PC, pc)
+	}
+	if u.profile != nil {
+		u.profile.enter(&u.stacktrace)
+	}
+}
+
+// funcName names a call graph node. Addresses not at the start of a symbol are named sub_<addr>.
+func (u *Usercorn) funcName(addr uint64) string {
+	sym, _ := u.Symbolicate(addr)
+	if sym == "" || strings.Contains(sym, "+0x") {
+		return fmt.Sprintf("sub_%x", addr)
+	}
+	return sym
+}
+
+type jsonCallNode struct {
+	Addr uint64 `json:"addr"`
+	Name string `json:"name"`
+}
+
+type jsonCallEdge struct {
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Count uint64 `json:"count"`
+}
+
+// WriteCallGraph writes the functions called so far, with edges weighted by call count.
+// Format is "dot" (Graphviz) or "json".
+func (u *Usercorn) WriteCallGraph(w io.Writer, format string) error {
+	c := u.callgraph
+	if c == nil {
+		return errors.New("Call graph was not enabled.")
+	}
+	edges := c.sorted()
+	var nodes []uint64
+	seen := make(map[uint64]bool)
+	for _, e := range edges {
+		for _, addr := range []uint64{e.from, e.to} {
+			if !seen[addr] {
+				seen[addr] = true
+				nodes = append(nodes, addr)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	switch format {
+	case "dot":
+		b := bufio.NewWriter(w)
+		fmt.Fprintln(b, "digraph callgraph {")
+		fmt.Fprintln(b, "\tnode [shape=box];")
+		for _, addr := range nodes {
+			fmt.Fprintf(b, "\tn%x [label=%q];\n", addr, u.funcName(addr))
+		}
+		for _, e := range edges {
+			n := c.edges[e]
+			fmt.Fprintf(b, "\tn%x -> n%x [label=\"%d\", weight=%d];\n", e.from, e.to, n, n)
+		}
+		fmt.Fprintln(b, "}")
+		return b.Flush()
+	case "json":
+		var out struct {
+			Nodes []jsonCallNode `json:"nodes"`
+			Edges []jsonCallEdge `json:"edges"`
+		}
+		for _, addr := range nodes {
+			out.Nodes = append(out.Nodes, jsonCallNode{addr, u.funcName(addr)})
+		}
+		for _, e := range edges {
+			out.Edges = append(out.Edges, jsonCallEdge{e.from, e.to, c.edges[e]})
+		}
+		return json.NewEncoder(w).Encode(&out)
+	default:
+		return fmt.Errorf("Unknown call graph format: %s", format)
+	}
+}
@@ -0,0 +1,26 @@
+package usercorn
+
+import (
+	"testing"
+)
+
+func TestCallGraphEdges(t *testing.T) {
+	c := newCallGraph()
+	c.call(0x2000, 0x3000)
+	c.call(0x1000, 0x2000)
+	c.call(0x2000, 0x3000)
+	c.call(0x1000, 0x1800)
+	edges := c.sorted()
+	expect := []callEdge{{0x1000, 0x1800}, {0x1000, 0x2000}, {0x2000, 0x3000}}
+	if len(edges) != len(expect) {
+		t.Fatalf("got %d edges, want %d", len(edges), len(expect))
+	}
+	for i, e := range expect {
+		if edges[i] != e {
+			t.Errorf("edge %d: got %#v, want %#v", i, edges[i], e)
+		}
+	}
+	if n := c.edges[callEdge{0x2000, 0x3000}]; n != 2 {
+		t.Errorf("call count: got %d, want 2", n)
+	}
+}
@@ -0,0 +1,124 @@
+package usercorn
+
+import (
+	"strings"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+const (
+	exitNone = iota
+	exitCall
+	exitReturn
+)
+
+type blockExit struct {
+	size uint32
+	kind int
+	// return address of a call
+	ret uint64
+}
+
+// callTracker follows calls and returns by decoding the last instruction of each basic block.
+type callTracker struct {
+	disas  *models.Disassembler
+	arch   string
+	blocks map[uint64]blockExit
+	// exit of the previous block
+	last blockExit
+}
+
+var callTrackArches = map[string]bool{"x86": true, "x86_64": true, "arm": true, "arm64": true, "mips": true}
+
+func newCallTracker(u *Usercorn) *callTracker {
+	return &callTracker{disas: u.disas, arch: u.loader.Arch(), blocks: make(map[uint64]blockExit)}
+}
+
+var armConds = set("eq", "ne", "cs", "hs", "cc", "lo", "mi", "pl", "vs", "vc", "hi", "ls", "ge", "lt", "gt", "le", "al")
+
+// classify returns whether insn calls or returns.
+func (c *callTracker) classify(insn *models.Instruction) int {
+	m, op := insn.Mnemonic, insn.OpStr
+	switch c.arch {
+	case "x86", "x86_64":
+		if hasPrefix(m, "call") {
+			return exitCall
+		} else if hasPrefix(m, "ret") {
+			return exitReturn
+		}
+	case "arm":
+		m = strings.TrimSuffix(m, ".w")
+		// bl, blx and conditional forms (but not b + ls/lt/le)
+		if m == "bl" || m == "blx" || len(m) == 4 && m[:2] == "bl" && armConds[m[2:]] || len(m) == 5 && m[:3] == "blx" && armConds[m[3:]] {
+			return exitCall
+		}
+		if hasPrefix(m, "bx") && op == "lr" ||
+			hasPrefix(m, "pop", "ldm") && strings.Contains(op, "pc") ||
+			hasPrefix(m, "ldr", "mov") && strings.HasPrefix(op, "pc,") {
+			return exitReturn
+		}
+	case "arm64":
+		if m == "bl" || m == "blr" {
+			return exitCall
+		} else if hasPrefix(m, "ret") {
+			return exitReturn
+		}
+	case "mips":
+		switch m {
+		case "jal", "jalr", "jalx", "bal", "bgezal", "bltzal":
+			return exitCall
+		case "jr":
+			if op == "$ra" {
+				return exitReturn
+			}
+		}
+	}
+	return exitNone
+}
+
+// exit decodes how the block at addr ends, using a capstone mode such as CS_MODE_THUMB.
+func (c *callTracker) exit(mem []byte, addr uint64, mode uint) blockExit {
+	e := blockExit{size: uint32(len(mem))}
+	insns, err := c.disas.DisasMode(mem, addr, mode)
+	if err != nil || len(insns) == 0 {
+		return e
+	}
+	last := insns[len(insns)-1]
+	if c.arch == "mips" && len(insns) > 1 {
+		// the branch is followed by its delay slot
+		if prev := insns[len(insns)-2]; c.classify(prev) != exitNone {
+			e.kind = c.classify(prev)
+			e.ret = prev.Addr + 8
+			return e
+		}
+	}
+	e.kind = c.classify(last)
+	e.ret = last.Addr + uint64(len(last.Bytes))
+	return e
+}
+
+// update applies the exit of the previous block to the stack, then decodes the block at addr.
+func (c *callTracker) update(u *Usercorn, addr uint64, size uint32, sp uint64, sym string) {
+	s := &u.stacktrace
+	switch {
+	case s.Empty():
+		s.Push(addr, sp, sym)
+	case c.last.kind == exitCall:
+		s.Call(addr, sp, c.last.ret, sym)
+	case c.last.kind == exitReturn:
+		s.Return(addr)
+	}
+	c.last = blockExit{}
+	if size == 0 {
+		return
+	}
+	e, ok := c.blocks[addr]
+	if !ok || e.size != size {
+		if mem, err := u.MemRead(addr, uint64(size)); err == nil {
+			// blocks are cached by address, so the mode is only checked when decoding
+			e = c.exit(mem, addr, u.csMode())
+			c.blocks[addr] = e
+		}
+	}
+	c.last = e
+}
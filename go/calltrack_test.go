@@ -0,0 +1,63 @@
+package usercorn
+
+import (
+	"testing"
+
+	cs "github.com/bnagy/gapstone"
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestCallClassify(t *testing.T) {
+	tests := []struct {
+		arch, mnemonic, op string
+		kind               int
+	}{
+		{"x86_64", "call", "qword ptr [rip + 0x200]", exitCall},
+		{"x86_64", "ret", "", exitReturn},
+		{"x86", "jmp", "eax", exitNone},
+		{"arm", "bl", "#0x1000", exitCall},
+		{"arm", "blne", "#0x1000", exitCall},
+		{"arm", "blx", "r3", exitCall},
+		{"arm", "bls", "#0x1000", exitNone},
+		{"arm", "blt", "#0x1000", exitNone},
+		{"arm", "bx", "lr", exitReturn},
+		{"arm", "bx", "r3", exitNone},
+		{"arm", "pop", "{r4, r5, pc}", exitReturn},
+		{"arm", "ldr", "pc, [sp], #4", exitReturn},
+		{"arm", "ldr", "r0, [pc, #4]", exitNone},
+		// thumb-2
+		{"arm", "pop.w", "{r4, r5, r6, pc}", exitReturn},
+		{"arm", "ldr.w", "pc, [sp], #4", exitReturn},
+		{"arm", "blx", "#0x1000", exitCall},
+		{"arm64", "bl", "#0x1000", exitCall},
+		{"arm64", "ret", "", exitReturn},
+		{"mips", "jalr", "$t9", exitCall},
+		{"mips", "jr", "$ra", exitReturn},
+		{"mips", "jr", "$t9", exitNone},
+	}
+	for _, test := range tests {
+		c := &callTracker{arch: test.arch}
+		insn := &models.Instruction{Mnemonic: test.mnemonic, OpStr: test.op}
+		if kind := c.classify(insn); kind != test.kind {
+			t.Errorf("%s %s %s: got %d, want %d", test.arch, test.mnemonic, test.op, kind, test.kind)
+		}
+	}
+}
+
+func TestThumbMode(t *testing.T) {
+	fake := &ctxUnicorn{regs: make(map[int]uint64)}
+	u := &Unicorn{Unicorn: fake, arch: &models.Arch{CS_ARCH: cs.CS_ARCH_ARM, CS_MODE: cs.CS_MODE_ARM}}
+	if mode := u.csMode(); mode != cs.CS_MODE_ARM {
+		t.Errorf("ARM state: got mode %d", mode)
+	}
+	fake.regs[uc.ARM_REG_CPSR] = 0x30
+	if mode := u.csMode(); mode != cs.CS_MODE_THUMB {
+		t.Errorf("Thumb state: got mode %d", mode)
+	}
+	u.arch = &models.Arch{CS_ARCH: cs.CS_ARCH_X86, CS_MODE: cs.CS_MODE_64}
+	if mode := u.csMode(); mode != cs.CS_MODE_64 {
+		t.Errorf("x86_64: got mode %d", mode)
+	}
+}
@@ -0,0 +1,101 @@
+package usercorn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// Config controls a Usercorn instance. The zero value is valid.
+// It's embedded in Usercorn, so the fields can still be changed before Run.
+type Config struct {
+	// path reported to the guest as its executable
+	Path string
+	// used by RunConfig
+	Args []string
+	Env  []string
+
+	Verbose         bool
+	TraceSys        bool
+	TraceMem        bool
+	TraceMemBatch   bool
+	TraceExec       bool
+	TraceReg        bool
+	TraceMatch      []string
+	TraceMatchDepth int
+	LoopCollapse    int
+	Demangle        bool
+	// keep parameter lists when demangling (implies Demangle)
+	DemangleParams bool
+	// track call frames even when not tracing execution (used by the debugger)
+	TraceStack bool
+	// emit structured trace events instead of text (see models.TraceWriter)
+	Tracer models.TraceWriter
+	// trace and diagnostic output (defaults to os.Stderr)
+	TraceOut io.Writer
+	// guest stdin, stdout and stderr (nil means the host's fds 0-2)
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// trace forked child processes too, tagging output with their pids (otherwise children run untraced)
+	FollowForks bool
+	// record executed basic blocks (see WriteDrcov)
+	Coverage bool
+	// record calls between functions (see WriteCallGraph)
+	CallGraph bool
+	// count executed instructions by call stack (see WriteProfile)
+	Profile bool
+	// log pages that are both writable and executable
+	WXAudit bool
+	// replace malloc/calloc/realloc/free with a checked allocator and stop on heap errors (see HeapError)
+	HeapSanitizer bool
+	// track data from input syscalls and report tainted control flow and syscall arguments (see TaintReports)
+	TaintTrack bool
+
+	// stop after this many instructions or this long (0 means no limit)
+	MaxInsns uint64
+	Timeout  time.Duration
+
+	ForceBase       uint64
+	ForceInterpBase uint64
+	// stack size in bytes (defaults to STACK_SIZE)
+	StackSize  uint64
+	LoadPrefix string
+}
+
+func (c *Config) Validate() error {
+	if c.TraceMatchDepth < 0 {
+		return errors.New("TraceMatchDepth must not be negative.")
+	}
+	if c.LoopCollapse < 0 {
+		return errors.New("LoopCollapse must not be negative.")
+	}
+	if c.Timeout < 0 {
+		return errors.New("Timeout must not be negative.")
+	}
+	if c.StackSize%UC_MEM_ALIGN != 0 {
+		return fmt.Errorf("StackSize must be a multiple of 0x%x.", UC_MEM_ALIGN)
+	}
+	if c.ForceBase%UC_MEM_ALIGN != 0 || c.ForceInterpBase%UC_MEM_ALIGN != 0 {
+		return fmt.Errorf("ForceBase and ForceInterpBase must be aligned to 0x%x.", UC_MEM_ALIGN)
+	}
+	if c.LoadPrefix != "" {
+		if fi, err := os.Stat(c.LoadPrefix); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("LoadPrefix is not a directory: %s", c.LoadPrefix)
+		}
+	}
+	return nil
+}
+
+func (c *Config) stackSize() uint64 {
+	if c.StackSize == 0 {
+		return STACK_SIZE
+	}
+	return c.StackSize
+}
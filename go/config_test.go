@@ -0,0 +1,27 @@
+package usercorn
+
+import (
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	var c Config
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.stackSize() != STACK_SIZE {
+		t.Fatal("wrong default stack size")
+	}
+	bad := []Config{
+		{LoopCollapse: -1},
+		{Timeout: -1},
+		{StackSize: 0x1001},
+		{ForceBase: 0x1234},
+		{LoadPrefix: "/nonexistent/usercorn/prefix"},
+	}
+	for _, c := range bad {
+		if c.Validate() == nil {
+			t.Fatalf("config should be invalid: %+v", c)
+		}
+	}
+}
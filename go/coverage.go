@@ -0,0 +1,130 @@
+package usercorn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+type covModule struct {
+	Path              string
+	Start, End, Entry uint64
+}
+
+// coverage records every executed basic block for drcov output.
+type coverage struct {
+	modules []*covModule
+	blocks  map[uint64]uint32
+	// blocks in order of first execution
+	order []uint64
+}
+
+func newCoverage() *coverage {
+	return &coverage{blocks: make(map[uint64]uint32)}
+}
+
+func (c *coverage) block(addr uint64, size uint32) {
+	if _, ok := c.blocks[addr]; !ok {
+		c.blocks[addr] = size
+		c.order = append(c.order, addr)
+	}
+}
+
+// addModule records a mapping, extending an existing module with the same path.
+func (c *coverage) addModule(path string, start, end, entry uint64) {
+	for _, m := range c.modules {
+		if m.Path == path {
+			if start < m.Start {
+				m.Start = start
+			}
+			if end > m.End {
+				m.End = end
+			}
+			return
+		}
+	}
+	c.modules = append(c.modules, &covModule{path, start, end, entry})
+}
+
+func (c *coverage) addLoader(path string, l models.Loader, bias, entry uint64) error {
+	segments, err := l.Segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		c.addModule(path, bias+seg.Addr, bias+seg.Addr+seg.Size, entry)
+	}
+	return nil
+}
+
+func (c *coverage) find(addr uint64) (int, *covModule) {
+	for i, m := range c.modules {
+		if addr >= m.Start && addr < m.End {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+// coverMmap tracks file mappings made by the guest (e.g. shared libraries loaded by the interpreter).
+func (u *Usercorn) coverMmap(addr uint64) {
+	if m := u.memory.find(addr); m != nil && m.Desc == "file" {
+		u.coverage.addModule(m.File, m.Addr, m.End(), 0)
+	}
+}
+
+// WriteDrcov writes the blocks executed so far in drcov (version 2) format.
+func (u *Usercorn) WriteDrcov(w io.Writer) error {
+	c := u.coverage
+	if c == nil {
+		return errors.New("Coverage was not enabled.")
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "DRCOV VERSION: 2\nDRCOV FLAVOR: usercorn\n")
+	fmt.Fprintf(b, "Module Table: version 2, count %d\n", len(c.modules))
+	fmt.Fprintf(b, "Columns: id, base, end, entry, checksum, timestamp, path\n")
+	for i, m := range c.modules {
+		fmt.Fprintf(b, "%3d, 0x%016x, 0x%016x, 0x%016x, 0x%08x, 0x%08x, %s\n", i, m.Start, m.End, m.Entry, 0, 0, m.Path)
+	}
+	var entries [][8]byte
+	for _, addr := range c.order {
+		id, m := c.find(addr)
+		if m == nil {
+			continue
+		}
+		var bb [8]byte
+		binary.LittleEndian.PutUint32(bb[0:], uint32(addr-m.Start))
+		binary.LittleEndian.PutUint16(bb[4:], uint16(c.blocks[addr]))
+		binary.LittleEndian.PutUint16(bb[6:], uint16(id))
+		entries = append(entries, bb)
+	}
+	fmt.Fprintf(b, "BB Table: %d bbs\n", len(entries))
+	for _, bb := range entries {
+		b.Write(bb[:])
+	}
+	return b.Flush()
+}
+
+func (u *Usercorn) addCoverage() error {
+	c := newCoverage()
+	if err := c.addLoader(u.Path, u.loader, u.base, u.binEntry); err != nil {
+		return err
+	}
+	if u.interpLoader != nil {
+		interp := u.PrefixPath(u.loader.Interp(), true)
+		if err := c.addLoader(interp, u.interpLoader, u.interpBase, u.entry); err != nil {
+			return err
+		}
+	}
+	u.coverage = c
+	_, err := u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+		c.block(addr, size)
+	})
+	return err
+}
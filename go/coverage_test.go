@@ -0,0 +1,35 @@
+package usercorn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDrcov(t *testing.T) {
+	c := newCoverage()
+	c.addModule("/bin/test", 0x1000, 0x2000, 0x1000)
+	c.addModule("/bin/test", 0x2000, 0x3000, 0)
+	c.block(0x1010, 8)
+	c.block(0x2100, 4)
+	c.block(0x1010, 8)
+	// outside any module
+	c.block(0x9000, 4)
+	u := &Usercorn{coverage: c}
+	var buf bytes.Buffer
+	if err := u.WriteDrcov(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "count 1\n") || !strings.Contains(out, "0x0000000000003000") {
+		t.Fatalf("bad module table:\n%s", out)
+	}
+	split := strings.SplitN(out, "BB Table: 2 bbs\n", 2)
+	if len(split) != 2 {
+		t.Fatalf("bad bb table:\n%s", out)
+	}
+	expected := []byte{0x10, 0, 0, 0, 8, 0, 0, 0, 0x00, 0x11, 0, 0, 4, 0, 0, 0}
+	if !bytes.Equal([]byte(split[1]), expected) {
+		t.Fatalf("bad bb entries: %x", split[1])
+	}
+}
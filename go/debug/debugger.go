@@ -0,0 +1,127 @@
+package debug
+
+import (
+	"sync/atomic"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+type Reason int
+
+const (
+	ReasonStep Reason = iota
+	ReasonBreak
+	ReasonInterrupt
+	ReasonFault
+)
+
+// Stop describes why the debugger paused emulation.
+type Stop struct {
+	Reason Reason
+	Addr   uint64
+	// only set for ReasonFault
+	Access int
+	Size   int
+}
+
+// Debugger pauses emulation on breakpoints, single steps, interrupts and invalid memory access.
+// The handler runs inside the Unicorn hook, so emulation resumes when it returns.
+type Debugger struct {
+	u       models.Usercorn
+	handler func(*Stop)
+	breaks  map[uint64]bool
+	once    map[uint64]bool
+	hooks   []uc.Hook
+
+	step      bool
+	interrupt int32
+}
+
+func NewDebugger(u models.Usercorn, handler func(*Stop)) *Debugger {
+	return &Debugger{
+		u:       u,
+		handler: handler,
+		breaks:  make(map[uint64]bool),
+		once:    make(map[uint64]bool),
+	}
+}
+
+func (d *Debugger) Attach() error {
+	hh, err := d.u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+		var reason Reason
+		if atomic.SwapInt32(&d.interrupt, 0) != 0 {
+			reason = ReasonInterrupt
+		} else if d.step {
+			reason = ReasonStep
+		} else if d.breaks[addr] || d.once[addr] {
+			reason = ReasonBreak
+		} else {
+			return
+		}
+		d.step = false
+		// temporary breakpoints only last until the next stop
+		if len(d.once) > 0 {
+			d.once = make(map[uint64]bool)
+		}
+		d.handler(&Stop{Reason: reason, Addr: addr})
+	})
+	if err != nil {
+		return err
+	}
+	d.hooks = append(d.hooks, hh)
+	invalid := uc.HOOK_MEM_READ_INVALID | uc.HOOK_MEM_WRITE_INVALID | uc.HOOK_MEM_FETCH_INVALID
+	hh, err = d.u.HookAdd(invalid, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) bool {
+		d.handler(&Stop{Reason: ReasonFault, Addr: addr, Access: access, Size: size})
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	d.hooks = append(d.hooks, hh)
+	return nil
+}
+
+func (d *Debugger) Detach() {
+	for _, hh := range d.hooks {
+		d.u.HookDel(hh)
+	}
+	d.hooks = nil
+}
+
+func (d *Debugger) Break(addr uint64) {
+	d.breaks[addr] = true
+}
+
+// BreakOnce sets a temporary breakpoint, which is cleared the next time the debugger stops.
+func (d *Debugger) BreakOnce(addr uint64) {
+	d.once[addr] = true
+}
+
+func (d *Debugger) Unbreak(addr uint64) {
+	delete(d.breaks, addr)
+}
+
+func (d *Debugger) Breakpoints() []uint64 {
+	ret := make([]uint64, 0, len(d.breaks))
+	for addr := range d.breaks {
+		ret = append(ret, addr)
+	}
+	return ret
+}
+
+// Step stops again before the next instruction executes.
+func (d *Debugger) Step() {
+	d.step = true
+}
+
+// Continue runs until the next breakpoint.
+func (d *Debugger) Continue() {
+	d.step = false
+}
+
+// Interrupt stops at the next instruction. It's safe to call from any goroutine.
+func (d *Debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupt, 1)
+}
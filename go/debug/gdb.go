@@ -0,0 +1,454 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+const (
+	sigTrap = 5
+	sigSegv = 11
+	sigInt  = 2
+)
+
+// GdbStub implements the GDB remote serial protocol for a single client.
+type GdbStub struct {
+	u       models.Usercorn
+	dbg     *Debugger
+	target  *models.GdbTarget
+	conn    net.Conn
+	packets chan string
+	lastSig int
+	closed  bool
+	// the client resumed the guest and is waiting for a stop reply
+	running bool
+}
+
+// ListenGdb waits for a GDB client to connect to addr and attaches a debugger to u.
+// The guest is stopped before its first instruction.
+func ListenGdb(u models.Usercorn, addr string) (*GdbStub, error) {
+	target := u.Arch().Gdb
+	if target == nil {
+		return nil, errors.New("no GDB target description for this arch")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	g := &GdbStub{
+		u:       u,
+		target:  target,
+		conn:    conn,
+		packets: make(chan string, 16),
+		lastSig: sigTrap,
+	}
+	g.dbg = NewDebugger(u, g.stopped)
+	if err := g.dbg.Attach(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	g.dbg.Step()
+	go g.readLoop()
+	return g, nil
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func gdbEscape(data string) string {
+	var out []byte
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			out = append(out, '}', c^0x20)
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// readPacket reads the next packet from r, acking it on w. A lone 0x03 is returned as "\x03".
+func readPacket(r *bufio.Reader, w io.Writer) (string, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case 0x03:
+			return "\x03", nil
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return "", err
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				return "", err
+			}
+			check, err := strconv.ParseUint(string(sum[:]), 16, 8)
+			if err != nil || byte(check) != gdbChecksum(data) {
+				w.Write([]byte("-"))
+				continue
+			}
+			w.Write([]byte("+"))
+			return data, nil
+		}
+		// ignore acks and line noise
+	}
+}
+
+func (g *GdbStub) readLoop() {
+	r := bufio.NewReader(g.conn)
+	for {
+		pkt, err := readPacket(r, g.conn)
+		if err != nil {
+			close(g.packets)
+			return
+		}
+		if pkt == "\x03" {
+			g.dbg.Interrupt()
+		} else {
+			g.packets <- pkt
+		}
+	}
+}
+
+func (g *GdbStub) send(data string) error {
+	data = gdbEscape(data)
+	_, err := fmt.Fprintf(g.conn, "$%s#%02x", data, gdbChecksum(data))
+	return err
+}
+
+func (g *GdbStub) stopReply() string {
+	return fmt.Sprintf("S%02x", g.lastSig)
+}
+
+// stopped runs the command loop while the guest is paused.
+func (g *GdbStub) stopped(stop *Stop) {
+	switch stop.Reason {
+	case ReasonFault:
+		g.lastSig = sigSegv
+	case ReasonInterrupt:
+		g.lastSig = sigInt
+	default:
+		g.lastSig = sigTrap
+	}
+	// the initial stop is only reported when the client asks with '?'
+	if g.running && !g.closed {
+		g.send(g.stopReply())
+	}
+	g.running = false
+	for pkt := range g.packets {
+		reply, resume := g.handle(pkt)
+		if resume {
+			g.running = true
+			return
+		}
+		g.send(reply)
+	}
+	// client went away: let the guest run to completion
+	g.closed = true
+	g.dbg.Detach()
+}
+
+func (g *GdbStub) handle(pkt string) (string, bool) {
+	if pkt == "" {
+		return "", false
+	}
+	cmd, args := pkt[0], pkt[1:]
+	switch cmd {
+	case '?':
+		return g.stopReply(), false
+	case 'g':
+		return g.readRegs(), false
+	case 'G':
+		return g.writeRegs(args), false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 32)
+		if err != nil {
+			return "E01", false
+		}
+		return g.readReg(int(n)), false
+	case 'P':
+		split := strings.SplitN(args, "=", 2)
+		n, err := strconv.ParseUint(split[0], 16, 32)
+		if err != nil || len(split) != 2 {
+			return "E01", false
+		}
+		return g.writeReg(int(n), split[1]), false
+	case 'm':
+		return g.readMem(args), false
+	case 'M':
+		return g.writeMem(args), false
+	case 'c', 's':
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 64)
+			if err != nil {
+				return "E01", false
+			}
+			g.u.RegWrite(g.u.Arch().PC, addr)
+		}
+		if cmd == 's' {
+			g.dbg.Step()
+		} else {
+			g.dbg.Continue()
+		}
+		return "", true
+	case 'v':
+		return g.handleV(args)
+	case 'Z', 'z':
+		return g.breakpoint(cmd == 'Z', args), false
+	case 'H', 'T':
+		return "OK", false
+	case 'q':
+		return g.query(args), false
+	case 'D':
+		g.send("OK")
+		g.closed = true
+		g.dbg.Detach()
+		g.conn.Close()
+		return "", true
+	case 'k':
+		g.closed = true
+		g.dbg.Detach()
+		g.conn.Close()
+		g.u.Stop()
+		return "", true
+	}
+	return "", false
+}
+
+func (g *GdbStub) handleV(args string) (string, bool) {
+	switch {
+	case args == "Cont?":
+		return "vCont;c;C;s;S", false
+	case strings.HasPrefix(args, "Cont;"):
+		// only one thread, so the first action wins
+		action := strings.Split(args[5:], ";")[0]
+		action = strings.SplitN(action, ":", 2)[0]
+		if action == "" {
+			return "E01", false
+		}
+		switch action[0] {
+		case 's', 'S':
+			g.dbg.Step()
+		default:
+			g.dbg.Continue()
+		}
+		return "", true
+	}
+	return "", false
+}
+
+func (g *GdbStub) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return "PacketSize=4000;qXfer:features:read+"
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return "QC1"
+	case args == "fThreadInfo":
+		return "m1"
+	case args == "sThreadInfo":
+		return "l"
+	case strings.HasPrefix(args, "Xfer:features:read:"):
+		split := strings.SplitN(args[len("Xfer:features:read:"):], ":", 2)
+		if len(split) != 2 || split[0] != "target.xml" {
+			return "E00"
+		}
+		var off, length uint64
+		if _, err := fmt.Sscanf(split[1], "%x,%x", &off, &length); err != nil {
+			return "E01"
+		}
+		xml := g.target.Xml()
+		if off >= uint64(len(xml)) {
+			return "l"
+		}
+		end := off + length
+		if end >= uint64(len(xml)) {
+			return "l" + xml[off:]
+		}
+		return "m" + xml[off:end]
+	}
+	return ""
+}
+
+func (g *GdbStub) encodeReg(reg models.GdbReg) string {
+	var val uint64
+	if reg.Enum >= 0 {
+		val, _ = g.u.RegRead(reg.Enum)
+	}
+	buf := make([]byte, reg.Bits/8)
+	var tmp [8]byte
+	order := g.u.ByteOrder()
+	order.PutUint64(tmp[:], val)
+	if len(buf) <= 8 {
+		if order == binary.BigEndian {
+			copy(buf, tmp[8-len(buf):])
+		} else {
+			copy(buf, tmp[:len(buf)])
+		}
+	} else {
+		// registers we can't read in full are zero-extended
+		if order == binary.BigEndian {
+			copy(buf[len(buf)-8:], tmp[:])
+		} else {
+			copy(buf, tmp[:])
+		}
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (g *GdbStub) decodeReg(reg models.GdbReg, data []byte) {
+	if reg.Enum < 0 {
+		return
+	}
+	var tmp [8]byte
+	order := g.u.ByteOrder()
+	if len(data) > 8 {
+		if order == binary.BigEndian {
+			data = data[len(data)-8:]
+		} else {
+			data = data[:8]
+		}
+	}
+	if order == binary.BigEndian {
+		copy(tmp[8-len(data):], data)
+	} else {
+		copy(tmp[:], data)
+	}
+	g.u.RegWrite(reg.Enum, order.Uint64(tmp[:]))
+}
+
+func (g *GdbStub) readRegs() string {
+	var out []string
+	for _, reg := range g.target.Regs() {
+		out = append(out, g.encodeReg(reg))
+	}
+	return strings.Join(out, "")
+}
+
+func (g *GdbStub) writeRegs(args string) string {
+	data, err := hex.DecodeString(args)
+	if err != nil {
+		return "E01"
+	}
+	for _, reg := range g.target.Regs() {
+		size := reg.Bits / 8
+		if len(data) < size {
+			break
+		}
+		g.decodeReg(reg, data[:size])
+		data = data[size:]
+	}
+	return "OK"
+}
+
+func (g *GdbStub) readReg(n int) string {
+	regs := g.target.Regs()
+	if n >= len(regs) {
+		return "E01"
+	}
+	return g.encodeReg(regs[n])
+}
+
+func (g *GdbStub) writeReg(n int, val string) string {
+	regs := g.target.Regs()
+	data, err := hex.DecodeString(val)
+	if n >= len(regs) || err != nil {
+		return "E01"
+	}
+	g.decodeReg(regs[n], data)
+	return "OK"
+}
+
+func (g *GdbStub) readMem(args string) string {
+	var addr, size uint64
+	if _, err := fmt.Sscanf(args, "%x,%x", &addr, &size); err != nil {
+		return "E01"
+	}
+	mem, err := g.u.MemRead(addr, size)
+	if err != nil {
+		return "E14"
+	}
+	return hex.EncodeToString(mem)
+}
+
+func (g *GdbStub) writeMem(args string) string {
+	split := strings.SplitN(args, ":", 2)
+	if len(split) != 2 {
+		return "E01"
+	}
+	var addr, size uint64
+	if _, err := fmt.Sscanf(split[0], "%x,%x", &addr, &size); err != nil {
+		return "E01"
+	}
+	data, err := hex.DecodeString(split[1])
+	if err != nil || uint64(len(data)) != size {
+		return "E01"
+	}
+	if err := g.u.MemWrite(addr, data); err != nil {
+		return "E14"
+	}
+	return "OK"
+}
+
+func (g *GdbStub) breakpoint(set bool, args string) string {
+	split := strings.Split(args, ",")
+	if len(split) < 2 {
+		return "E01"
+	}
+	// only software and hardware execution breakpoints are supported
+	if split[0] != "0" && split[0] != "1" {
+		return ""
+	}
+	addr, err := strconv.ParseUint(split[1], 16, 64)
+	if err != nil {
+		return "E01"
+	}
+	if set {
+		g.dbg.Break(addr)
+	} else {
+		g.dbg.Unbreak(addr)
+	}
+	return "OK"
+}
+
+// Exit reports the guest's exit to the client and closes the connection.
+func (g *GdbStub) Exit(err error) {
+	if g.closed {
+		return
+	}
+	if status, ok := err.(models.ExitStatus); ok {
+		g.send(fmt.Sprintf("W%02x", uint8(status)))
+	} else if err != nil {
+		g.send(fmt.Sprintf("X%02x", sigSegv))
+	} else {
+		g.send("W00")
+	}
+	g.closed = true
+	g.conn.Close()
+}
@@ -0,0 +1,83 @@
+package debug
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestGdbPacket(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("+$qSupported#37$m0,4#00\x03"))
+	var acks bytes.Buffer
+	pkt, err := readPacket(in, &acks)
+	if err != nil || pkt != "qSupported" {
+		t.Fatalf("bad packet: %q %v", pkt, err)
+	}
+	// bad checksum is nacked and skipped
+	pkt, err = readPacket(in, &acks)
+	if err != nil || pkt != "\x03" {
+		t.Fatalf("expected interrupt, got: %q %v", pkt, err)
+	}
+	if acks.String() != "+-" {
+		t.Fatalf("bad acks: %q", acks.String())
+	}
+}
+
+func TestGdbStopReply(t *testing.T) {
+	conn, client := net.Pipe()
+	g := &GdbStub{dbg: &Debugger{}, conn: conn, packets: make(chan string, 4), lastSig: sigTrap}
+	out := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		out <- string(data)
+	}()
+	g.packets <- "qSupported"
+	g.packets <- "?"
+	g.packets <- "c"
+	g.stopped(&Stop{Reason: ReasonBreak})
+	// the initial stop isn't reported until the client asks
+	g.packets <- "D"
+	g.stopped(&Stop{Reason: ReasonBreak})
+	var want string
+	for _, pkt := range []string{"PacketSize=4000;qXfer:features:read+", "S05", "S05", "OK"} {
+		want += fmt.Sprintf("$%s#%02x", pkt, gdbChecksum(pkt))
+	}
+	if got := <-out; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGdbEscape(t *testing.T) {
+	if out := gdbEscape("a$b#c}d*"); out != "a}\x04b}\x03c}]d}\x0a" {
+		t.Fatalf("bad escape: %q", out)
+	}
+}
+
+func TestGdbXml(t *testing.T) {
+	target := &models.GdbTarget{
+		Arch: "test",
+		Features: []models.GdbFeature{
+			{"core", models.GdbNumbered("r", []int{1, 2}, 32, "")},
+			{"fpu", models.GdbUnsupported("f", 1, 64, "ieee_double")},
+		},
+	}
+	if len(target.Regs()) != 3 {
+		t.Fatal("wrong register count")
+	}
+	xml := target.Xml()
+	for _, s := range []string{
+		`<architecture>test</architecture>`,
+		`<reg name="r1" bitsize="32" type="int32" regnum="1"/>`,
+		`<reg name="f0" bitsize="64" type="ieee_double" regnum="2"/>`,
+	} {
+		if !strings.Contains(xml, s) {
+			t.Fatalf("missing %q in target xml:\n%s", s, xml)
+		}
+	}
+}
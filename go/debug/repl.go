@@ -0,0 +1,289 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var replHelp = `Commands:
+  b, break <addr|sym>      set a breakpoint
+  d, delete <addr|sym>     delete a breakpoint
+  bl, breaks               list breakpoints
+  s, step                  execute one instruction
+  n, next                  execute one instruction, stepping over calls
+  c, continue              run until the next breakpoint
+  r, regs                  show registers (changes since last stop are highlighted)
+  x, mem <addr> [len]      hexdump memory
+  dis [addr] [len]         disassemble memory
+  bt, backtrace            show the call stack
+  q, quit                  stop emulation
+An empty line repeats the previous command.
+Addresses can be numbers, register names or symbols, with an optional +offset.`
+
+var callMnemonics = map[string]bool{
+	"call": true, "callq": true, "lcall": true,
+	"bl": true, "blx": true, "blr": true,
+	"jal": true, "jalr": true, "bal": true, "bgezal": true, "bltzal": true,
+	"jsr": true, "bsr": true,
+}
+
+// Repl is an interactive command-line debugger.
+type Repl struct {
+	u      models.Usercorn
+	dbg    *Debugger
+	in     *bufio.Scanner
+	out    io.Writer
+	status models.StatusDiff
+	last   string
+}
+
+// NewRepl attaches a debugger to u which prompts on in/out before the first instruction,
+// on breakpoints and on invalid memory access.
+func NewRepl(u models.Usercorn, in io.Reader, out io.Writer) (*Repl, error) {
+	r := &Repl{
+		u:      u,
+		in:     bufio.NewScanner(in),
+		out:    out,
+		status: models.StatusDiff{U: u, Color: true},
+	}
+	r.dbg = NewDebugger(u, r.stopped)
+	if err := r.dbg.Attach(); err != nil {
+		return nil, err
+	}
+	r.dbg.Step()
+	return r, nil
+}
+
+func (r *Repl) printf(format string, a ...interface{}) {
+	fmt.Fprintf(r.out, format, a...)
+}
+
+func (r *Repl) symbolicate(addr uint64) string {
+	if sym, _ := r.u.Symbolicate(addr); sym != "" {
+		return fmt.Sprintf("0x%x (%s)", addr, sym)
+	}
+	return fmt.Sprintf("0x%x", addr)
+}
+
+func (r *Repl) stopped(stop *Stop) {
+	switch stop.Reason {
+	case ReasonBreak:
+		r.printf("Breakpoint at %s\n", r.symbolicate(stop.Addr))
+	case ReasonInterrupt:
+		r.printf("Interrupted at %s\n", r.symbolicate(stop.Addr))
+	case ReasonFault:
+		pc, _ := r.u.RegRead(r.u.Arch().PC)
+		var kind string
+		switch stop.Access {
+		case uc.MEM_WRITE_UNMAPPED, uc.MEM_WRITE_PROT:
+			kind = "write"
+		case uc.MEM_READ_UNMAPPED, uc.MEM_READ_PROT:
+			kind = "read"
+		case uc.MEM_FETCH_UNMAPPED, uc.MEM_FETCH_PROT:
+			kind = "fetch"
+		default:
+			kind = "access"
+		}
+		r.printf("Invalid %s of 0x%x bytes @0x%x, at %s\n", kind, stop.Size, stop.Addr, r.symbolicate(pc))
+		r.printf("(the guest will stop when you continue)\n")
+	}
+	if stop.Reason != ReasonFault {
+		if dis, err := r.u.Disas(stop.Addr, 16); err == nil && dis != "" {
+			r.printf("%s\n", strings.SplitN(dis, "\n", 2)[0])
+		}
+	}
+	for {
+		r.printf("(usercorn) ")
+		if !r.in.Scan() {
+			// no more input: run to completion
+			r.dbg.Detach()
+			return
+		}
+		line := strings.TrimSpace(r.in.Text())
+		if line == "" {
+			line = r.last
+		}
+		r.last = line
+		if r.command(line) {
+			return
+		}
+	}
+}
+
+// command runs a single command line, and returns true if the guest should resume.
+func (r *Repl) command(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "h", "help":
+		r.printf("%s\n", replHelp)
+	case "b", "break", "d", "delete":
+		if len(args) != 1 {
+			r.printf("Usage: %s <addr|sym>\n", cmd)
+			break
+		}
+		addr, err := r.parseAddr(args[0])
+		if err != nil {
+			r.printf("%s\n", err)
+		} else if cmd[0] == 'b' {
+			r.dbg.Break(addr)
+			r.printf("Breakpoint set at %s\n", r.symbolicate(addr))
+		} else {
+			r.dbg.Unbreak(addr)
+		}
+	case "bl", "breaks":
+		breaks := r.dbg.Breakpoints()
+		sort.Sort(addrList(breaks))
+		for _, addr := range breaks {
+			r.printf("  %s\n", r.symbolicate(addr))
+		}
+	case "s", "step":
+		r.dbg.Step()
+		return true
+	case "n", "next":
+		if ret, ok := r.callReturn(); ok {
+			r.dbg.BreakOnce(ret)
+			r.dbg.Continue()
+		} else {
+			r.dbg.Step()
+		}
+		return true
+	case "c", "continue":
+		r.dbg.Continue()
+		return true
+	case "r", "regs":
+		r.status.Changes().Print(r.out, "", true, false)
+	case "x", "mem":
+		if len(args) < 1 {
+			r.printf("Usage: %s <addr> [len]\n", cmd)
+			break
+		}
+		addr, size, err := r.parseRange(args, 64)
+		if err != nil {
+			r.printf("%s\n", err)
+			break
+		}
+		mem, err := r.u.MemRead(addr, size)
+		if err != nil {
+			r.printf("%s\n", err)
+			break
+		}
+		for _, line := range models.HexDump(addr, mem, int(r.u.Bits())) {
+			r.printf("%s\n", line)
+		}
+	case "dis", "disas":
+		if len(args) == 0 {
+			args = []string{"pc"}
+		}
+		addr, size, err := r.parseRange(args, 32)
+		if err != nil {
+			r.printf("%s\n", err)
+			break
+		}
+		dis, err := r.u.Disas(addr, size)
+		if err != nil {
+			r.printf("%s\n", err)
+		} else {
+			r.printf("%s\n", dis)
+		}
+	case "bt", "backtrace":
+		r.u.Stacktrace().Print(r.out, r.u)
+	case "q", "quit":
+		r.dbg.Detach()
+		r.u.Stop()
+		return true
+	default:
+		r.printf("Unknown command: %s (try help)\n", cmd)
+	}
+	return false
+}
+
+// callReturn returns the address after the current instruction if it's a call.
+func (r *Repl) callReturn() (uint64, bool) {
+	pc, err := r.u.RegRead(r.u.Arch().PC)
+	if err != nil {
+		return 0, false
+	}
+	dis, err := r.u.Disas(pc, 16)
+	if err != nil {
+		return 0, false
+	}
+	// "0x%x: <hex> <mnemonic> <ops>"
+	fields := strings.Fields(strings.SplitN(dis, "\n", 2)[0])
+	if len(fields) < 3 || !callMnemonics[fields[2]] {
+		return 0, false
+	}
+	ret := pc + uint64(len(fields[1])/2)
+	// mips calls return after the delay slot
+	if r.u.Arch().Radare == "mips" {
+		ret += 4
+	}
+	return ret, true
+}
+
+func (r *Repl) parseRange(args []string, defaultSize uint64) (uint64, uint64, error) {
+	addr, err := r.parseAddr(args[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	size := defaultSize
+	if len(args) > 1 {
+		if size, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return addr, size, nil
+}
+
+// parseAddr accepts a number, register or symbol, with an optional +offset.
+func (r *Repl) parseAddr(s string) (uint64, error) {
+	var off uint64
+	if split := strings.SplitN(s, "+", 2); len(split) == 2 {
+		var err error
+		if off, err = strconv.ParseUint(split[1], 0, 64); err != nil {
+			return 0, err
+		}
+		s = split[0]
+	}
+	if n, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return n + off, nil
+	}
+	arch := r.u.Arch()
+	enum := -1
+	switch strings.ToLower(s) {
+	case "pc":
+		enum = arch.PC
+	case "sp":
+		enum = arch.SP
+	default:
+		for e, name := range arch.Regs {
+			if name == strings.ToLower(s) {
+				enum = e
+				break
+			}
+		}
+	}
+	if enum >= 0 {
+		val, err := r.u.RegRead(enum)
+		return val + off, err
+	}
+	addr, err := r.u.ResolveSymbol(s)
+	return addr + off, err
+}
+
+type addrList []uint64
+
+func (a addrList) Len() int           { return len(a) }
+func (a addrList) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a addrList) Less(i, j int) bool { return a[i] < a[j] }
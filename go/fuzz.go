@@ -0,0 +1,389 @@
+package usercorn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+	"github.com/lunixbochs/usercorn/go/native"
+)
+
+const (
+	aflForksrvFd = 198
+	aflMapSize   = 1 << 16
+	fuzzPageBits = 12
+	// reported to AFL as the child pid, which it kills on timeout.
+	// This is above the kernel's PID_MAX_LIMIT, so no process can have it.
+	aflFakePid = 0x7fffffff
+	// afl-fuzz's default -t, used when neither FuzzConfig.Timeout nor AFL_TIMEOUT is set
+	aflDefaultTimeout = time.Second
+)
+
+type FuzzConfig struct {
+	// snapshot point, test cases start here (0 means the entry point)
+	Start uint64
+	// guest path serving the test case, or "" to use stdin
+	InputPath string
+	// stop a test case after this long. AFL can't kill a test case itself (there's no child process),
+	// so 0 means AFL_TIMEOUT (in milliseconds, like afl-fuzz -t) or one second.
+	Timeout time.Duration
+}
+
+// fuzzer holds the per test case state for Fuzz.
+type fuzzer struct {
+	u      *Usercorn
+	cfg    FuzzConfig
+	snap   *snapshot
+	stack  models.Stacktrace
+	bitmap []byte
+	prev   uint64
+	dirty  map[uint64]bool
+
+	input []byte
+	pos   int64
+	// guest fd serving the input
+	inputFd int
+	// reserves a host fd number for InputPath
+	null *os.File
+}
+
+func newFuzzer(u *Usercorn, cfg FuzzConfig) (*fuzzer, error) {
+	if cfg.Timeout < 0 {
+		return nil, errors.New("Fuzz timeout must not be negative.")
+	}
+	if cfg.Timeout == 0 {
+		var err error
+		if cfg.Timeout, err = aflTimeout(); err != nil {
+			return nil, err
+		}
+	}
+	f := &fuzzer{u: u, cfg: cfg, dirty: make(map[uint64]bool)}
+	if cfg.InputPath != "" {
+		null, err := os.Open(os.DevNull)
+		if err != nil {
+			return nil, err
+		}
+		f.null = null
+		f.inputFd = -1
+	}
+	if id := os.Getenv("__AFL_SHM_ID"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		if f.bitmap, err = native.Shmat(n, aflMapSize); err != nil {
+			return nil, err
+		}
+	} else {
+		f.bitmap = make([]byte, aflMapSize)
+	}
+	return f, nil
+}
+
+// aflTimeout returns the test case timeout from AFL_TIMEOUT, or afl-fuzz's default.
+func aflTimeout() (time.Duration, error) {
+	ms := os.Getenv("AFL_TIMEOUT")
+	if ms == "" {
+		return aflDefaultTimeout, nil
+	}
+	// afl-fuzz allows a "+" suffix on -t to skip hanging test cases
+	n, err := strconv.ParseUint(strings.TrimSuffix(ms, "+"), 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("Invalid AFL_TIMEOUT: %q", ms)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+func (f *fuzzer) addHooks() error {
+	u := f.u
+	_, err := u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+		f.edge(addr)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = u.HookAdd(uc.HOOK_MEM_WRITE, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) {
+		f.markDirty(addr, uint64(size))
+	})
+	if err != nil {
+		return err
+	}
+	prev := u.memWatch
+	u.memWatch = func(addr uint64, p []byte) {
+		if prev != nil {
+			prev(addr, p)
+		}
+		f.markDirty(addr, uint64(len(p)))
+	}
+	return nil
+}
+
+// edge records the transition from the previous block to addr in the AFL bitmap.
+func (f *fuzzer) edge(addr uint64) {
+	cur := (addr>>4 ^ addr<<8) & (aflMapSize - 1)
+	f.bitmap[cur^f.prev]++
+	f.prev = cur >> 1
+}
+
+func (f *fuzzer) markDirty(addr, size uint64) {
+	if size == 0 {
+		return
+	}
+	for page := addr >> fuzzPageBits; page <= (addr+size-1)>>fuzzPageBits; page++ {
+		f.dirty[page] = true
+	}
+}
+
+// reset restores guest memory, registers and kernel state (such as host fds opened by the target) to the snapshot.
+// Only dirty pages are copied back, unless the memory layout changed.
+func (f *fuzzer) reset() error {
+	u, s := f.u, f.snap
+	regions, err := u.MemRegions()
+	if err != nil {
+		return err
+	}
+	same := len(regions) == len(s.Memory)
+	for i := 0; same && i < len(regions); i++ {
+		m := s.Memory[i]
+		same = regions[i].Begin == m.Addr && regions[i].End == m.Addr+uint64(len(m.Data))-1
+	}
+	if !same {
+		err = u.applySnapshot(s)
+	} else {
+		err = f.restoreDirty()
+		if err == nil {
+			err = u.applySnapshotState(s)
+		}
+	}
+	f.dirty = make(map[uint64]bool)
+	u.stacktrace = f.stack.Copy()
+	u.exitStatus = nil
+	return err
+}
+
+func (f *fuzzer) restoreDirty() error {
+	for page := range f.dirty {
+		addr := page << fuzzPageBits
+		for _, m := range f.snap.Memory {
+			if addr < m.Addr || addr >= m.Addr+uint64(len(m.Data)) {
+				continue
+			}
+			off := addr - m.Addr
+			end := off + 1<<fuzzPageBits
+			if end > uint64(len(m.Data)) {
+				end = uint64(len(m.Data))
+			}
+			if err := f.u.MemWrite(addr, m.Data[off:end]); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fuzzer) readInput() error {
+	var err error
+	if f.cfg.InputPath != "" {
+		f.input, err = ioutil.ReadFile(f.cfg.InputPath)
+	} else {
+		f.input, err = ioutil.ReadAll(os.Stdin)
+	}
+	f.pos = 0
+	if f.cfg.InputPath != "" {
+		f.inputFd = -1
+	}
+	return err
+}
+
+// handles returns true if a syscall operates on the test case and should be answered by syscall().
+func (f *fuzzer) handles(name string, args []uint64) bool {
+	switch name {
+	case "read":
+		return len(args) > 0 && int(int32(args[0])) == f.inputFd
+	case "lseek", "close":
+		return f.cfg.InputPath != "" && len(args) > 0 && int(int32(args[0])) == f.inputFd
+	case "open":
+		path, _ := f.u.Mem().ReadStrAt(args[0])
+		return f.cfg.InputPath != "" && path == f.cfg.InputPath
+	case "openat":
+		path, _ := f.u.Mem().ReadStrAt(args[1])
+		return f.cfg.InputPath != "" && path == f.cfg.InputPath
+	}
+	return false
+}
+
+func (f *fuzzer) syscall(name string, args []uint64) uint64 {
+	switch name {
+	case "open", "openat":
+		f.inputFd = int(f.null.Fd())
+		f.pos = 0
+		return uint64(f.inputFd)
+	case "read":
+		n := int64(args[2])
+		if left := int64(len(f.input)) - f.pos; n > left {
+			n = left
+		}
+		if n <= 0 {
+			return 0
+		}
+		if err := f.u.MemWrite(args[1], f.input[f.pos:f.pos+n]); err != nil {
+			return errno(syscall.EFAULT)
+		}
+		f.pos += n
+		return uint64(n)
+	case "lseek":
+		off := int64(args[1])
+		switch args[2] {
+		case 1:
+			off += f.pos
+		case 2:
+			off += int64(len(f.input))
+		}
+		if off < 0 {
+			return errno(syscall.EINVAL)
+		}
+		f.pos = off
+		return uint64(off)
+	case "close":
+		f.inputFd = -1
+	}
+	return 0
+}
+
+func errno(err syscall.Errno) uint64 {
+	return uint64(-int64(err))
+}
+
+var errFuzzTimeout = errors.New("Fuzz test case timed out.")
+
+// run executes a single test case, returning a wait(2)-style status.
+func (f *fuzzer) run() (status uint32, err error) {
+	u := f.u
+	f.prev = 0
+	var timedOut int32
+	if f.cfg.Timeout > 0 {
+		timer := time.AfterFunc(f.cfg.Timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			u.Stop()
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			status, err = uint32(signaledStatus(int(syscall.SIGABRT))), fmt.Errorf("panic: %v", r)
+		}
+	}()
+	err = u.Unicorn.Start(f.snap.PC, 0xffffffffffffffff)
+	if atomic.LoadInt32(&timedOut) != 0 {
+		err = errFuzzTimeout
+	} else if err == nil {
+		err = u.exitStatus
+	}
+	return fuzzStatus(err), err
+}
+
+// fuzzStatus encodes the result of a test case as a wait(2) status: a timeout looks like
+// AFL's SIGKILL, an emulator error like a crash, and an exit like the guest's exit code.
+func fuzzStatus(err error) uint32 {
+	switch e := err.(type) {
+	case nil:
+		return 0
+	case models.ExitStatus:
+		return uint32(exitedStatus(int(e)))
+	}
+	if err == errFuzzTimeout {
+		return uint32(signaledStatus(int(syscall.SIGKILL)))
+	}
+	return uint32(signaledStatus(int(syscall.SIGSEGV)))
+}
+
+// Fuzz runs test cases using the AFL forkserver protocol. Instead of forking,
+// guest memory and registers are reset to a snapshot taken at cfg.Start between test cases.
+// Syscalls reading the input (stdin or cfg.InputPath) are answered from the current test case.
+// Without a forkserver (e.g. when reproducing a crash), a single test case runs.
+func (u *Usercorn) Fuzz(args []string, env []string, cfg FuzzConfig) error {
+	err := u.runFuzz(args, env, cfg)
+	u.runExitHooks(err)
+	return err
+}
+
+func (u *Usercorn) runFuzz(args []string, env []string, cfg FuzzConfig) error {
+	if err := u.prepare(args, env); err != nil {
+		return err
+	}
+	f, err := newFuzzer(u, cfg)
+	if err != nil {
+		return err
+	}
+	u.fuzz = f
+	if cfg.Start != 0 && cfg.Start != u.entry {
+		reached := false
+		hh, err := u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+			if addr == cfg.Start {
+				reached = true
+				u.Stop()
+			}
+		})
+		if err != nil {
+			return err
+		}
+		err = u.Unicorn.Start(u.entry, 0xffffffffffffffff)
+		u.HookDel(hh)
+		if err != nil {
+			return err
+		}
+		if !reached {
+			return fmt.Errorf("Fuzz start address 0x%x was never reached.", cfg.Start)
+		}
+	}
+	if f.snap, err = u.takeSnapshot(); err != nil {
+		return err
+	}
+	f.stack = u.stacktrace.Copy()
+	if err := f.addHooks(); err != nil {
+		return err
+	}
+	ctl := os.NewFile(aflForksrvFd, "afl-ctl")
+	st := os.NewFile(aflForksrvFd+1, "afl-st")
+	var buf [4]byte
+	if _, err := st.Write(buf[:]); err != nil {
+		// no forkserver
+		if err := f.readInput(); err != nil {
+			return err
+		}
+		_, err := f.run()
+		return err
+	}
+	for {
+		if _, err := ctl.Read(buf[:]); err != nil {
+			// afl-fuzz went away
+			return nil
+		}
+		binary.LittleEndian.PutUint32(buf[:], aflFakePid)
+		if _, err := st.Write(buf[:]); err != nil {
+			return err
+		}
+		if err := f.readInput(); err != nil {
+			return err
+		}
+		status, _ := f.run()
+		binary.LittleEndian.PutUint32(buf[:], status)
+		if _, err := st.Write(buf[:]); err != nil {
+			return err
+		}
+		if err := f.reset(); err != nil {
+			return errors.New("Fuzz reset failed: " + err.Error())
+		}
+	}
+}
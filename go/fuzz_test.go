@@ -0,0 +1,85 @@
+package usercorn
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestFuzzHandles(t *testing.T) {
+	f := &fuzzer{inputFd: 0}
+	if !f.handles("read", []uint64{0, 0x1000, 10}) {
+		t.Error("read from stdin wasn't handled")
+	}
+	if f.handles("read", []uint64{3, 0x1000, 10}) || f.handles("close", []uint64{0}) {
+		t.Error("handled a syscall on another fd")
+	}
+	// zero-argument syscalls must not index args
+	for _, name := range []string{"getpid", "read", "lseek", "close"} {
+		if f.handles(name, nil) {
+			t.Errorf("handled %s without arguments", name)
+		}
+	}
+	f = &fuzzer{cfg: FuzzConfig{InputPath: "/input"}, inputFd: 5}
+	if !f.handles("lseek", []uint64{5, 0, 0}) || !f.handles("close", []uint64{5}) {
+		t.Error("lseek/close on the input file weren't handled")
+	}
+}
+
+func TestFuzzBitmap(t *testing.T) {
+	f := &fuzzer{bitmap: make([]byte, aflMapSize)}
+	f.edge(0x1000)
+	f.edge(0x2000)
+	f.edge(0x1000)
+	f.edge(0x2000)
+	a := (0x1000>>4 ^ 0x1000<<8) & (aflMapSize - 1)
+	b := (0x2000>>4 ^ 0x2000<<8) & (aflMapSize - 1)
+	if f.bitmap[a] != 1 {
+		t.Errorf("entry edge: got %d hits", f.bitmap[a])
+	}
+	if f.bitmap[b^a>>1] != 2 {
+		t.Errorf("edge a->b: got %d hits", f.bitmap[b^a>>1])
+	}
+	if f.bitmap[a^b>>1] != 1 {
+		t.Errorf("edge b->a: got %d hits", f.bitmap[a^b>>1])
+	}
+	if f.prev != uint64(b>>1) {
+		t.Errorf("prev = 0x%x", f.prev)
+	}
+}
+
+func TestFuzzStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status uint32
+	}{
+		{nil, 0},
+		{models.ExitStatus(3), 0x300},
+		{errFuzzTimeout, uint32(syscall.SIGKILL)},
+		{errors.New("invalid read"), uint32(syscall.SIGSEGV)},
+	}
+	for _, test := range tests {
+		if status := fuzzStatus(test.err); status != test.status {
+			t.Errorf("fuzzStatus(%v) = 0x%x, want 0x%x", test.err, status, test.status)
+		}
+	}
+}
+
+func TestAflTimeout(t *testing.T) {
+	defer os.Unsetenv("AFL_TIMEOUT")
+	tests := map[string]time.Duration{"": time.Second, "500": 500 * time.Millisecond, "2000+": 2 * time.Second}
+	for env, want := range tests {
+		os.Setenv("AFL_TIMEOUT", env)
+		if got, err := aflTimeout(); err != nil || got != want {
+			t.Errorf("AFL_TIMEOUT=%q: got %v, %v; want %v", env, got, err, want)
+		}
+	}
+	os.Setenv("AFL_TIMEOUT", "0")
+	if _, err := aflTimeout(); err == nil {
+		t.Error("a zero AFL_TIMEOUT was accepted")
+	}
+}
@@ -0,0 +1,349 @@
+package usercorn
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+const (
+	heapRedzone = 16
+	heapArena   = 16 * 1024 * 1024
+)
+
+var heapFuncs = []string{"malloc", "calloc", "realloc", "free"}
+
+// callABI describes enough of a calling convention to replace a function.
+type callABI struct {
+	// integer argument registers, or nil if arguments are on the stack
+	args []int
+	ret  int
+	// link register, or -1 if the return address is on the stack
+	link int
+}
+
+var callABIs = map[string]*callABI{
+	"x86":    {nil, uc.X86_REG_EAX, -1},
+	"x86_64": {[]int{uc.X86_REG_RDI, uc.X86_REG_RSI}, uc.X86_REG_RAX, -1},
+	"arm":    {[]int{uc.ARM_REG_R0, uc.ARM_REG_R1}, uc.ARM_REG_R0, uc.ARM_REG_LR},
+	"arm64":  {[]int{uc.ARM64_REG_X0, uc.ARM64_REG_X1}, uc.ARM64_REG_X0, uc.ARM64_REG_X30},
+	"mips":   {[]int{uc.MIPS_REG_A0, uc.MIPS_REG_A1}, uc.MIPS_REG_V0, uc.MIPS_REG_RA},
+}
+
+func (a *callABI) arg(u *Usercorn, n int) uint64 {
+	if a.args != nil {
+		val, _ := u.RegRead(a.args[n])
+		return val
+	}
+	sp, _ := u.RegRead(u.arch.SP)
+	buf := make([]byte, u.Bsz)
+	u.MemReadInto(buf, sp+uint64(u.Bsz*(n+1)))
+	return u.UnpackAddr(buf)
+}
+
+func (a *callABI) retAddr(u *Usercorn) uint64 {
+	if a.link >= 0 {
+		addr, _ := u.RegRead(a.link)
+		return addr
+	}
+	sp, _ := u.RegRead(u.arch.SP)
+	buf := make([]byte, u.Bsz)
+	u.MemReadInto(buf, sp)
+	return u.UnpackAddr(buf)
+}
+
+// returns from the current function with val
+func (a *callABI) returnWith(u *Usercorn, val uint64) {
+	u.RegWrite(a.ret, val)
+	if a.link >= 0 {
+		addr, _ := u.RegRead(a.link)
+		u.RegWrite(u.arch.PC, addr)
+	} else {
+		addr, _ := u.Pop()
+		u.RegWrite(u.arch.PC, addr)
+	}
+}
+
+type heapTrace struct {
+	// return address of the allocator call
+	pc    uint64
+	stack models.Stacktrace
+}
+
+type heapChunk struct {
+	addr, size  uint64
+	freed       bool
+	alloc, free heapTrace
+}
+
+// start and end of the chunk including red zones
+func (c *heapChunk) start() uint64 { return c.addr - heapRedzone }
+func (c *heapChunk) end() uint64   { return c.addr + (c.size+15)&^15 + heapRedzone }
+
+// HeapError is reported by the heap sanitizer. It stops the guest like a fault.
+type HeapError struct {
+	// heap-buffer-overflow, heap-use-after-free, double-free or bad-free
+	Kind  string
+	Addr  uint64
+	Size  int
+	Write bool
+}
+
+func (e *HeapError) Error() string {
+	return fmt.Sprintf("%s at 0x%x", e.Kind, e.Addr)
+}
+
+// heapSan replaces the guest's malloc, calloc, realloc and free with an allocator surrounding each chunk
+// with red zones and never reusing freed memory, then checks guest memory access against it.
+type heapSan struct {
+	u      *Usercorn
+	abi    *callABI
+	funcs  map[uint64]string
+	chunks []*heapChunk
+	arenas []models.Segment
+	next   uint64
+}
+
+func (u *Usercorn) addHeapSan() error {
+	abi, ok := callABIs[u.loader.Arch()]
+	if !ok {
+		return fmt.Errorf("Heap sanitizer does not support arch: %s", u.loader.Arch())
+	}
+	h := &heapSan{u: u, abi: abi, funcs: make(map[uint64]string)}
+	for _, m := range u.modules() {
+		h.addLoader(m.l, m.base)
+	}
+	u.heapsan = h
+	if _, err := u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+		if name, ok := h.funcs[addr]; ok {
+			h.call(name)
+		}
+	}); err != nil {
+		return err
+	}
+	_, err := u.HookAdd(uc.HOOK_MEM_READ|uc.HOOK_MEM_WRITE, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) {
+		if h.inHeap(addr) {
+			h.access(access == uc.MEM_WRITE, addr, size)
+		}
+	})
+	return err
+}
+
+func (h *heapSan) addLoader(l models.Loader, base uint64) {
+	symtab := h.u.symtab(l)
+	for _, name := range heapFuncs {
+		if sym, ok := symtab.Find(name); ok {
+			h.funcs[base+sym.Start] = name
+		}
+	}
+}
+
+func (h *heapSan) inHeap(addr uint64) bool {
+	for _, a := range h.arenas {
+		if addr >= a.Start && addr < a.End {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the chunk (including red zones) containing addr.
+func (h *heapSan) find(addr uint64) *heapChunk {
+	i := sort.Search(len(h.chunks), func(i int) bool { return h.chunks[i].end() > addr })
+	if i < len(h.chunks) && h.chunks[i].start() <= addr {
+		return h.chunks[i]
+	}
+	return nil
+}
+
+func (h *heapSan) trace() heapTrace {
+	return heapTrace{h.abi.retAddr(h.u), h.u.stacktrace.Copy()}
+}
+
+func (h *heapSan) alloc(size uint64) (uint64, error) {
+	c := &heapChunk{size: size, alloc: h.trace()}
+	c.addr = h.next + heapRedzone
+	if len(h.arenas) == 0 || c.end() > h.arenas[len(h.arenas)-1].End {
+		span := uint64(heapArena)
+		if need := pageAlign(size + 3*heapRedzone); need > span {
+			span = need
+		}
+		addr, err := h.u.MmapRegion(models.Mmap{Addr: h.next, Size: span, Prot: uc.PROT_READ | uc.PROT_WRITE, Desc: "heap"}, false)
+		if err != nil {
+			return 0, err
+		}
+		h.arenas = append(h.arenas, models.Segment{addr, addr + span, uc.PROT_READ | uc.PROT_WRITE})
+		c.addr = addr + heapRedzone
+	}
+	h.next = c.end()
+	// arenas are mapped upwards, so chunks stay sorted
+	h.chunks = append(h.chunks, c)
+	return c.addr, nil
+}
+
+func (h *heapSan) call(name string) {
+	u, abi := h.u, h.abi
+	switch name {
+	case "malloc", "calloc":
+		size := abi.arg(u, 0)
+		if name == "calloc" {
+			n, elem := size, abi.arg(u, 1)
+			size = n * elem
+			if n != 0 && size/n != elem {
+				abi.returnWith(u, 0)
+				return
+			}
+		}
+		// arenas are fresh mappings, so calloc memory is already zeroed
+		addr, err := h.alloc(size)
+		if err != nil {
+			addr = 0
+		}
+		abi.returnWith(u, addr)
+	case "realloc":
+		ptr, size := abi.arg(u, 0), abi.arg(u, 1)
+		if ptr == 0 {
+			addr, _ := h.alloc(size)
+			abi.returnWith(u, addr)
+			return
+		}
+		c, ok := h.release(ptr)
+		if !ok {
+			return
+		}
+		if c == nil {
+			// not ours, let the guest handle it
+			return
+		}
+		if size == 0 {
+			abi.returnWith(u, 0)
+			return
+		}
+		addr, err := h.alloc(size)
+		if err != nil {
+			abi.returnWith(u, 0)
+			return
+		}
+		n := c.size
+		if size < n {
+			n = size
+		}
+		if data, err := u.MemRead(c.addr, n); err == nil {
+			u.MemWrite(addr, data)
+		}
+		abi.returnWith(u, addr)
+	case "free":
+		ptr := abi.arg(u, 0)
+		if ptr == 0 {
+			abi.returnWith(u, 0)
+			return
+		}
+		if c, ok := h.release(ptr); ok && c != nil {
+			abi.returnWith(u, 0)
+		}
+	}
+}
+
+// release marks the chunk at ptr as freed. It returns nil if ptr isn't from the sanitizer heap,
+// and false if the free was invalid (and reported).
+func (h *heapSan) release(ptr uint64) (*heapChunk, bool) {
+	if !h.inHeap(ptr) {
+		return nil, true
+	}
+	c := h.find(ptr)
+	if c == nil || c.addr != ptr {
+		h.report(&HeapError{Kind: "bad-free", Addr: ptr}, c)
+		return nil, false
+	}
+	if c.freed {
+		h.report(&HeapError{Kind: "double-free", Addr: ptr}, c)
+		return nil, false
+	}
+	c.freed = true
+	c.free = h.trace()
+	return c, true
+}
+
+// classify checks an access to the sanitizer heap, returning the error kind (if any) and the nearest chunk.
+func (h *heapSan) classify(addr uint64, size int) (string, *heapChunk) {
+	c := h.find(addr)
+	if c == nil {
+		// past the last chunk, or in a gap between arenas
+		i := sort.Search(len(h.chunks), func(i int) bool { return h.chunks[i].end() > addr })
+		if i > 0 {
+			c = h.chunks[i-1]
+		}
+		return "heap-buffer-overflow", c
+	}
+	if c.freed {
+		return "heap-use-after-free", c
+	}
+	if addr < c.addr || addr+uint64(size) > c.addr+c.size {
+		return "heap-buffer-overflow", c
+	}
+	return "", c
+}
+
+func (h *heapSan) access(write bool, addr uint64, size int) {
+	if kind, c := h.classify(addr, size); kind != "" {
+		h.report(&HeapError{kind, addr, size, write}, c)
+	}
+}
+
+func (h *heapSan) printTrace(w io.Writer, t heapTrace) {
+	sym, _ := h.u.Symbolicate(t.pc)
+	fmt.Fprintf(w, "  0x%x %s\n", t.pc, sym)
+	for i := len(t.stack.Stack) - 1; i >= 0; i-- {
+		frame := t.stack.Stack[i]
+		if _, ok := h.funcs[frame.PC]; !ok {
+			fmt.Fprintf(w, "  0x%x %s\n", frame.PC, frame.Sym)
+		}
+	}
+}
+
+func (h *heapSan) report(e *HeapError, c *heapChunk) {
+	u := h.u
+	if u.exitStatus != nil {
+		return
+	}
+	w := u.TraceOutput()
+	fmt.Fprintf(w, "\n[heap] %s", e.Kind)
+	if e.Size > 0 {
+		access := "read"
+		if e.Write {
+			access = "write"
+		}
+		fmt.Fprintf(w, ": %s of size %d at 0x%x", access, e.Size, e.Addr)
+	} else {
+		fmt.Fprintf(w, " at 0x%x", e.Addr)
+	}
+	if c != nil {
+		var where string
+		switch {
+		case e.Addr < c.addr:
+			where = fmt.Sprintf("%d bytes before", c.addr-e.Addr)
+		case e.Addr >= c.addr+c.size:
+			where = fmt.Sprintf("%d bytes after", e.Addr-(c.addr+c.size))
+		default:
+			where = fmt.Sprintf("%d bytes inside", e.Addr-c.addr)
+		}
+		fmt.Fprintf(w, " (%s %d-byte region 0x%x-0x%x)\n", where, c.size, c.addr, c.addr+c.size)
+	} else {
+		fmt.Fprintln(w)
+	}
+	u.stacktrace.Print(w, u)
+	if c != nil {
+		fmt.Fprintln(w, "allocated by:")
+		h.printTrace(w, c.alloc)
+		if c.freed {
+			fmt.Fprintln(w, "freed by:")
+			h.printTrace(w, c.free)
+		}
+	}
+	u.exitStatus = e
+	u.Stop()
+}
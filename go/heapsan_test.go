@@ -0,0 +1,33 @@
+package usercorn
+
+import (
+	"testing"
+)
+
+func TestHeapClassify(t *testing.T) {
+	h := &heapSan{}
+	h.chunks = []*heapChunk{
+		{addr: 0x1010, size: 10},
+		{addr: 0x1040, size: 16, freed: true},
+	}
+	tests := []struct {
+		addr uint64
+		size int
+		kind string
+	}{
+		{0x1010, 8, ""},
+		{0x1018, 2, ""},
+		{0x1018, 4, "heap-buffer-overflow"},
+		{0x100c, 4, "heap-buffer-overflow"},
+		{0x1044, 4, "heap-use-after-free"},
+		{0x1100, 1, "heap-buffer-overflow"},
+	}
+	for _, test := range tests {
+		if kind, _ := h.classify(test.addr, test.size); kind != test.kind {
+			t.Errorf("0x%x: got %q, expected %q", test.addr, kind, test.kind)
+		}
+	}
+	if c := h.find(0x1038); c == nil || c.addr != 0x1040 {
+		t.Fatal("find missed left red zone")
+	}
+}
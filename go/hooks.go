@@ -0,0 +1,137 @@
+package usercorn
+
+import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// SyscallEnterHook runs before a syscall is dispatched. Returning skip=true skips the
+// syscall (and any remaining enter hooks), and ret is used as its return value.
+type SyscallEnterHook func(num int, name string, args []uint64) (ret uint64, skip bool)
+
+// SyscallExitHook runs after a syscall and returns the (possibly modified) return value.
+type SyscallExitHook func(num int, name string, args []uint64, ret uint64) uint64
+
+// ExitHook runs when Run or Fuzz returns, with the error or exit status it will return.
+type ExitHook func(err error)
+
+// Hook is returned by the Hook* methods and can be passed to Unhook.
+// Hooks coexist with each other and with the built-in tracers. Only the hooks added
+// to the emulator (block, instruction and memory hooks) can fail.
+type Hook struct {
+	remove func()
+}
+
+func (u *Usercorn) ucHook(htype int, cb interface{}) (*Hook, error) {
+	hh, err := u.HookAdd(htype, cb)
+	if err != nil {
+		return nil, err
+	}
+	return &Hook{func() { u.HookDel(hh) }}, nil
+}
+
+// HookBlock calls cb at the start of each basic block.
+func (u *Usercorn) HookBlock(cb func(addr uint64, size uint32)) (*Hook, error) {
+	return u.ucHook(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+		cb(addr, size)
+	})
+}
+
+// HookInsn calls cb before each instruction.
+func (u *Usercorn) HookInsn(cb func(addr uint64, size uint32)) (*Hook, error) {
+	return u.ucHook(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+		cb(addr, size)
+	})
+}
+
+// HookMem calls cb on each guest memory read and write. For reads, value is not populated.
+func (u *Usercorn) HookMem(cb func(write bool, addr uint64, size int, value int64)) (*Hook, error) {
+	return u.ucHook(uc.HOOK_MEM_READ|uc.HOOK_MEM_WRITE, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) {
+		cb(access == uc.MEM_WRITE, addr, size, value)
+	})
+}
+
+// InvalidMemHook runs on unmapped or protected memory access. Returning true means it fixed
+// the problem (e.g. mapped the memory) and execution should continue.
+type InvalidMemHook func(access int, addr uint64, size int, value int64) bool
+
+// HookInvalidMem calls cb on unmapped or protected memory access, before the built-in handler reports a fault.
+// Returning true means cb fixed the problem (e.g. mapped the memory) and execution should continue.
+func (u *Usercorn) HookInvalidMem(cb InvalidMemHook) *Hook {
+	p := &cb
+	u.invalidMem = append(u.invalidMem, p)
+	return &Hook{func() {
+		for i, h := range u.invalidMem {
+			if h == p {
+				u.invalidMem = append(u.invalidMem[:i:i], u.invalidMem[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+// invalidMemHooks runs the HookInvalidMem callbacks, returning true if one of them handled the fault.
+func (u *Usercorn) invalidMemHooks(access int, addr uint64, size int, value int64) bool {
+	for _, hook := range u.invalidMem {
+		if (*hook)(access, addr, size, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// HookSyscallEnter calls cb before each syscall.
+func (u *Usercorn) HookSyscallEnter(cb SyscallEnterHook) *Hook {
+	p := &cb
+	u.sysEnter = append(u.sysEnter, p)
+	return &Hook{func() {
+		for i, h := range u.sysEnter {
+			if h == p {
+				u.sysEnter = append(u.sysEnter[:i:i], u.sysEnter[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+// HookSyscallExit calls cb after each syscall.
+func (u *Usercorn) HookSyscallExit(cb SyscallExitHook) *Hook {
+	p := &cb
+	u.sysExit = append(u.sysExit, p)
+	return &Hook{func() {
+		for i, h := range u.sysExit {
+			if h == p {
+				u.sysExit = append(u.sysExit[:i:i], u.sysExit[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+// runExitHooks calls the exit hooks with the error Run (or Fuzz) is about to return.
+func (u *Usercorn) runExitHooks(err error) {
+	for _, hook := range u.exitHooks {
+		(*hook)(err)
+	}
+}
+
+// HookExit calls cb when Run or Fuzz returns, including when the guest couldn't be started.
+func (u *Usercorn) HookExit(cb ExitHook) *Hook {
+	p := &cb
+	u.exitHooks = append(u.exitHooks, p)
+	return &Hook{func() {
+		for i, h := range u.exitHooks {
+			if h == p {
+				u.exitHooks = append(u.exitHooks[:i:i], u.exitHooks[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+// Unhook removes a hook added by one of the Hook* methods.
+func (u *Usercorn) Unhook(h *Hook) {
+	if h != nil && h.remove != nil {
+		h.remove()
+		h.remove = nil
+	}
+}
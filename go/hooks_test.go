@@ -0,0 +1,48 @@
+package usercorn
+
+import (
+	"testing"
+)
+
+func TestSyscallHookRemove(t *testing.T) {
+	u := &Usercorn{}
+	var calls []int
+	h1 := u.HookSyscallEnter(func(num int, name string, args []uint64) (uint64, bool) {
+		calls = append(calls, 1)
+		return 0, false
+	})
+	u.HookSyscallEnter(func(num int, name string, args []uint64) (uint64, bool) {
+		calls = append(calls, 2)
+		return 0, false
+	})
+	u.Unhook(h1)
+	u.Unhook(h1)
+	for _, hook := range u.sysEnter {
+		(*hook)(0, "", nil)
+	}
+	if len(calls) != 1 || calls[0] != 2 {
+		t.Fatalf("unexpected hook calls: %v", calls)
+	}
+}
+
+func TestInvalidMemHooks(t *testing.T) {
+	u := &Usercorn{}
+	var seen []uint64
+	u.HookInvalidMem(func(access int, addr uint64, size int, value int64) bool {
+		seen = append(seen, addr)
+		return false
+	})
+	h := u.HookInvalidMem(func(access int, addr uint64, size int, value int64) bool {
+		return addr == 0x1000
+	})
+	if !u.invalidMemHooks(0, 0x1000, 4, 0) || u.invalidMemHooks(0, 0x2000, 4, 0) {
+		t.Error("a handled fault wasn't reported")
+	}
+	u.Unhook(h)
+	if u.invalidMemHooks(0, 0x1000, 4, 0) {
+		t.Error("removed hook still handled a fault")
+	}
+	if len(seen) != 3 {
+		t.Errorf("hooks weren't run in order: %v", seen)
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"io"
 	"reflect"
 	"strings"
 	"unicode"
@@ -27,6 +28,20 @@ type Kernel interface {
 	UsercornSyscall(name string) *Syscall
 }
 
+// Snapshotter is implemented by kernels which hold state that needs to survive a snapshot/restore.
+type Snapshotter interface {
+	UsercornSnapshot(w io.Writer) error
+	UsercornRestore(r io.Reader) error
+}
+
+// Forker is implemented by kernels with per-process host resources (such as open files).
+// UsercornFork copies them into the same kernel of a forked child,
+// and UsercornRelease frees them when the process exits or execs.
+type Forker interface {
+	UsercornFork(child Kernel) error
+	UsercornRelease()
+}
+
 type KernelBase struct {
 	Syscalls map[string]Syscall
 	U        models.Usercorn
@@ -2,7 +2,6 @@ package common
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"strings"
 
@@ -34,16 +33,21 @@ func (s Syscall) traceArg(args []uint64, typ reflect.Type) string {
 	}
 }
 
-func (s Syscall) traceArgs(args []uint64) string {
+// ArgStrings decodes the syscall arguments as they're shown in a trace.
+func (s Syscall) ArgStrings(args []uint64) []string {
 	ret := make([]string, 0, len(s.In))
 	for i, typ := range s.In {
 		ret = append(ret, s.traceArg(args[i:], typ))
 	}
-	return strings.Join(ret, ", ")
+	return ret
+}
+
+func (s Syscall) traceArgs(args []uint64) string {
+	return strings.Join(s.ArgStrings(args), ", ")
 }
 
 func (s Syscall) Trace(args []uint64) {
-	fmt.Fprintf(os.Stderr, "%s(%s)", s.Name, s.traceArgs(args))
+	fmt.Fprintf(s.U().TraceOutput(), "%s(%s)", s.Name, s.traceArgs(args))
 }
 
 func (s Syscall) TraceRet(args []uint64, ret uint64) {
@@ -61,8 +65,8 @@ func (s Syscall) TraceRet(args []uint64, ret uint64) {
 		out = append(out, s.traceArg([]uint64{ret}, s.Out[0]))
 	}
 	if len(out) > 0 {
-		fmt.Fprintf(os.Stderr, " = %s\n", strings.Join(out, ", "))
+		fmt.Fprintf(s.U().TraceOutput(), " = %s\n", strings.Join(out, ", "))
 	} else {
-		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(s.U().TraceOutput(), "\n")
 	}
 }
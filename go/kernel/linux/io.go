@@ -13,7 +13,7 @@ import (
 const UINT64_MAX = 0xFFFFFFFFFFFFFFFF
 
 func (k *LinuxKernel) Getdents(dirfd co.Fd, buf co.Obuf, count uint64) uint64 {
-	dirPath, err := posix.PathFromFd(int(dirfd))
+	dirPath, err := posix.PathFromFd(k.UsercornHostFd(dirfd))
 	if err != nil {
 		return UINT64_MAX // FIXME
 	}
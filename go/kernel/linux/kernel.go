@@ -10,6 +10,8 @@ type LinuxKernel struct {
 	posix.PosixKernel
 
 	Unpack common.Unpacker
+	// clear_child_tid addresses by thread id
+	clearTid map[int]uint64
 }
 
 func DefaultKernel() *LinuxKernel {
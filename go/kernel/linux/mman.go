@@ -0,0 +1,56 @@
+package linux
+
+import (
+	"syscall"
+
+	"github.com/lunixbochs/usercorn/go/kernel/posix"
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+const (
+	MREMAP_MAYMOVE = 1
+	MREMAP_FIXED   = 2
+)
+
+func (k *LinuxKernel) Mremap(addr, oldSize, newSize uint64, flags int, newAddr uint64) uint64 {
+	if addr&posix.PAGE_MASK != 0 || newSize == 0 {
+		return posix.Errno(syscall.EINVAL)
+	}
+	if flags&MREMAP_FIXED == 0 {
+		ret, err := k.U.Mremap(addr, oldSize, newSize, flags&MREMAP_MAYMOVE != 0)
+		if err != nil {
+			return posix.Errno(syscall.ENOMEM)
+		}
+		return ret
+	}
+	if flags&MREMAP_MAYMOVE == 0 || newAddr&posix.PAGE_MASK != 0 {
+		return posix.Errno(syscall.EINVAL)
+	}
+	var old *models.Mmap
+	for _, m := range k.U.Mappings() {
+		if m.Contains(addr) {
+			old = &m
+			break
+		}
+	}
+	if old == nil || addr+oldSize > old.End() || (newAddr < addr+oldSize && newAddr+newSize > addr) {
+		return posix.Errno(syscall.EINVAL)
+	}
+	size := oldSize
+	if newSize < size {
+		size = newSize
+	}
+	data, err := k.U.MemRead(addr, size)
+	if err != nil {
+		return posix.Errno(syscall.EFAULT)
+	}
+	moved := *old
+	moved.Addr, moved.Size = newAddr, newSize
+	moved.Off = old.Off + (addr - old.Addr)
+	if _, err := k.U.MmapRegion(moved, true); err != nil {
+		return posix.Errno(syscall.ENOMEM)
+	}
+	k.U.MemWrite(newAddr, data)
+	k.U.MemUnmap(addr, (oldSize+posix.PAGE_MASK)&^posix.PAGE_MASK)
+	return newAddr
+}
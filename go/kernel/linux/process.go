@@ -0,0 +1,53 @@
+package linux
+
+import (
+	"syscall"
+
+	"github.com/lunixbochs/usercorn/go/kernel/posix"
+)
+
+const WNOHANG = 1
+
+func (k *LinuxKernel) Fork() uint64 {
+	return k.cloneProcess(0, 0, 0, 0)
+}
+
+func (k *LinuxKernel) Vfork() uint64 {
+	return k.cloneProcess(CLONE_VFORK, 0, 0, 0)
+}
+
+// cloneProcess forks a child process. Its memory is a copy even with CLONE_VM, which only vfork uses.
+func (k *LinuxKernel) cloneProcess(flags, stack, ptid, ctid uint64) uint64 {
+	var setTid uint64
+	if flags&CLONE_CHILD_SETTID != 0 {
+		setTid = ctid
+	}
+	pid, err := k.U.Processes().Fork(flags&CLONE_VFORK != 0, stack, setTid)
+	if err != nil {
+		return posix.Errno(syscall.ENOSYS)
+	}
+	if flags&CLONE_PARENT_SETTID != 0 {
+		k.writeU32(ptid, uint32(pid))
+	}
+	return uint64(pid)
+}
+
+// Wait4 treats process groups (pid 0 or below -1) as any child, and doesn't fill in rusage.
+func (k *LinuxKernel) Wait4(pid int, status uint64, options int, rusage uint64) uint64 {
+	// pid is signed on 32-bit guests too
+	if pid = int(int32(pid)); pid == 0 || pid < -1 {
+		pid = -1
+	}
+	cpid, ws, err := k.U.Processes().Wait(pid, options&WNOHANG != 0)
+	if err != nil {
+		return posix.Errno(err)
+	}
+	if cpid != 0 && status != 0 && !k.writeU32(status, uint32(ws)) {
+		return posix.Errno(syscall.EFAULT)
+	}
+	return uint64(cpid)
+}
+
+func (k *LinuxKernel) Waitpid(pid int, status uint64, options int) uint64 {
+	return k.Wait4(pid, status, options, 0)
+}
@@ -0,0 +1,33 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+type linuxState struct {
+	Posix    []byte
+	ClearTid map[int]uint64
+}
+
+// UsercornSnapshot adds clear_child_tid addresses to the posix kernel state.
+func (k *LinuxKernel) UsercornSnapshot(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := k.PosixKernel.UsercornSnapshot(&buf); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(linuxState{buf.Bytes(), k.clearTid})
+}
+
+func (k *LinuxKernel) UsercornRestore(r io.Reader) error {
+	var state linuxState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	if err := k.PosixKernel.UsercornRestore(bytes.NewReader(state.Posix)); err != nil {
+		return err
+	}
+	k.clearTid = state.ClearTid
+	return nil
+}
@@ -0,0 +1,22 @@
+package linux
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotClearTid(t *testing.T) {
+	k := DefaultKernel()
+	k.setClearTid(2, 0x1000)
+	var buf bytes.Buffer
+	if err := k.UsercornSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	k.setClearTid(3, 0x2000)
+	if err := k.UsercornRestore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(k.clearTid) != 1 || k.clearTid[2] != 0x1000 {
+		t.Errorf("clear_child_tid wasn't restored: %v", k.clearTid)
+	}
+}
@@ -0,0 +1,194 @@
+package linux
+
+import (
+	"syscall"
+
+	"github.com/lunixbochs/usercorn/go/kernel/posix"
+)
+
+const (
+	CLONE_VM             = 0x100
+	CLONE_VFORK          = 0x4000
+	CLONE_THREAD         = 0x10000
+	CLONE_SETTLS         = 0x80000
+	CLONE_PARENT_SETTID  = 0x100000
+	CLONE_CHILD_CLEARTID = 0x200000
+	CLONE_CHILD_SETTID   = 0x1000000
+)
+
+const (
+	FUTEX_WAIT        = 0
+	FUTEX_WAKE        = 1
+	FUTEX_REQUEUE     = 3
+	FUTEX_CMP_REQUEUE = 4
+	FUTEX_WAKE_OP     = 5
+	FUTEX_WAIT_BITSET = 9
+	FUTEX_WAKE_BITSET = 10
+
+	FUTEX_PRIVATE_FLAG   = 128
+	FUTEX_CLOCK_REALTIME = 256
+)
+
+func (k *LinuxKernel) readU32(addr uint64) (uint32, bool) {
+	var tmp [4]byte
+	if err := k.U.MemReadInto(tmp[:], addr); err != nil {
+		return 0, false
+	}
+	return k.U.ByteOrder().Uint32(tmp[:]), true
+}
+
+func (k *LinuxKernel) writeU32(addr uint64, val uint32) bool {
+	var tmp [4]byte
+	k.U.ByteOrder().PutUint32(tmp[:], val)
+	return k.U.MemWrite(addr, tmp[:]) == nil
+}
+
+// Clone supports threads (CLONE_VM|CLONE_THREAD) and processes (without CLONE_VM, or with CLONE_VFORK).
+// This is the argument order of most arches; x86_64 swaps tls and ctid.
+func (k *LinuxKernel) Clone(flags, stack, ptid, tls, ctid uint64) uint64 {
+	if flags&CLONE_VM == 0 || flags&CLONE_VFORK != 0 {
+		return k.cloneProcess(flags, stack, ptid, ctid)
+	}
+	if flags&(CLONE_VM|CLONE_THREAD) != CLONE_VM|CLONE_THREAD {
+		return posix.Errno(syscall.ENOSYS)
+	}
+	tid, err := k.U.Threads().Clone(stack, tls, flags&CLONE_SETTLS != 0)
+	if err != nil {
+		return posix.Errno(syscall.ENOSYS)
+	}
+	if flags&CLONE_PARENT_SETTID != 0 {
+		k.writeU32(ptid, uint32(tid))
+	}
+	if flags&CLONE_CHILD_SETTID != 0 {
+		k.writeU32(ctid, uint32(tid))
+	}
+	if flags&CLONE_CHILD_CLEARTID != 0 {
+		k.setClearTid(tid, ctid)
+	}
+	return uint64(tid)
+}
+
+func (k *LinuxKernel) setClearTid(tid int, addr uint64) {
+	if k.clearTid == nil {
+		k.clearTid = make(map[int]uint64)
+	}
+	k.clearTid[tid] = addr
+}
+
+func (k *LinuxKernel) SetTidAddress(addr uint64) uint64 {
+	tid := k.U.Threads().Tid()
+	k.setClearTid(tid, addr)
+	return uint64(tid)
+}
+
+func (k *LinuxKernel) Gettid() int {
+	return k.U.Threads().Tid()
+}
+
+func (k *LinuxKernel) SetRobustList() {}
+
+func (k *LinuxKernel) SchedYield() {
+	k.U.Threads().Yield()
+}
+
+// Exit ends the calling thread, waking anyone joining it through its clear_child_tid address.
+func (k *LinuxKernel) Exit(code int) {
+	threads := k.U.Threads()
+	tid := threads.Tid()
+	if addr, ok := k.clearTid[tid]; ok && addr != 0 {
+		k.writeU32(addr, 0)
+		threads.Wake(addr, 1, 0, 0)
+	}
+	delete(k.clearTid, tid)
+	threads.Exit(code)
+}
+
+// futexOp applies a FUTEX_WAKE_OP operation to old, returning the new value and whether the comparison passed.
+func futexOp(encoded uint32, old uint32) (uint32, bool) {
+	op, cmp := (encoded>>28)&7, (encoded>>24)&15
+	// 12-bit signed arguments
+	oparg := uint32(int32(encoded<<8) >> 20)
+	cmparg := uint32(int32(encoded<<20) >> 20)
+	if encoded&(8<<28) != 0 {
+		oparg = 1 << (oparg & 31)
+	}
+	val := old
+	switch op {
+	case 0:
+		val = oparg
+	case 1:
+		val += oparg
+	case 2:
+		val |= oparg
+	case 3:
+		val &^= oparg
+	case 4:
+		val ^= oparg
+	}
+	var ok bool
+	switch o, c := int32(old), int32(cmparg); cmp {
+	case 0:
+		ok = o == c
+	case 1:
+		ok = o != c
+	case 2:
+		ok = o < c
+	case 3:
+		ok = o <= c
+	case 4:
+		ok = o > c
+	case 5:
+		ok = o >= c
+	}
+	return val, ok
+}
+
+// Futex implements the wait queue used by pthreads. Waits can't time out while another thread can run.
+// timeout doubles as the requeue/wake count for REQUEUE, CMP_REQUEUE and WAKE_OP.
+func (k *LinuxKernel) Futex(uaddr uint64, op int, val uint32, timeout, uaddr2 uint64, val3 uint32) uint64 {
+	threads := k.U.Threads()
+	switch op &^ (FUTEX_PRIVATE_FLAG | FUTEX_CLOCK_REALTIME) {
+	case FUTEX_WAIT, FUTEX_WAIT_BITSET:
+		cur, ok := k.readU32(uaddr)
+		if !ok {
+			return posix.Errno(syscall.EFAULT)
+		}
+		if cur != val {
+			return posix.Errno(syscall.EAGAIN)
+		}
+		if !threads.Wait(uaddr, timeout != 0) {
+			return posix.Errno(syscall.ETIMEDOUT)
+		}
+		return 0
+	case FUTEX_WAKE, FUTEX_WAKE_BITSET:
+		woken, _ := threads.Wake(uaddr, int(val), 0, 0)
+		return uint64(woken)
+	case FUTEX_REQUEUE:
+		woken, _ := threads.Wake(uaddr, int(val), uaddr2, int(timeout))
+		return uint64(woken)
+	case FUTEX_CMP_REQUEUE:
+		if cur, ok := k.readU32(uaddr); !ok {
+			return posix.Errno(syscall.EFAULT)
+		} else if cur != val3 {
+			return posix.Errno(syscall.EAGAIN)
+		}
+		woken, requeued := threads.Wake(uaddr, int(val), uaddr2, int(timeout))
+		return uint64(woken + requeued)
+	case FUTEX_WAKE_OP:
+		old, ok := k.readU32(uaddr2)
+		if !ok {
+			return posix.Errno(syscall.EFAULT)
+		}
+		val2, cmp := futexOp(val3, old)
+		if !k.writeU32(uaddr2, val2) {
+			return posix.Errno(syscall.EFAULT)
+		}
+		woken, _ := threads.Wake(uaddr, int(val), 0, 0)
+		if cmp {
+			n, _ := threads.Wake(uaddr2, int(timeout), 0, 0)
+			woken += n
+		}
+		return uint64(woken)
+	}
+	return posix.Errno(syscall.ENOSYS)
+}
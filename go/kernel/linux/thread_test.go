@@ -0,0 +1,30 @@
+package linux
+
+import (
+	"testing"
+)
+
+func TestFutexOp(t *testing.T) {
+	tests := []struct {
+		op, old, val uint32
+		cmp          bool
+	}{
+		// FUTEX_OP_SET 0, compare old == 1 (glibc's lll_futex_wake_unlock)
+		{0<<28 | 0<<24 | 0<<12 | 1, 1, 0, true},
+		{0<<28 | 0<<24 | 0<<12 | 1, 2, 0, false},
+		// FUTEX_OP_ADD 5, compare old > 1
+		{1<<28 | 4<<24 | 5<<12 | 1, 2, 7, true},
+		// FUTEX_OP_OR (1 << 3), compare old != 0
+		{(8|2)<<28 | 1<<24 | 3<<12 | 0, 1, 9, true},
+		// FUTEX_OP_ANDN 1, compare old < -1 (sign extended)
+		{3<<28 | 2<<24 | 1<<12 | 0xfff, 3, 2, false},
+		// FUTEX_OP_XOR -1
+		{4<<28 | 5<<24 | 0xfff<<12 | 0, 0xf0, 0xffffff0f, true},
+	}
+	for _, test := range tests {
+		val, cmp := futexOp(test.op, test.old)
+		if val != test.val || cmp != test.cmp {
+			t.Errorf("futexOp(%#x, %d) = %#x, %v; want %#x, %v", test.op, test.old, val, cmp, test.val, test.cmp)
+		}
+	}
+}
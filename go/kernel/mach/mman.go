@@ -1,12 +1,15 @@
 package mach
 
 import (
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
 	co "github.com/lunixbochs/usercorn/go/kernel/common"
 	"github.com/lunixbochs/usercorn/go/kernel/posix"
+	"github.com/lunixbochs/usercorn/go/models"
 )
 
 func (k *MachKernel) MachVmAllocate(unk int, size co.Len, addrOut co.Buf) uint64 {
-	addr, err := k.U.Mmap(0, uint64(size))
+	addr, err := k.U.MmapRegion(models.Mmap{Size: uint64(size), Prot: uc.PROT_READ | uc.PROT_WRITE, Desc: "anon"}, false)
 	if err != nil {
 		return posix.UINT64_MAX // FIXME
 	}
@@ -0,0 +1,140 @@
+package posix
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+
+	co "github.com/lunixbochs/usercorn/go/kernel/common"
+)
+
+// fdTable maps guest fds to private host fds in a forked process, so it can't close or
+// replace its parent's files. The original process has no table and uses host fds directly.
+type fdTable map[int]int
+
+type posixer interface {
+	posix() *PosixKernel
+}
+
+func (k *PosixKernel) posix() *PosixKernel { return k }
+
+// UsercornHostFd returns the host fd for a guest fd, or -1 if it isn't open.
+func (k *PosixKernel) UsercornHostFd(fd co.Fd) int {
+	if k.fds == nil || fd < 0 {
+		// negative fds like AT_FDCWD are passed through
+		return int(fd)
+	}
+	if h, ok := k.fds[int(fd)]; ok {
+		return h
+	}
+	return -1
+}
+
+// guestFd assigns the lowest free guest fd to a new host fd.
+func (k *PosixKernel) guestFd(h int) int {
+	if k.fds == nil {
+		k.track(h)
+		return h
+	}
+	fd := 0
+	for ; ; fd++ {
+		if _, ok := k.fds[fd]; !ok {
+			break
+		}
+	}
+	k.fds[fd] = h
+	return fd
+}
+
+// track records a host fd opened by the original process. Stdio belongs to the host.
+func (k *PosixKernel) track(h int) {
+	if h <= 2 {
+		return
+	}
+	if k.opened == nil {
+		k.opened = make(map[int]bool)
+	}
+	k.opened[h] = true
+}
+
+// newFd translates the result of a syscall which returns a new host fd.
+func (k *PosixKernel) newFd(ret uint64) uint64 {
+	if int64(ret) < 0 {
+		return ret
+	}
+	return uint64(k.guestFd(int(ret)))
+}
+
+func (k *PosixKernel) UsercornFork(child co.Kernel) error {
+	c, ok := child.(posixer)
+	if !ok {
+		return nil
+	}
+	fds := make(fdTable)
+	if k.fds == nil {
+		// the original process can't track its host fds, so look them up
+		open, err := openFds()
+		if err != nil {
+			return err
+		}
+		for _, fd := range open {
+			fds[fd] = fd
+		}
+	} else {
+		for fd, h := range k.fds {
+			fds[fd] = h
+		}
+	}
+	for fd, h := range fds {
+		dup, err := syscall.Dup(h)
+		if err != nil {
+			delete(fds, fd)
+			continue
+		}
+		syscall.CloseOnExec(dup)
+		fds[fd] = dup
+	}
+	c.posix().fds = fds
+	c.posix().stdioReplaced = k.stdioReplaced
+	return nil
+}
+
+func (k *PosixKernel) UsercornRelease() {
+	for _, h := range k.fds {
+		syscall.Close(h)
+	}
+	if k.fds != nil {
+		k.fds = make(fdTable)
+	}
+}
+
+// openFds lists the host process's open fds.
+func openFds() ([]int, error) {
+	for _, path := range []string{"/proc/self/fd", "/dev/fd"} {
+		dir, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		names, err := dir.Readdirnames(-1)
+		dir.Close()
+		if err != nil {
+			return nil, err
+		}
+		var fds []int
+		for _, name := range names {
+			fd, err := strconv.Atoi(name)
+			if err != nil {
+				continue
+			}
+			// skip the fd used to read the directory
+			var stat syscall.Stat_t
+			if syscall.Fstat(fd, &stat) == nil {
+				fds = append(fds, fd)
+			}
+		}
+		sort.Ints(fds)
+		return fds, nil
+	}
+	return nil, syscall.ENOSYS
+}
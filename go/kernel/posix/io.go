@@ -10,7 +10,7 @@ import (
 
 func (k *PosixKernel) Read(fd co.Fd, buf co.Obuf, size co.Len) uint64 {
 	tmp := make([]byte, size)
-	n, err := syscall.Read(int(fd), tmp)
+	n, err := k.readFd(fd, tmp)
 	if err != nil {
 		return Errno(err)
 	}
@@ -25,7 +25,7 @@ func (k *PosixKernel) Write(fd co.Fd, buf co.Buf, size co.Len) uint64 {
 	if err := buf.Unpack(tmp); err != nil {
 		return UINT64_MAX // FIXME
 	}
-	n, err := syscall.Write(int(fd), tmp)
+	n, err := k.writeFd(fd, tmp)
 	if err != nil {
 		return Errno(err)
 	}
@@ -40,19 +40,30 @@ func (k *PosixKernel) Open(path string, mode int, flags uint32) uint64 {
 	if err != nil {
 		return Errno(err)
 	}
-	return uint64(fd)
+	return uint64(k.guestFd(fd))
 }
 
 func (k *PosixKernel) Close(fd co.Fd) uint64 {
+	if k.fds != nil {
+		h := k.UsercornHostFd(fd)
+		if h < 0 {
+			return Errno(syscall.EBADF)
+		}
+		k.replaceStdio(fd)
+		delete(k.fds, int(fd))
+		return Errno(syscall.Close(h))
+	}
 	// FIXME: temporary hack to preserve output on program exit
 	if fd == 2 {
 		return 0
 	}
+	delete(k.opened, int(fd))
+	k.replaceStdio(fd)
 	return Errno(syscall.Close(int(fd)))
 }
 
 func (k *PosixKernel) Lseek(fd co.Fd, offset co.Off, whence int) uint64 {
-	off, err := syscall.Seek(int(fd), int64(offset), whence)
+	off, err := syscall.Seek(k.UsercornHostFd(fd), int64(offset), whence)
 	if err != nil {
 		return Errno(err)
 	}
@@ -61,7 +72,7 @@ func (k *PosixKernel) Lseek(fd co.Fd, offset co.Off, whence int) uint64 {
 
 func (k *PosixKernel) Fstat(fd co.Fd, buf co.Buf) uint64 {
 	var stat syscall.Stat_t
-	if err := syscall.Fstat(int(fd), &stat); err != nil {
+	if err := syscall.Fstat(k.UsercornHostFd(fd), &stat); err != nil {
 		return Errno(err)
 	}
 	targetStat := NewTargetStat(&stat, k.U.OS(), k.U.Bits())
@@ -120,7 +131,7 @@ func (k *PosixKernel) Readv(fd co.Fd, iov co.Buf, count uint64) uint64 {
 	var read uint64
 	for vec := range iovecIter(iov, count, k.U.Bits()) {
 		tmp := make([]byte, vec.Len)
-		n, err := syscall.Read(int(fd), tmp)
+		n, err := k.readFd(fd, tmp)
 		if err != nil {
 			return Errno(err)
 		}
@@ -134,7 +145,7 @@ func (k *PosixKernel) Writev(fd co.Fd, iov co.Buf, count uint64) uint64 {
 	var written uint64
 	for vec := range iovecIter(iov, count, k.U.Bits()) {
 		data, _ := k.U.MemRead(vec.Base, vec.Len)
-		n, err := syscall.Write(int(fd), data)
+		n, err := k.writeFd(fd, data)
 		if err != nil {
 			return Errno(err)
 		}
@@ -148,20 +159,77 @@ func (k *PosixKernel) Chmod(path string, mode uint32) uint64 {
 }
 
 func (k *PosixKernel) Dup(oldFd co.Fd) uint64 {
-	if newFd, err := syscall.Dup(int(oldFd)); err != nil {
+	if newFd, err := syscall.Dup(k.UsercornHostFd(oldFd)); err != nil {
 		return Errno(err)
 	} else {
-		return uint64(newFd)
+		return uint64(k.guestFd(newFd))
 	}
 }
 
 func (k *PosixKernel) Dup2(oldFd co.Fd, newFd co.Fd) uint64 {
+	if k.fds != nil {
+		h := k.UsercornHostFd(oldFd)
+		if h < 0 || newFd < 0 {
+			return Errno(syscall.EBADF)
+		}
+		if oldFd == newFd {
+			return uint64(newFd)
+		}
+		dup, err := syscall.Dup(h)
+		if err != nil {
+			return Errno(err)
+		}
+		if old, ok := k.fds[int(newFd)]; ok {
+			syscall.Close(old)
+		}
+		k.replaceStdio(newFd)
+		k.fds[int(newFd)] = dup
+		return uint64(newFd)
+	}
 	if err := syscall.Dup2(int(oldFd), int(newFd)); err != nil {
 		return Errno(err)
 	}
+	if oldFd != newFd {
+		k.track(int(newFd))
+		k.replaceStdio(newFd)
+	}
 	return uint64(newFd)
 }
 
+func (k *PosixKernel) Pipe(fds co.Obuf) uint64 {
+	var p [2]int
+	if err := syscall.Pipe(p[:]); err != nil {
+		return Errno(err)
+	}
+	return k.packPipe(fds, p)
+}
+
+// Pipe2 is the only pipe syscall on some arches (such as arm64).
+func (k *PosixKernel) Pipe2(fds co.Obuf, flags int) uint64 {
+	var p [2]int
+	if err := syscall.Pipe(p[:]); err != nil {
+		return Errno(err)
+	}
+	for _, h := range p {
+		if flags&syscall.O_NONBLOCK != 0 {
+			syscall.SetNonblock(h, true)
+		}
+		if flags&syscall.O_CLOEXEC != 0 {
+			syscall.CloseOnExec(h)
+		}
+	}
+	return k.packPipe(fds, p)
+}
+
+// packPipe writes a new pipe's guest fds to the guest.
+func (k *PosixKernel) packPipe(fds co.Obuf, p [2]int) uint64 {
+	out := [2]int32{int32(k.guestFd(p[0])), int32(k.guestFd(p[1]))}
+	if err := fds.Pack(out); err != nil {
+		return Errno(syscall.EFAULT)
+	}
+	return 0
+}
+
 func (k *PosixKernel) Readlink(path string, buf co.Buf, size co.Len) uint64 {
 	// TODO: full proc emulation layer
 	// maybe have a syscall pre-hook for this after ghostrace makes it generic
@@ -195,7 +263,7 @@ func (k *PosixKernel) Link(src, dst string) uint64 {
 
 func (k *PosixKernel) Openat(dirfd co.Fd, path string, flags int, mode uint32) uint64 {
 	// TODO: flags might be different per arch
-	return openat_native(int(dirfd), path, flags, mode)
+	return k.newFd(openat_native(k.UsercornHostFd(dirfd), path, flags, mode))
 }
 
 func (k *PosixKernel) Chdir(path string) uint64 {
@@ -2,13 +2,12 @@ package posix
 
 import (
 	"fmt"
-	"io/ioutil"
+	"os"
 	"syscall"
 )
 
 func PathFromFd(dirfd int) (string, error) {
-	p, err := ioutil.ReadFile(fmt.Sprintf("/proc/self/fd/%d", dirfd))
-	return string(p), err
+	return os.Readlink(fmt.Sprintf("/proc/self/fd/%d", dirfd))
 }
 
 func openat_native(dirfd int, path string, flags int, mode uint32) uint64 {
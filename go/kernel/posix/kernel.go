@@ -8,6 +8,12 @@ import (
 type PosixKernel struct {
 	common.KernelBase
 	Unpack func(common.Buf, interface{})
+	// guest fds of a forked process
+	fds fdTable
+	// host fds opened by the original process, which a restore can close or reopen
+	opened map[int]bool
+	// guest stdio fds which were closed or replaced, so they no longer use Usercorn.Stdio()
+	stdioReplaced [3]bool
 }
 
 func pushAddrs(u models.Usercorn, addrs []uint64) error {
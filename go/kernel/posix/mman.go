@@ -1,16 +1,41 @@
 package posix
 
 import (
+	"fmt"
 	"os"
 	"syscall"
 
 	co "github.com/lunixbochs/usercorn/go/kernel/common"
+	"github.com/lunixbochs/usercorn/go/models"
 )
 
+const (
+	MAP_FIXED = 0x10
+	PAGE_MASK = 4096 - 1
+)
+
+// fdPath returns the host path of an open file, if it can be found.
+func fdPath(fd int) string {
+	if path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd)); err == nil {
+		return path
+	}
+	return fmt.Sprintf("fd%d", fd)
+}
+
 func (k *PosixKernel) Mmap(addrHint, size uint64, prot, flags int, fd co.Fd, off co.Off) uint64 {
-	addr, _ := k.U.Mmap(addrHint, size)
+	if size == 0 || (flags&MAP_FIXED != 0 && addrHint&PAGE_MASK != 0) {
+		return Errno(syscall.EINVAL)
+	}
+	m := models.Mmap{Addr: addrHint, Size: size, Prot: prot, Flags: flags, Desc: "anon"}
+	if fd > 0 {
+		m.Desc, m.File, m.Off = "file", fdPath(k.UsercornHostFd(fd)), uint64(off)
+	}
+	addr, err := k.U.MmapRegion(m, flags&MAP_FIXED != 0)
+	if err != nil {
+		return Errno(syscall.ENOMEM)
+	}
 	if fd > 0 {
-		fd2, _ := syscall.Dup(int(fd))
+		fd2, _ := syscall.Dup(k.UsercornHostFd(fd))
 		f := os.NewFile(uintptr(fd2), "")
 		f.Seek(int64(off), 0)
 		tmp := make([]byte, size)
@@ -22,14 +47,30 @@ func (k *PosixKernel) Mmap(addrHint, size uint64, prot, flags int, fd co.Fd, off
 }
 
 func (k *PosixKernel) Mmap2(addrHint, size uint64, prot, flags int, fd co.Fd, off co.Off) uint64 {
-	return k.Mmap(addrHint, size, prot, flags, fd, off)
+	// mmap2 offsets are in 4096-byte units
+	return k.Mmap(addrHint, size, prot, flags, fd, off*4096)
 }
 
 func (k *PosixKernel) Munmap(addr, size uint64) uint64 {
+	if addr&PAGE_MASK != 0 || size == 0 {
+		return Errno(syscall.EINVAL)
+	}
+	if err := k.U.MemUnmap(addr, (size+PAGE_MASK)&^PAGE_MASK); err != nil {
+		return Errno(syscall.EINVAL)
+	}
 	return 0
 }
 
-func (k *PosixKernel) Mprotect() uint64 {
+func (k *PosixKernel) Mprotect(addr, size uint64, prot int) uint64 {
+	if addr&PAGE_MASK != 0 {
+		return Errno(syscall.EINVAL)
+	}
+	if size == 0 {
+		return 0
+	}
+	if err := k.U.MemProtect(addr, (size+PAGE_MASK)&^PAGE_MASK, prot); err != nil {
+		return Errno(syscall.ENOMEM)
+	}
 	return 0
 }
 
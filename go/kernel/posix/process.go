@@ -1,7 +1,6 @@
 package posix
 
 import (
-	"os"
 	"syscall"
 
 	co "github.com/lunixbochs/usercorn/go/kernel/common"
@@ -16,14 +15,18 @@ func (k *PosixKernel) ExitGroup(code int) {
 }
 
 func (k *PosixKernel) Getpid() int {
-	return os.Getpid()
+	return k.U.Processes().Pid()
 }
 
 func (k *PosixKernel) Getppid() int {
-	return os.Getppid()
+	return k.U.Processes().Ppid()
 }
 
 func (k *PosixKernel) Kill(pid, signal int) uint64 {
+	// forked processes only exist inside the emulator
+	if ok, err := k.U.Processes().Kill(pid, signal); ok {
+		return Errno(err)
+	}
 	// TODO: os-specific signal handling?
 	return Errno(syscall.Kill(pid, syscall.Signal(signal)))
 }
@@ -51,5 +54,9 @@ func (k *PosixKernel) Execve(path string, argvBuf, envpBuf co.Buf) uint64 {
 	}
 	argv := readStrArray(argvBuf)
 	envp := readStrArray(envpBuf)
+	// a forked process can't replace the host, so it runs the new program itself
+	if ok, err := k.U.Processes().Exec(path, argv, envp); ok {
+		return Errno(err)
+	}
 	return Errno(syscall.Exec(path, argv, envp))
 }
@@ -0,0 +1,145 @@
+package posix
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// fdState describes an open guest fd in a snapshot.
+type fdState struct {
+	Fd    int
+	Path  string
+	Flags int
+	// -1 if the fd isn't seekable (pipes, sockets, ttys)
+	Off int64
+}
+
+type posixState struct {
+	Fds []fdState
+}
+
+// hostFds maps the guest fds this kernel opened (or inherited when forked) to host fds.
+func (k *PosixKernel) hostFds() map[int]int {
+	fds := make(map[int]int)
+	if k.fds != nil {
+		for fd, h := range k.fds {
+			fds[fd] = h
+		}
+	} else {
+		for fd := range k.opened {
+			fds[fd] = fd
+		}
+	}
+	return fds
+}
+
+func fdFlags(h int) (int, error) {
+	flags, _, errn := syscall.Syscall(syscall.SYS_FCNTL, uintptr(h), uintptr(syscall.F_GETFL), 0)
+	if errn != 0 {
+		return 0, errn
+	}
+	return int(flags), nil
+}
+
+func (k *PosixKernel) snapshotState() posixState {
+	var state posixState
+	for fd, h := range k.hostFds() {
+		f := fdState{Fd: fd, Off: -1}
+		f.Path, _ = PathFromFd(h)
+		f.Flags, _ = fdFlags(h)
+		if off, err := syscall.Seek(h, 0, io.SeekCurrent); err == nil {
+			f.Off = off
+		}
+		state.Fds = append(state.Fds, f)
+	}
+	return state
+}
+
+// UsercornSnapshot saves the path, flags and offset of every fd opened by the guest.
+func (k *PosixKernel) UsercornSnapshot(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(k.snapshotState())
+}
+
+// UsercornRestore closes fds the guest opened after the snapshot, rewinds the ones still open,
+// and reopens regular files it closed. Pipes and sockets can't be reopened and stay closed.
+func (k *PosixKernel) UsercornRestore(r io.Reader) error {
+	var state posixState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	return k.restoreState(state)
+}
+
+func (k *PosixKernel) restoreState(state posixState) error {
+	want := make(map[int]fdState)
+	for _, f := range state.Fds {
+		want[f.Fd] = f
+	}
+	open := k.hostFds()
+	for fd, h := range open {
+		if f, ok := want[fd]; ok {
+			if path, _ := PathFromFd(h); path == f.Path {
+				if f.Off >= 0 {
+					if _, err := syscall.Seek(h, f.Off, io.SeekStart); err != nil {
+						return err
+					}
+				}
+				delete(want, fd)
+				continue
+			}
+		}
+		k.forget(fd)
+		syscall.Close(h)
+	}
+	for _, f := range want {
+		if f.Off < 0 || f.Path == "" {
+			continue
+		}
+		h, err := syscall.Open(f.Path, f.Flags&^(syscall.O_CREAT|syscall.O_EXCL|syscall.O_TRUNC), 0)
+		if err != nil {
+			return fmt.Errorf("restoring fd %d (%s): %v", f.Fd, f.Path, err)
+		}
+		if _, err := syscall.Seek(h, f.Off, io.SeekStart); err != nil {
+			syscall.Close(h)
+			return err
+		}
+		if err := k.placeFd(f.Fd, h); err != nil {
+			syscall.Close(h)
+			return err
+		}
+	}
+	return nil
+}
+
+// forget removes a guest fd without closing its host fd.
+func (k *PosixKernel) forget(fd int) {
+	if k.fds != nil {
+		delete(k.fds, fd)
+	} else {
+		delete(k.opened, fd)
+	}
+}
+
+// placeFd installs host fd h as guest fd fd, taking ownership of h.
+func (k *PosixKernel) placeFd(fd, h int) error {
+	if k.fds != nil {
+		syscall.CloseOnExec(h)
+		k.fds[fd] = h
+		return nil
+	}
+	if h != fd {
+		// the original process shares fd numbers with the host, so don't replace one we didn't open
+		var stat syscall.Stat_t
+		if syscall.Fstat(fd, &stat) == nil {
+			return fmt.Errorf("can't restore fd %d: it's in use by the host", fd)
+		}
+		if err := syscall.Dup2(h, fd); err != nil {
+			return err
+		}
+		syscall.Close(h)
+	}
+	k.track(fd)
+	return nil
+}
@@ -0,0 +1,65 @@
+package posix
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	co "github.com/lunixbochs/usercorn/go/kernel/common"
+)
+
+func tempFile(t *testing.T) string {
+	f, err := ioutil.TempFile("", "usercorn-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("0123456789")
+	f.Close()
+	return f.Name()
+}
+
+func testSnapshotFds(t *testing.T, k *PosixKernel) {
+	path := tempFile(t)
+	defer os.Remove(path)
+	fd := co.Fd(k.Open(path, syscall.O_RDONLY, 0))
+	if int64(fd) < 0 {
+		t.Fatalf("open failed: %d", int64(fd))
+	}
+	k.Lseek(fd, 4, 0)
+	var buf bytes.Buffer
+	if err := k.UsercornSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.Bytes()
+
+	k.Lseek(fd, 8, 0)
+	extra := co.Fd(k.Open(path, syscall.O_RDONLY, 0))
+	if err := k.UsercornRestore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if off := k.Lseek(fd, 0, 1); off != 4 {
+		t.Errorf("offset wasn't restored: %d", off)
+	}
+	if h := k.UsercornHostFd(extra); h >= 0 && (k.fds != nil || k.opened[h]) {
+		t.Error("fd opened after the snapshot wasn't closed")
+	}
+
+	k.Close(fd)
+	if err := k.UsercornRestore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if off := k.Lseek(fd, 0, 1); off != 4 {
+		t.Errorf("closed fd wasn't reopened: %d", int64(off))
+	}
+	k.Close(fd)
+}
+
+func TestSnapshotFds(t *testing.T) {
+	testSnapshotFds(t, &PosixKernel{})
+}
+
+func TestSnapshotForkedFds(t *testing.T) {
+	testSnapshotFds(t, &PosixKernel{fds: make(fdTable)})
+}
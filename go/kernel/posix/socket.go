@@ -2,7 +2,6 @@ package posix
 
 import (
 	"fmt"
-	"os"
 	"syscall"
 
 	co "github.com/lunixbochs/usercorn/go/kernel/common"
@@ -13,15 +12,15 @@ func (k *PosixKernel) Socket(domain, typ, protocol int) uint64 {
 	if err != nil {
 		return Errno(err)
 	}
-	return uint64(fd)
+	return uint64(k.guestFd(fd))
 }
 
 func (k *PosixKernel) Connect(fd co.Fd, sa syscall.Sockaddr, size co.Len) uint64 {
-	return Errno(syscall.Connect(int(fd), sa))
+	return Errno(syscall.Connect(k.UsercornHostFd(fd), sa))
 }
 
 func (k *PosixKernel) Bind(fd co.Fd, sa syscall.Sockaddr, size co.Len) uint64 {
-	return Errno(syscall.Bind(int(fd), sa))
+	return Errno(syscall.Bind(k.UsercornHostFd(fd), sa))
 }
 
 func (k *PosixKernel) Sendto(fd co.Fd, buf co.Buf, size co.Len, flags int, sa syscall.Sockaddr, socklen co.Len) uint64 {
@@ -29,12 +28,12 @@ func (k *PosixKernel) Sendto(fd co.Fd, buf co.Buf, size co.Len, flags int, sa sy
 	if err := buf.Unpack(msg); err != nil {
 		return UINT64_MAX // FIXME
 	}
-	return Errno(syscall.Sendto(int(fd), msg, flags, sa))
+	return Errno(syscall.Sendto(k.UsercornHostFd(fd), msg, flags, sa))
 }
 
 func (k *PosixKernel) Recvfrom(fd co.Fd, buf co.Buf, size co.Len, flags int, from co.Buf, fromlen co.Len) uint64 {
 	p := make([]byte, size)
-	if n, _, err := syscall.Recvfrom(int(fd), p, flags); err != nil {
+	if n, _, err := syscall.Recvfrom(k.UsercornHostFd(fd), p, flags); err != nil {
 		// TODO: need kernel.Pack() so we can pack a sockaddr into from
 		buf.Pack(p)
 		return uint64(n)
@@ -45,7 +44,7 @@ func (k *PosixKernel) Recvfrom(fd co.Fd, buf co.Buf, size co.Len, flags int, fro
 
 func (k *PosixKernel) Getsockopt(fd co.Fd, level, opt int, valueOut, valueSizeOut co.Buf) uint64 {
 	// TODO: dispatch/support both addr and int types
-	value, err := syscall.GetsockoptInt(int(fd), level, opt)
+	value, err := syscall.GetsockoptInt(k.UsercornHostFd(fd), level, opt)
 	if err != nil {
 		return Errno(err)
 	}
@@ -63,14 +62,14 @@ func (k *PosixKernel) Getsockopt(fd co.Fd, level, opt int, valueOut, valueSizeOu
 func (k *PosixKernel) Setsockopt(fd co.Fd, level, opt int, valueIn co.Buf, size int) uint64 {
 	// TODO: dispatch/support all setsockopt types
 	if size != 4 {
-		fmt.Fprintf(os.Stderr, "WARNING: unsupported Setsockopt type %d\n", size)
+		fmt.Fprintf(k.U.TraceOutput(), "WARNING: unsupported Setsockopt type %d\n", size)
 		return UINT64_MAX // FIXME
 	}
 	var value int32
 	if err := valueIn.Unpack(&value); err != nil {
 		return UINT64_MAX // FIXME
 	}
-	if err := syscall.SetsockoptInt(int(fd), level, opt, opt); err != nil {
+	if err := syscall.SetsockoptInt(k.UsercornHostFd(fd), level, opt, opt); err != nil {
 		return Errno(err)
 	}
 	return 0
@@ -0,0 +1,65 @@
+package posix
+
+import (
+	"io"
+	"syscall"
+
+	co "github.com/lunixbochs/usercorn/go/kernel/common"
+)
+
+// stdin returns the reader replacing guest fd 0, or nil if the host fd is used.
+func (k *PosixKernel) stdin(fd co.Fd) io.Reader {
+	if fd != 0 || k.stdioReplaced[0] {
+		return nil
+	}
+	r, _, _ := k.U.Stdio()
+	return r
+}
+
+// stdout returns the writer replacing guest fd 1 or 2, or nil if the host fd is used.
+func (k *PosixKernel) stdout(fd co.Fd) io.Writer {
+	if fd < 1 || fd > 2 || k.stdioReplaced[fd] {
+		return nil
+	}
+	_, stdout, stderr := k.U.Stdio()
+	if fd == 1 {
+		return stdout
+	}
+	return stderr
+}
+
+// replaceStdio stops routing a guest stdio fd through Usercorn.Stdio() once it's closed or replaced.
+func (k *PosixKernel) replaceStdio(fd co.Fd) {
+	if fd >= 0 && fd <= 2 {
+		k.stdioReplaced[fd] = true
+	}
+}
+
+// readFd reads from a guest fd, using the Config stdin for fd 0.
+func (k *PosixKernel) readFd(fd co.Fd, p []byte) (int, error) {
+	if r := k.stdin(fd); r != nil {
+		n, err := r.Read(p)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, ioErrno(err)
+	}
+	return syscall.Read(k.UsercornHostFd(fd), p)
+}
+
+// writeFd writes to a guest fd, using the Config stdout and stderr for fds 1 and 2.
+func (k *PosixKernel) writeFd(fd co.Fd, p []byte) (int, error) {
+	if w := k.stdout(fd); w != nil {
+		n, err := w.Write(p)
+		return n, ioErrno(err)
+	}
+	return syscall.Write(k.UsercornHostFd(fd), p)
+}
+
+// ioErrno turns errors from a stdio reader or writer into an errno for the guest.
+func ioErrno(err error) error {
+	if _, ok := err.(syscall.Errno); err == nil || ok {
+		return err
+	}
+	return syscall.EIO
+}
@@ -0,0 +1,57 @@
+package posix
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	co "github.com/lunixbochs/usercorn/go/kernel/common"
+	"github.com/lunixbochs/usercorn/go/models/mock"
+)
+
+type stdioUsercorn struct {
+	mock.Usercorn
+	stdin          io.Reader
+	stdout, stderr bytes.Buffer
+}
+
+func (u *stdioUsercorn) Stdio() (io.Reader, io.Writer, io.Writer) {
+	return u.stdin, &u.stdout, &u.stderr
+}
+
+func TestConfigStdio(t *testing.T) {
+	u := &stdioUsercorn{stdin: strings.NewReader("input")}
+	k := &PosixKernel{fds: make(fdTable)}
+	k.U = u
+	p := make([]byte, 16)
+	if n, err := k.readFd(0, p); err != nil || string(p[:n]) != "input" {
+		t.Errorf("stdin: got %q, %v", p[:n], err)
+	}
+	if n, err := k.readFd(0, p); n != 0 || err != nil {
+		t.Errorf("stdin EOF: got %d, %v", n, err)
+	}
+	k.writeFd(1, []byte("out"))
+	k.writeFd(2, []byte("err"))
+	if u.stdout.String() != "out" || u.stderr.String() != "err" {
+		t.Errorf("got stdout %q, stderr %q", u.stdout.String(), u.stderr.String())
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := syscall.Dup(int(null.Fd()))
+	null.Close()
+	k.fds[3] = h
+	if ret := k.Dup2(co.Fd(3), co.Fd(1)); ret != 1 {
+		t.Fatalf("dup2 failed: %d", int64(ret))
+	}
+	k.writeFd(1, []byte("dropped"))
+	if u.stdout.String() != "out" {
+		t.Error("stdout was still used after the guest replaced fd 1")
+	}
+	k.UsercornRelease()
+}
@@ -0,0 +1,80 @@
+package usercorn
+
+import (
+	"github.com/lunixbochs/usercorn/go/loader"
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// mappedLib is a file mapped by the guest (usually a shared library mapped by the interpreter).
+// It's only parsed the first time something looks up symbols or modules.
+type mappedLib struct {
+	path   string
+	base   uint64
+	loader models.Loader
+	// parsed, but not a shared library (or couldn't be loaded)
+	skip bool
+}
+
+// module is a loaded image and its base address.
+type module struct {
+	l    models.Loader
+	base uint64
+}
+
+// modules returns the exe, interpreter and guest-mapped libraries.
+func (u *Usercorn) modules() []module {
+	modules := []module{{u.loader, u.base}}
+	if u.interpLoader != nil {
+		modules = append(modules, module{u.interpLoader, u.interpBase})
+	}
+	for _, lib := range u.libs {
+		if l := u.libLoader(lib); l != nil {
+			modules = append(modules, module{l, lib.base})
+		}
+	}
+	return modules
+}
+
+// symtab returns the (cached) symbol index for a loader.
+func (u *Usercorn) symtab(l models.Loader) *models.SymbolTable {
+	if t, ok := u.symtabs[l]; ok {
+		return t
+	}
+	if u.symtabs == nil {
+		u.symtabs = make(map[models.Loader]*models.SymbolTable)
+	}
+	symbols, _ := l.Symbols()
+	t := models.NewSymbolTable(symbols)
+	u.symtabs[l] = t
+	return t
+}
+
+// mapLib records a file the guest just mapped at addr, without parsing it.
+// It returns nil unless addr is the start of a new file mapping.
+func (u *Usercorn) mapLib(addr uint64) *mappedLib {
+	m := u.memory.find(addr)
+	if m == nil || m.Desc != "file" || m.Off != 0 || m.Addr != addr {
+		return nil
+	}
+	for _, lib := range u.libs {
+		if lib.path == m.File {
+			return nil
+		}
+	}
+	lib := &mappedLib{path: m.File, base: m.Addr}
+	u.libs = append(u.libs, lib)
+	return lib
+}
+
+// libLoader parses a mapped file the first time it's needed, returning nil if it isn't a shared library.
+func (u *Usercorn) libLoader(lib *mappedLib) models.Loader {
+	if lib.loader == nil && !lib.skip {
+		l, err := loader.LoadFileArch(lib.path, u.loader.Arch())
+		if err != nil || l.Type() != loader.DYN {
+			lib.skip = true
+		} else {
+			lib.loader = l
+		}
+	}
+	return lib.loader
+}
@@ -0,0 +1,32 @@
+package usercorn
+
+import (
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/loader"
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestMapLibLazy(t *testing.T) {
+	l, err := loader.LoadFile("../bins/x86_64.linux.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Usercorn{Unicorn: &Unicorn{}, loader: l}
+	u.memory.insert(&models.Mmap{Addr: 0x10000, Size: 0x1000, Desc: "file", File: "../bins/x86_64.linux.elf"})
+	u.memory.insert(&models.Mmap{Addr: 0x20000, Size: 0x1000, Desc: "anon"})
+	if u.mapLib(0x20000) != nil {
+		t.Error("anonymous mapping recorded as a library")
+	}
+	lib := u.mapLib(0x10000)
+	if lib == nil || lib.loader != nil || lib.skip {
+		t.Fatalf("mapping wasn't recorded without parsing: %+v", lib)
+	}
+	if u.mapLib(0x10000) != nil {
+		t.Error("the same file was recorded twice")
+	}
+	// an executable isn't a shared library
+	if mods := u.modules(); len(mods) != 1 || !lib.skip {
+		t.Errorf("non-library file in modules: %d modules, %+v", len(mods), lib)
+	}
+}
@@ -0,0 +1,151 @@
+package usercorn
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+type StopReason int32
+
+const (
+	// the guest exited, or emulation was stopped by something other than a limit
+	StopExit StopReason = iota
+	// invalid memory access or another emulator error
+	StopFault
+	// Config.MaxInsns reached
+	StopLimit
+	// Config.Timeout reached
+	StopTimeout
+	// the context passed to RunContext was cancelled
+	StopCancel
+)
+
+var stopReasonNames = map[StopReason]string{
+	StopExit:    "exit",
+	StopFault:   "fault",
+	StopLimit:   "instruction limit",
+	StopTimeout: "timeout",
+	StopCancel:  "cancelled",
+}
+
+func (r StopReason) String() string {
+	return stopReasonNames[r]
+}
+
+// RunStatus describes why emulation stopped.
+type RunStatus struct {
+	Reason StopReason
+	PC     uint64
+	// guest exit code, only valid if Exited is set
+	ExitCode int
+	Exited   bool
+	// only set for StopFault
+	Fault error
+}
+
+// Err converts the status to the error returned by Run: nil for a clean stop,
+// models.ExitStatus for a guest exit, the fault itself, or the *RunStatus for a limit.
+func (s *RunStatus) Err() error {
+	switch s.Reason {
+	case StopExit:
+		if s.Exited {
+			return models.ExitStatus(s.ExitCode)
+		}
+		return nil
+	case StopFault:
+		return s.Fault
+	}
+	return s
+}
+
+func (s *RunStatus) Error() string {
+	return fmt.Sprintf("emulation stopped at 0x%x: %s", s.PC, s.Reason)
+}
+
+// stopWith stops emulation, recording the reason unless another one was already recorded.
+func (u *Usercorn) stopWith(reason StopReason) {
+	if atomic.CompareAndSwapInt32(&u.stopReason, int32(StopExit), int32(reason)) {
+		u.Stop()
+	}
+}
+
+// RunContext runs the guest until it exits, faults, reaches Config.MaxInsns or Config.Timeout,
+// or ctx is cancelled. The returned error is only set if the guest couldn't be started.
+// Forked processes outlive the original one, so it waits for them (within the same limits) before returning.
+func (u *Usercorn) RunContext(ctx context.Context, args []string, env []string) (*RunStatus, error) {
+	start := time.Now()
+	status, err := u.runContext(ctx, args, env)
+	if p := u.proc; p != nil && p.root {
+		if u.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, start.Add(u.Timeout))
+			defer cancel()
+		}
+		p.table.waitForks(ctx)
+	}
+	if err != nil {
+		u.runExitHooks(err)
+	} else {
+		u.runExitHooks(status.Err())
+	}
+	return status, err
+}
+
+func (u *Usercorn) runContext(ctx context.Context, args []string, env []string) (*RunStatus, error) {
+	if err := u.prepare(args, env); err != nil {
+		return nil, err
+	}
+	atomic.StoreInt32(&u.stopReason, int32(StopExit))
+	if u.MaxInsns > 0 {
+		var count uint64
+		hh, err := u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+			if count++; count > u.MaxInsns {
+				u.stopWith(StopLimit)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer u.HookDel(hh)
+	}
+	if u.Timeout > 0 {
+		timer := time.AfterFunc(u.Timeout, func() { u.stopWith(StopTimeout) })
+		defer timer.Stop()
+	}
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				u.stopWith(StopCancel)
+			case <-done:
+			}
+		}()
+	}
+	err := u.start(u.entry)
+	status := &RunStatus{Reason: StopReason(atomic.LoadInt32(&u.stopReason))}
+	status.PC, _ = u.RegRead(u.arch.PC)
+	if u.TraceMemBatch && !u.memlog.Empty() {
+		u.memlog.Print(u.TraceOutput(), "", u.arch.Bits)
+		u.memlog.Reset()
+	}
+	if err != nil {
+		fmt.Fprintln(u.TraceOutput(), "Registers:")
+		u.status.Changes().Print(u.TraceOutput(), "", true, false)
+		fmt.Fprintln(u.TraceOutput(), "Stacktrace:")
+		u.stacktrace.Print(u.TraceOutput(), u)
+		status.Reason, status.Fault = StopFault, err
+	} else if exit, ok := u.exitStatus.(models.ExitStatus); ok {
+		status.Reason, status.Exited, status.ExitCode = StopExit, true, int(exit)
+	} else if u.exitStatus != nil {
+		status.Reason, status.Fault = StopFault, u.exitStatus
+	}
+	return status, nil
+}
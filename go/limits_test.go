@@ -0,0 +1,28 @@
+package usercorn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestRunStatusErr(t *testing.T) {
+	if err := (&RunStatus{Reason: StopExit}).Err(); err != nil {
+		t.Fatal("clean stop should not be an error")
+	}
+	if err := (&RunStatus{Reason: StopExit, Exited: true, ExitCode: 3}).Err(); err != models.ExitStatus(3) {
+		t.Fatalf("wrong exit error: %v", err)
+	}
+	fault := errors.New("fault")
+	if err := (&RunStatus{Reason: StopFault, Fault: fault}).Err(); err != fault {
+		t.Fatalf("wrong fault error: %v", err)
+	}
+	status := &RunStatus{Reason: StopTimeout, PC: 0x1000}
+	if err := status.Err(); err != status {
+		t.Fatalf("limit should return the status: %v", err)
+	}
+	if status.Error() != "emulation stopped at 0x1000: timeout" {
+		t.Fatalf("bad status message: %s", status)
+	}
+}
@@ -0,0 +1,104 @@
+package loader
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+var rawAliases = map[string]string{
+	"mipsel":  "mips",
+	"i386":    "x86",
+	"amd64":   "x86_64",
+	"aarch64": "arm64",
+}
+
+var rawArchMap = map[string]struct {
+	bits      int
+	byteOrder binary.ByteOrder
+}{
+	"arm":    {32, binary.LittleEndian},
+	"arm64":  {64, binary.LittleEndian},
+	"m68k":   {32, binary.BigEndian},
+	"mips":   {32, binary.LittleEndian},
+	"sparc":  {32, binary.BigEndian},
+	"x86":    {32, binary.LittleEndian},
+	"x86_64": {64, binary.LittleEndian},
+}
+
+// RawLoader maps a headerless blob (e.g. shellcode or a firmware fragment) as a single RWX segment.
+// It loads at the forced base address, or anywhere if there is none.
+type RawLoader struct {
+	LoaderHeader
+	data []byte
+}
+
+func NewRawLoader(r io.ReaderAt, arch, os string, entry uint64) (models.Loader, error) {
+	if alias, ok := rawAliases[arch]; ok {
+		arch = alias
+	}
+	info, ok := rawArchMap[arch]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported raw arch: %s", arch)
+	}
+	data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Raw input is empty.")
+	}
+	if entry >= uint64(len(data)) {
+		return nil, fmt.Errorf("Entry offset 0x%x is past the end of the input (0x%x bytes).", entry, len(data))
+	}
+	return &RawLoader{
+		LoaderHeader: LoaderHeader{
+			arch:      arch,
+			bits:      info.bits,
+			byteOrder: info.byteOrder,
+			os:        os,
+			entry:     entry,
+		},
+		data: data,
+	}, nil
+}
+
+func (r *RawLoader) Type() int {
+	return DYN
+}
+
+func (r *RawLoader) Interp() string {
+	return ""
+}
+
+func (r *RawLoader) Header() (uint64, []byte, int) {
+	return 0, nil, 0
+}
+
+func (r *RawLoader) Symbols() ([]models.Symbol, error) {
+	return nil, nil
+}
+
+func (r *RawLoader) Segments() ([]models.SegmentData, error) {
+	data := r.data
+	return []models.SegmentData{{
+		Off:      0,
+		Addr:     0,
+		Size:     uint64(len(data)),
+		Prot:     7,
+		DataFunc: func() ([]byte, error) { return data, nil },
+	}}, nil
+}
+
+func (r *RawLoader) DataSegment() (uint64, uint64) {
+	return 0, uint64(len(r.data))
+}
+
+func (r *RawLoader) DWARF() (*dwarf.Data, error) {
+	return nil, errors.New("Raw input has no DWARF data.")
+}
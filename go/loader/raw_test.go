@@ -0,0 +1,31 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	blob := []byte{0x90, 0x90, 0xcc}
+	l, err := NewRawLoader(bytes.NewReader(blob), "mipsel", "linux", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Arch() != "mips" || l.Bits() != 32 || l.ByteOrder() != binary.LittleEndian || l.OS() != "linux" || l.Entry() != 2 {
+		t.Fatal("bad raw header")
+	}
+	segments, err := l.Segments()
+	if err != nil || len(segments) != 1 || segments[0].Size != 3 {
+		t.Fatal("bad raw segments")
+	}
+	if data, _ := segments[0].Data(); !bytes.Equal(data, blob) {
+		t.Fatal("bad raw segment data")
+	}
+	if _, err := NewRawLoader(bytes.NewReader(blob), "mips", "linux", 3); err == nil {
+		t.Fatal("Failed to error on entry past end of input.")
+	}
+	if _, err := NewRawLoader(bytes.NewReader(blob), "ppc", "linux", 0); err == nil {
+		t.Fatal("Failed to error on unsupported arch.")
+	}
+}
@@ -5,16 +5,18 @@ const (
 	UC_MEM_ALIGN = 8 * 1024
 	STACK_BASE   = 0x60000000
 	STACK_SIZE   = 8 * 1024 * 1024
+	// granularity of munmap and mprotect
+	PAGE_SIZE = 4096
 )
 
-type mmap struct {
-	Start, Size uint64
+func pageAlign(size uint64) uint64 {
+	return (size + PAGE_SIZE - 1) &^ (PAGE_SIZE - 1)
 }
 
 func align(addr, size uint64, growl ...bool) (uint64, uint64) {
 	to := uint64(UC_MEM_ALIGN)
 	right := addr + size
-	right = ((right + to - 1) & ^to)
+	right = (right + to - 1) & ^(to - 1)
 	addr &= ^(to - 1)
 	size = right - addr
 	if len(growl) > 0 && growl[0] {
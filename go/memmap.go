@@ -0,0 +1,138 @@
+package usercorn
+
+import (
+	"sort"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// memMap is a sorted list of non-overlapping guest memory regions.
+// Adjacent regions with the same attributes are merged, and regions are split as needed by remove and update.
+type memMap []*models.Mmap
+
+// index returns the index of the first region ending after addr.
+func (mm memMap) index(addr uint64) int {
+	return sort.Search(len(mm), func(i int) bool { return mm[i].End() > addr })
+}
+
+func (mm memMap) find(addr uint64) *models.Mmap {
+	if i := mm.index(addr); i < len(mm) && mm[i].Contains(addr) {
+		return mm[i]
+	}
+	return nil
+}
+
+func (mm memMap) overlaps(addr, size uint64) bool {
+	i := mm.index(addr)
+	return i < len(mm) && mm[i].Overlaps(addr, size)
+}
+
+// covered returns true if all of [addr, addr+size) is mapped.
+func (mm memMap) covered(addr, size uint64) bool {
+	end := addr + size
+	for i := mm.index(addr); i < len(mm) && addr < end; i++ {
+		if mm[i].Addr > addr {
+			return false
+		}
+		addr = mm[i].End()
+	}
+	return addr >= end
+}
+
+// gaps returns the unmapped parts of [addr, addr+size) as (addr, size) pairs.
+func (mm memMap) gaps(addr, size uint64) [][2]uint64 {
+	var ret [][2]uint64
+	end := addr + size
+	for i := mm.index(addr); i < len(mm) && mm[i].Addr < end; i++ {
+		if mm[i].Addr > addr {
+			ret = append(ret, [2]uint64{addr, mm[i].Addr - addr})
+		}
+		addr = mm[i].End()
+	}
+	if addr < end {
+		ret = append(ret, [2]uint64{addr, end - addr})
+	}
+	return ret
+}
+
+// free returns the lowest unmapped range of size bytes at or above addr, aligned to align.
+func (mm memMap) free(addr, size, align, limit uint64) (uint64, bool) {
+	addr = (addr + align - 1) &^ (align - 1)
+	for i := mm.index(addr); i < len(mm) && mm[i].Addr < addr+size; i++ {
+		addr = (mm[i].End() + align - 1) &^ (align - 1)
+	}
+	return addr, addr+size > addr && addr+size <= limit
+}
+
+// split splits the region containing addr, so a region starts at addr.
+func (mm *memMap) split(addr uint64) {
+	i := mm.index(addr)
+	if i == len(*mm) || (*mm)[i].Addr >= addr {
+		return
+	}
+	left := (*mm)[i]
+	right := *left
+	right.Addr = addr
+	right.Size = left.End() - addr
+	if right.File != "" {
+		right.Off += addr - left.Addr
+	}
+	left.Size = addr - left.Addr
+	*mm = append(*mm, nil)
+	copy((*mm)[i+2:], (*mm)[i+1:])
+	(*mm)[i+1] = &right
+}
+
+// mergeable returns true if b continues a with the same attributes.
+func mergeable(a, b *models.Mmap) bool {
+	if a.End() != b.Addr || a.Prot != b.Prot || a.Flags != b.Flags || a.Desc != b.Desc || a.File != b.File {
+		return false
+	}
+	return a.File == "" || a.Off+a.Size == b.Off
+}
+
+func (mm *memMap) merge() {
+	if len(*mm) == 0 {
+		return
+	}
+	out := (*mm)[:1]
+	for _, m := range (*mm)[1:] {
+		if last := out[len(out)-1]; mergeable(last, m) {
+			last.Size += m.Size
+		} else {
+			out = append(out, m)
+		}
+	}
+	*mm = out
+}
+
+// insert adds a region, which must not overlap an existing one.
+func (mm *memMap) insert(m *models.Mmap) {
+	i := mm.index(m.Addr)
+	*mm = append(*mm, nil)
+	copy((*mm)[i+1:], (*mm)[i:])
+	(*mm)[i] = m
+	mm.merge()
+}
+
+// remove drops [addr, addr+size), splitting regions on the boundaries.
+func (mm *memMap) remove(addr, size uint64) {
+	mm.split(addr)
+	mm.split(addr + size)
+	i := mm.index(addr)
+	j := i
+	for j < len(*mm) && (*mm)[j].End() <= addr+size {
+		j++
+	}
+	*mm = append((*mm)[:i], (*mm)[j:]...)
+}
+
+// update calls fn on the mapped parts of [addr, addr+size), splitting regions on the boundaries.
+func (mm *memMap) update(addr, size uint64, fn func(m *models.Mmap)) {
+	mm.split(addr)
+	mm.split(addr + size)
+	for i := mm.index(addr); i < len(*mm) && (*mm)[i].Addr < addr+size; i++ {
+		fn((*mm)[i])
+	}
+	mm.merge()
+}
@@ -0,0 +1,73 @@
+package usercorn
+
+import (
+	"testing"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestMemMap(t *testing.T) {
+	var mm memMap
+	mm.insert(&models.Mmap{Addr: 0x3000, Size: 0x1000, Prot: 3, Desc: "anon"})
+	mm.insert(&models.Mmap{Addr: 0x1000, Size: 0x1000, Prot: 5, Desc: "file", File: "lib", Off: 0})
+	mm.insert(&models.Mmap{Addr: 0x2000, Size: 0x1000, Prot: 5, Desc: "file", File: "lib", Off: 0x1000})
+	if len(mm) != 2 || mm[0].Size != 0x2000 {
+		t.Fatalf("file regions weren't merged: %v", mm)
+	}
+	if !mm.covered(0x1000, 0x3000) || mm.covered(0x1000, 0x4000) {
+		t.Fatal("bad coverage check")
+	}
+	mm.update(0x1800, 0x1000, func(m *models.Mmap) { m.Prot = 7 })
+	if len(mm) != 4 || mm[1].Addr != 0x1800 || mm[1].Prot != 7 || mm[2].Off != 0x1800 {
+		t.Fatalf("bad split: %v", mm)
+	}
+	mm.update(0x1800, 0x1000, func(m *models.Mmap) { m.Prot = 5 })
+	if len(mm) != 2 {
+		t.Fatalf("split regions weren't merged: %v", mm)
+	}
+	mm.remove(0x1800, 0x2000)
+	if len(mm) != 2 || mm[0].End() != 0x1800 || mm[1].Addr != 0x3800 {
+		t.Fatalf("bad remove: %v", mm)
+	}
+	gaps := mm.gaps(0, 0x5000)
+	if len(gaps) != 3 || gaps[1] != [2]uint64{0x1800, 0x2000} {
+		t.Fatalf("bad gaps: %v", gaps)
+	}
+	if addr, ok := mm.free(0x1000, 0x2000, 0x1000, 0x10000); !ok || addr != 0x4000 {
+		t.Fatalf("bad free: 0x%x", addr)
+	}
+	if _, ok := mm.free(0x1000, 0x2000, 0x1000, 0x5000); ok {
+		t.Fatal("free ignored limit")
+	}
+}
+
+type fakeUnicorn struct {
+	uc.Unicorn
+	mapped [][2]uint64
+}
+
+func (f *fakeUnicorn) MemMapProt(addr, size uint64, prot int) error {
+	f.mapped = append(f.mapped, [2]uint64{addr, size})
+	return nil
+}
+
+func (f *fakeUnicorn) MemUnmap(addr, size uint64) error { return nil }
+
+func TestMapFixedPage(t *testing.T) {
+	f := &fakeUnicorn{}
+	u := &Unicorn{Unicorn: f}
+	if _, err := u.MmapRegion(models.Mmap{Addr: 0x11000, Size: 0x800, Prot: 3}, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.mapped) != 1 || f.mapped[0] != [2]uint64{0x11000, 0x1000} {
+		t.Fatalf("fixed 4K mapping was widened: %x", f.mapped)
+	}
+	if _, err := u.MmapRegion(models.Mmap{Addr: 0x10000, Size: 0x1000, Prot: 5}, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(u.memory) != 2 || u.memory[0].Prot != 5 || u.memory[1].Addr != 0x11000 || u.memory[1].Prot != 3 {
+		t.Fatalf("neighbouring page was replaced: %v", u.memory)
+	}
+}
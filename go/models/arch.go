@@ -59,6 +59,7 @@ type Arch struct {
 	SP      int
 	OS      map[string]*OS
 	Regs    regMap
+	Gdb     *GdbTarget
 
 	// sorted for RegDump
 	regList regList
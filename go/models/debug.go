@@ -4,86 +4,9 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
-	"github.com/bnagy/gapstone"
-	"io/ioutil"
-	"os/exec"
-	"regexp"
 	"strings"
 )
 
-var demangleRe = regexp.MustCompile(`^[^(]+`)
-
-func Demangle(name string) string {
-	if strings.HasPrefix(name, "__Z") {
-		name = name[1:]
-	} else if !strings.HasPrefix(name, "_Z") {
-		return name
-	}
-	cmd := exec.Command("c++filt", "-n")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return name
-	}
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return name
-	}
-	if err = cmd.Start(); err != nil {
-		fmt.Println("cmd error", err)
-		return name
-	}
-	stdin.Write([]byte(name + "\n"))
-	stdin.Close()
-	out, err := ioutil.ReadAll(stdout)
-	out = bytes.Trim(out, "\t\r\n ")
-	if err != nil || len(out) == 0 {
-		return name
-	}
-	cmd.Wait()
-	out = demangleRe.FindSubmatch(out)[0]
-	return string(out)
-}
-
-var discache = make(map[string]string)
-
-func Disas(mem []byte, addr uint64, arch *Arch, pad ...int) (string, error) {
-	cacheKey := string(mem)
-	if len(mem) == 0 {
-		return "", nil
-	}
-	var asm []gapstone.Instruction
-	if cached, ok := discache[cacheKey]; ok {
-		return cached, nil
-	}
-	engine, err := gapstone.New(arch.CS_ARCH, arch.CS_MODE)
-	if err != nil {
-		return "", err
-	}
-	defer engine.Close()
-	asm, err = engine.Disasm(mem, addr, 0)
-	if err != nil {
-		return "", err
-	}
-	var width uint
-	if len(pad) > 0 {
-		width = uint(pad[0])
-	}
-	for _, insn := range asm {
-		if insn.Size > width {
-			width = insn.Size
-		}
-	}
-	var out []string
-	for _, insn := range asm {
-		pad := strings.Repeat(" ", int(width-insn.Size)*2)
-		data := pad + hex.EncodeToString(insn.Bytes)
-		out = append(out, fmt.Sprintf("0x%x: %s %s %s", insn.Address, data, insn.Mnemonic, insn.OpStr))
-	}
-	ret := strings.Join(out, "\n")
-	discache[cacheKey] = ret
-	return ret, nil
-}
-
 func Repr(p []byte) string {
 	tmp := make([]string, len(p))
 	for i, b := range p {
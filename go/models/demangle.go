@@ -0,0 +1,809 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errDemangle = errors.New("Invalid mangled name.")
+
+// Demangle returns the demangled name of a C++ (Itanium ABI), Rust or Swift symbol without
+// parameter lists, or name unchanged if it isn't mangled or can't be parsed.
+func Demangle(name string) string {
+	return demangle(name, false)
+}
+
+// DemangleParams is Demangle, but keeps function parameters (and return types where mangled).
+func DemangleParams(name string) string {
+	return demangle(name, true)
+}
+
+func demangle(name string, params bool) (ret string) {
+	defer func() {
+		if recover() != nil {
+			ret = name
+		}
+	}()
+	// Mach-O symbols have an extra leading underscore
+	mangled := name
+	if strings.HasPrefix(mangled, "__Z") || strings.HasPrefix(mangled, "__R") || strings.HasPrefix(mangled, "_$s") || strings.HasPrefix(mangled, "_$S") {
+		mangled = mangled[1:]
+	}
+	switch {
+	case strings.HasPrefix(mangled, "_ZN") && rustLegacy(mangled):
+		return demangleRustLegacy(mangled)
+	case strings.HasPrefix(mangled, "_Z"):
+		d := &itanium{demangler: demangler{s: mangled}, params: params}
+		return d.mangled()
+	case strings.HasPrefix(mangled, "_R"):
+		// v0 symbols don't include function signatures
+		d := &rustV0{s: mangled[2:]}
+		return d.symbol()
+	case strings.HasPrefix(mangled, "$s"), strings.HasPrefix(mangled, "$S"), strings.HasPrefix(mangled, "_T0"):
+		return demangleSwift(mangled, params)
+	}
+	return name
+}
+
+// demangleMaxDepth limits nesting (like rustc-demangle's MAX_DEPTH), as a stack overflow can't be recovered from.
+const demangleMaxDepth = 500
+
+// demangleMaxSub limits the length of a substituted name, as chained substitutions can grow exponentially.
+const demangleMaxSub = 1 << 16
+
+// demangler is a cursor over a mangled name. Parse errors panic with errDemangle.
+type demangler struct {
+	s   string
+	pos int
+}
+
+func (d *demangler) fail() {
+	panic(errDemangle)
+}
+
+func (d *demangler) eof() bool {
+	return d.pos >= len(d.s)
+}
+
+func (d *demangler) peek() byte {
+	if d.eof() {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+func (d *demangler) peekAt(i int) byte {
+	if d.pos+i >= len(d.s) {
+		return 0
+	}
+	return d.s[d.pos+i]
+}
+
+func (d *demangler) next() byte {
+	if d.eof() {
+		d.fail()
+	}
+	c := d.s[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *demangler) consume(prefix string) bool {
+	if strings.HasPrefix(d.s[d.pos:], prefix) {
+		d.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (d *demangler) expect(c byte) {
+	if d.next() != c {
+		d.fail()
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// number reads a decimal number.
+func (d *demangler) number() int {
+	start := d.pos
+	for isDigit(d.peek()) {
+		d.pos++
+	}
+	n, err := strconv.Atoi(d.s[start:d.pos])
+	if err != nil {
+		d.fail()
+	}
+	return n
+}
+
+// ident reads n bytes.
+func (d *demangler) ident(n int) string {
+	if n < 0 || d.pos+n > len(d.s) {
+		d.fail()
+	}
+	s := d.s[d.pos : d.pos+n]
+	d.pos += n
+	return s
+}
+
+// ctype is a C++ type split around where a declarator goes, so "void (*)(int)" is "void (*" + ")(int)".
+type ctype struct {
+	left, right string
+	// right is already parenthesized, so more declarators go at the end of left
+	paren bool
+}
+
+func (t ctype) String() string {
+	return t.left + t.right
+}
+
+func (t ctype) declarator(sym string) ctype {
+	switch {
+	case t.right == "":
+		return ctype{left: t.left + sym}
+	case t.paren:
+		return ctype{t.left + sym, t.right, true}
+	default:
+		return ctype{t.left + "(" + sym, ")" + t.right, true}
+	}
+}
+
+// itanium parses the Itanium C++ ABI mangling used by GCC and Clang.
+type itanium struct {
+	demangler
+	params bool
+	subs   []ctype
+	// template arguments of the function being demangled
+	tmpl []ctype
+	// nesting of types and template arguments, to scope tmpl
+	depth int
+}
+
+var cppBuiltins = map[byte]string{
+	'v': "void", 'w': "wchar_t", 'b': "bool", 'c': "char", 'a': "signed char", 'h': "unsigned char",
+	's': "short", 't': "unsigned short", 'i': "int", 'j': "unsigned int", 'l': "long", 'm': "unsigned long",
+	'x': "long long", 'y': "unsigned long long", 'n': "__int128", 'o': "unsigned __int128",
+	'f': "float", 'd': "double", 'e': "long double", 'g': "__float128", 'z': "...",
+}
+
+var cppBuiltinsD = map[byte]string{
+	'd': "decimal64", 'e': "decimal128", 'f': "decimal32", 'h': "half", 'i': "char32_t", 's': "char16_t",
+	'u': "char8_t", 'a': "auto", 'c': "decltype(auto)", 'n': "decltype(nullptr)",
+}
+
+var cppOperators = map[string]string{
+	"nw": "new", "na": "new[]", "dl": "delete", "da": "delete[]", "ps": "+", "ng": "-", "ad": "&", "de": "*",
+	"co": "~", "pl": "+", "mi": "-", "ml": "*", "dv": "/", "rm": "%", "an": "&", "or": "|", "eo": "^",
+	"aS": "=", "pL": "+=", "mI": "-=", "mL": "*=", "dV": "/=", "rM": "%=", "aN": "&=", "oR": "|=", "eO": "^=",
+	"ls": "<<", "rs": ">>", "lS": "<<=", "rS": ">>=", "eq": "==", "ne": "!=", "lt": "<", "gt": ">",
+	"le": "<=", "ge": ">=", "ss": "<=>", "nt": "!", "aa": "&&", "oo": "||", "pp": "++", "mm": "--",
+	"cm": ",", "pm": "->*", "pt": "->", "cl": "()", "ix": "[]", "qu": "?", "aw": "co_await",
+}
+
+var cppStdSubs = map[byte]string{
+	'a': "std::allocator", 'b': "std::basic_string",
+	's': "std::basic_string<char, std::char_traits<char>, std::allocator<char> >",
+	'i': "std::basic_istream<char, std::char_traits<char> >",
+	'o': "std::basic_ostream<char, std::char_traits<char> >",
+	'd': "std::basic_iostream<char, std::char_traits<char> >",
+}
+
+func (d *itanium) mangled() string {
+	d.expect('_')
+	d.expect('Z')
+	ret := d.encoding()
+	// GCC clones such as foo.cold or foo.isra.0
+	if d.peek() == '.' {
+		ret += " [clone " + d.s[d.pos:] + "]"
+		d.pos = len(d.s)
+	}
+	if !d.eof() {
+		d.fail()
+	}
+	return ret
+}
+
+func (d *itanium) encoding() string {
+	if d.peek() == 'T' || d.peek() == 'G' {
+		return d.special()
+	}
+	name, tmplFn, cv := d.name()
+	if d.eof() || d.peek() == 'E' || d.peek() == '.' {
+		return name
+	}
+	// a function
+	var ret string
+	if tmplFn {
+		ret = d.typ().String() + " "
+	}
+	var params []string
+	for !d.eof() && d.peek() != 'E' && d.peek() != '.' {
+		params = append(params, d.typ().String())
+	}
+	if !d.params {
+		return name
+	}
+	if len(params) == 1 && params[0] == "void" {
+		params = nil
+	}
+	return ret + name + "(" + strings.Join(params, ", ") + ")" + cv
+}
+
+func (d *itanium) callOffset() {
+	switch d.next() {
+	case 'h':
+		d.offset()
+	case 'v':
+		d.offset()
+		d.offset()
+	default:
+		d.fail()
+	}
+}
+
+func (d *itanium) offset() {
+	d.consume("n")
+	d.number()
+	d.expect('_')
+}
+
+func (d *itanium) special() string {
+	switch {
+	case d.consume("TV"):
+		return "vtable for " + d.typ().String()
+	case d.consume("TT"):
+		return "VTT for " + d.typ().String()
+	case d.consume("TI"):
+		return "typeinfo for " + d.typ().String()
+	case d.consume("TS"):
+		return "typeinfo name for " + d.typ().String()
+	case d.consume("TH"):
+		name, _, _ := d.name()
+		return "TLS init function for " + name
+	case d.consume("TW"):
+		name, _, _ := d.name()
+		return "TLS wrapper function for " + name
+	case d.consume("Th"):
+		// the call offset starts with the h
+		d.pos--
+		d.callOffset()
+		return "non-virtual thunk to " + d.encoding()
+	case d.consume("Tv"):
+		d.pos--
+		d.callOffset()
+		return "virtual thunk to " + d.encoding()
+	case d.consume("Tc"):
+		d.callOffset()
+		d.callOffset()
+		return "covariant return thunk to " + d.encoding()
+	case d.consume("GTt"):
+		return "transaction clone for " + d.encoding()
+	case d.consume("GV"):
+		name, _, _ := d.name()
+		return "guard variable for " + name
+	case d.consume("GR"):
+		name, _, _ := d.name()
+		for d.peek() != '_' && !d.eof() {
+			d.pos++
+		}
+		d.consume("_")
+		return "reference temporary for " + name
+	}
+	d.fail()
+	return ""
+}
+
+func (d *itanium) addSub(t ctype) {
+	d.subs = append(d.subs, t)
+}
+
+// name parses a <name>. tmplFn is true if it ends in template arguments (so a function has a return type),
+// and cv holds the qualifiers of a member function.
+func (d *itanium) name() (name string, tmplFn bool, cv string) {
+	switch c := d.peek(); {
+	case c == 'N':
+		return d.nested()
+	case c == 'Z':
+		return d.local(), false, ""
+	case c == 'S' && d.peekAt(1) == 't':
+		d.pos += 2
+		name = "std::" + d.unqualified()
+	case c == 'S':
+		name = d.substitution().String()
+		if d.peek() != 'I' {
+			return name, false, ""
+		}
+		name += d.templateArgs()
+		return name, true, ""
+	default:
+		name = d.unqualified()
+	}
+	if d.peek() == 'I' {
+		d.addSub(ctype{left: name})
+		if strings.HasSuffix(name, "<") {
+			name += " "
+		}
+		name += d.templateArgs()
+		tmplFn = true
+	}
+	return name, tmplFn, ""
+}
+
+func joinScope(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "::" + name
+}
+
+// baseName returns the last component of a qualified name, without template arguments or abi tags.
+func baseName(name string) string {
+	// drop trailing template arguments
+	if strings.HasSuffix(name, ">") {
+		depth := 0
+		for i := len(name) - 1; i >= 0; i-- {
+			if name[i] == '>' {
+				depth++
+			} else if name[i] == '<' {
+				if depth--; depth == 0 {
+					name = name[:i]
+					break
+				}
+			}
+		}
+	}
+	depth := 0
+	for i := len(name) - 1; i > 0; i-- {
+		switch name[i] {
+		case '>':
+			depth++
+		case '<':
+			depth--
+		case ':':
+			if depth == 0 && name[i-1] == ':' {
+				name = name[i+1:]
+				i = 0
+			}
+		}
+	}
+	// abi tags aren't repeated on constructor names
+	if i := strings.Index(name, "[abi:"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (d *itanium) nested() (string, bool, string) {
+	d.expect('N')
+	var cv string
+	for {
+		switch d.peek() {
+		case 'r':
+			cv += " restrict"
+		case 'V':
+			cv += " volatile"
+		case 'K':
+			cv += " const"
+		default:
+			goto ref
+		}
+		d.pos++
+	}
+ref:
+	if d.consume("R") {
+		cv += " &"
+	} else if d.consume("O") {
+		cv += " &&"
+	}
+	var cur string
+	pending, tmplFn, ctor := false, false, false
+	for !d.consume("E") {
+		if d.peek() == 'I' {
+			if cur == "" {
+				d.fail()
+			}
+			if pending {
+				d.addSub(ctype{left: cur})
+			}
+			if strings.HasSuffix(cur, "<") {
+				cur += " "
+			}
+			cur += d.templateArgs()
+			pending, tmplFn = true, true
+			continue
+		}
+		if pending {
+			d.addSub(ctype{left: cur})
+			pending = false
+		}
+		tmplFn, ctor = false, false
+		switch c := d.peek(); {
+		case c == 'S' && d.peekAt(1) == 't':
+			d.pos += 2
+			cur = joinScope(cur, "std")
+		case c == 'S':
+			cur = d.substitution().String()
+		case c == 'T':
+			cur = d.templateParam().String()
+			pending = true
+		case c == 'C' || c == 'D' && strings.IndexByte("01245", d.peekAt(1)) >= 0:
+			d.pos++
+			d.consume("I")
+			d.next()
+			name := baseName(cur)
+			if c == 'D' {
+				name = "~" + name
+			}
+			cur = joinScope(cur, name)
+			cur += d.abiTags()
+			pending, ctor = true, true
+		case c == 'M':
+			d.pos++
+		default:
+			cur = joinScope(cur, d.unqualified())
+			pending = true
+		}
+	}
+	// constructors and destructors have no return type
+	return cur, tmplFn && !ctor, cv
+}
+
+func (d *itanium) local() string {
+	d.expect('Z')
+	saved := d.tmpl
+	fn := d.encoding()
+	d.tmpl = saved
+	d.expect('E')
+	var entity string
+	if d.consume("s") {
+		entity = "string literal"
+	} else {
+		entity, _, _ = d.name()
+	}
+	// discriminator
+	if d.consume("_") {
+		if d.consume("_") {
+			d.number()
+			d.expect('_')
+		} else {
+			d.number()
+		}
+	}
+	return fn + "::" + entity
+}
+
+func (d *itanium) sourceName() string {
+	n := d.number()
+	name := d.ident(n)
+	if strings.HasPrefix(name, "_GLOBAL__N") {
+		return "(anonymous namespace)"
+	}
+	return name
+}
+
+func (d *itanium) abiTags() string {
+	var ret string
+	for d.consume("B") {
+		ret += "[abi:" + d.sourceName() + "]"
+	}
+	return ret
+}
+
+// unqualified parses an <unqualified-name>.
+func (d *itanium) unqualified() string {
+	var name string
+	d.consume("L")
+	switch c := d.peek(); {
+	case isDigit(c):
+		name = d.sourceName()
+	case c == 'U' && d.peekAt(1) == 't':
+		d.pos += 2
+		n := 1
+		if d.peek() != '_' {
+			n = d.number() + 2
+		}
+		d.expect('_')
+		name = "{unnamed type#" + strconv.Itoa(n) + "}"
+	case c == 'U' && d.peekAt(1) == 'l':
+		d.pos += 2
+		var params []string
+		for d.peek() != 'E' {
+			params = append(params, d.typ().String())
+		}
+		d.pos++
+		if len(params) == 1 && params[0] == "void" {
+			params = nil
+		}
+		n := 1
+		if d.peek() != '_' {
+			n = d.number() + 2
+		}
+		d.expect('_')
+		name = "{lambda(" + strings.Join(params, ", ") + ")#" + strconv.Itoa(n) + "}"
+	case c == 'c' && d.peekAt(1) == 'v':
+		d.pos += 2
+		name = "operator " + d.typ().String()
+	case c == 'l' && d.peekAt(1) == 'i':
+		d.pos += 2
+		name = "operator\"\" " + d.sourceName()
+	case c >= 'a' && c <= 'z':
+		op, ok := cppOperators[d.ident(2)]
+		if !ok {
+			d.fail()
+		}
+		if op[0] >= 'a' && op[0] <= 'z' {
+			name = "operator " + op
+		} else {
+			name = "operator" + op
+		}
+	default:
+		d.fail()
+	}
+	return name + d.abiTags()
+}
+
+func (d *itanium) seqID() int {
+	if d.consume("_") {
+		return 0
+	}
+	n := 0
+	for {
+		c := d.next()
+		switch {
+		case isDigit(c):
+			n = n*36 + int(c-'0')
+		case c >= 'A' && c <= 'Z':
+			n = n*36 + int(c-'A') + 10
+		case c == '_':
+			return n + 1
+		default:
+			d.fail()
+		}
+	}
+}
+
+func (d *itanium) substitution() ctype {
+	d.expect('S')
+	if name, ok := cppStdSubs[d.peek()]; ok {
+		d.pos++
+		return ctype{left: name}
+	}
+	id := d.seqID()
+	if id >= len(d.subs) {
+		d.fail()
+	}
+	return d.checkSub(d.subs[id])
+}
+
+func (d *itanium) templateParam() ctype {
+	d.expect('T')
+	id := d.seqID()
+	if id >= len(d.tmpl) {
+		d.fail()
+	}
+	return d.checkSub(d.tmpl[id])
+}
+
+// checkSub fails on a substitution too long to repeat.
+func (d *itanium) checkSub(t ctype) ctype {
+	if len(t.left)+len(t.right) > demangleMaxSub {
+		d.fail()
+	}
+	return t
+}
+
+func (d *itanium) templateArgs() string {
+	d.expect('I')
+	if d.depth++; d.depth > demangleMaxDepth {
+		d.fail()
+	}
+	var args []ctype
+	for !d.consume("E") {
+		args = append(args, d.templateArg())
+	}
+	d.depth--
+	if d.depth == 0 {
+		d.tmpl = args
+	}
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = a.String()
+	}
+	ret := "<" + strings.Join(strs, ", ")
+	if strings.HasSuffix(ret, ">") {
+		ret += " "
+	}
+	return ret + ">"
+}
+
+func (d *itanium) templateArg() ctype {
+	switch d.peek() {
+	case 'L':
+		return ctype{left: d.literal()}
+	case 'J':
+		d.pos++
+		var args []string
+		for !d.consume("E") {
+			args = append(args, d.templateArg().String())
+		}
+		return ctype{left: strings.Join(args, ", ")}
+	case 'X':
+		// expressions aren't supported
+		d.fail()
+	}
+	return d.typ()
+}
+
+func (d *itanium) literal() string {
+	d.expect('L')
+	if d.consume("_Z") {
+		enc := d.encoding()
+		d.expect('E')
+		return enc
+	}
+	t := d.typ().String()
+	neg := d.consume("n")
+	start := d.pos
+	for d.peek() != 'E' {
+		d.next()
+	}
+	val := d.s[start:d.pos]
+	d.pos++
+	if neg {
+		val = "-" + val
+	}
+	switch t {
+	case "bool":
+		if val == "0" {
+			return "false"
+		}
+		return "true"
+	case "int":
+		return val
+	case "unsigned int":
+		return val + "u"
+	case "long":
+		return val + "l"
+	case "unsigned long":
+		return val + "ul"
+	}
+	return "(" + t + ")" + val
+}
+
+func (d *itanium) typ() ctype {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > demangleMaxDepth {
+		d.fail()
+	}
+	c := d.peek()
+	if name, ok := cppBuiltins[c]; ok {
+		d.pos++
+		return ctype{left: name}
+	}
+	var t ctype
+	switch c {
+	case 'u':
+		d.pos++
+		return ctype{left: d.sourceName()}
+	case 'D':
+		c2 := d.peekAt(1)
+		if name, ok := cppBuiltinsD[c2]; ok {
+			d.pos += 2
+			return ctype{left: name}
+		}
+		switch c2 {
+		case 'p':
+			// pack expansions are shown expanded, like c++filt
+			d.pos += 2
+			t = d.typ()
+		case 'F':
+			d.pos += 2
+			n := d.number()
+			d.expect('_')
+			return ctype{left: "_Float" + strconv.Itoa(n)}
+		case 'v':
+			d.pos += 2
+			n := d.number()
+			d.expect('_')
+			inner := d.typ()
+			t = ctype{left: inner.String() + " __vector(" + strconv.Itoa(n) + ")"}
+		case 'o', 'x':
+			d.pos += 2
+			t = d.typ()
+			return t
+		default:
+			d.fail()
+		}
+	case 'r', 'V', 'K':
+		var quals string
+		for {
+			switch d.peek() {
+			case 'r':
+				quals = " restrict" + quals
+			case 'V':
+				quals = " volatile" + quals
+			case 'K':
+				quals = " const" + quals
+			default:
+				goto qualified
+			}
+			d.pos++
+		}
+	qualified:
+		inner := d.typ()
+		if inner.right != "" && !inner.paren {
+			// qualified function type, e.g. for member function pointers
+			t = ctype{inner.left, inner.right + quals, false}
+		} else {
+			t = inner.declarator(quals)
+		}
+	case 'P', 'R', 'O':
+		d.pos++
+		sym := map[byte]string{'P': "*", 'R': "&", 'O': "&&"}[c]
+		t = d.typ().declarator(sym)
+	case 'C', 'G':
+		d.pos++
+		t = ctype{left: d.typ().String() + map[byte]string{'C': " _Complex", 'G': " _Imaginary"}[c]}
+	case 'F':
+		d.pos++
+		d.consume("Y")
+		ret := d.typ()
+		var params []string
+		for !d.consume("E") {
+			if d.consume("RE") || d.consume("OE") {
+				break
+			}
+			params = append(params, d.typ().String())
+		}
+		if len(params) == 1 && params[0] == "void" {
+			params = nil
+		}
+		t = ctype{left: ret.String() + " ", right: "(" + strings.Join(params, ", ") + ")"}
+	case 'A':
+		d.pos++
+		var dim string
+		if isDigit(d.peek()) {
+			dim = strconv.Itoa(d.number())
+		}
+		d.expect('_')
+		inner := d.typ()
+		t = ctype{inner.left, " [" + dim + "]" + strings.TrimPrefix(inner.right, " "), false}
+	case 'M':
+		d.pos++
+		class := d.typ().String()
+		member := d.typ()
+		t = member.declarator(" " + class + "::*")
+		if member.right != "" && !member.paren {
+			t = ctype{member.left + "(" + class + "::*", ")" + member.right, true}
+		}
+	case 'T':
+		t = d.templateParam()
+		if d.peek() == 'I' {
+			d.addSub(t)
+			t = ctype{left: t.String() + d.templateArgs()}
+		}
+	case 'S':
+		if d.peekAt(1) == 't' {
+			name, _, _ := d.name()
+			t = ctype{left: name}
+			break
+		}
+		sub := d.substitution()
+		if d.peek() != 'I' {
+			return sub
+		}
+		t = ctype{left: sub.String() + d.templateArgs()}
+	case 'N', 'Z', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		name, _, _ := d.name()
+		t = ctype{left: name}
+	default:
+		d.fail()
+	}
+	d.addSub(t)
+	return t
+}
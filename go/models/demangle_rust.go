@@ -0,0 +1,385 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rustLegacy returns true if an Itanium nested name ends in a Rust hash (17h<16 hex digits>E).
+func rustLegacy(s string) bool {
+	if !strings.HasSuffix(s, "E") || len(s) < 24 {
+		return false
+	}
+	hash := s[len(s)-20 : len(s)-1]
+	if !strings.HasPrefix(hash, "17h") {
+		return false
+	}
+	for _, c := range hash[3:] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+var rustEscapes = map[string]string{
+	"SP": "@", "BP": "*", "RF": "&", "LT": "<", "GT": ">", "LP": "(", "RP": ")", "C": ",",
+}
+
+// rustUnescape decodes the $...$ escapes and .. separators of legacy Rust identifiers.
+func rustUnescape(s string) string {
+	if strings.HasPrefix(s, "_$") {
+		s = s[1:]
+	}
+	var out strings.Builder
+	for len(s) > 0 {
+		switch {
+		case s[0] == '$':
+			end := strings.IndexByte(s[1:], '$')
+			if end < 0 {
+				panic(errDemangle)
+			}
+			esc := s[1 : end+1]
+			s = s[end+2:]
+			if r, ok := rustEscapes[esc]; ok {
+				out.WriteString(r)
+			} else if strings.HasPrefix(esc, "u") {
+				c, err := strconv.ParseUint(esc[1:], 16, 32)
+				if err != nil {
+					panic(errDemangle)
+				}
+				out.WriteRune(rune(c))
+			} else {
+				panic(errDemangle)
+			}
+		case strings.HasPrefix(s, ".."):
+			out.WriteString("::")
+			s = s[2:]
+		default:
+			out.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return out.String()
+}
+
+// demangleRustLegacy demangles _ZN<path>17h<hash>E, dropping the hash.
+func demangleRustLegacy(s string) string {
+	d := &demangler{s: s[3:]}
+	var parts []string
+	for !d.consume("E") {
+		parts = append(parts, d.ident(d.number()))
+	}
+	if !d.eof() {
+		d.fail()
+	}
+	parts = parts[:len(parts)-1]
+	for i, p := range parts {
+		parts[i] = rustUnescape(p)
+	}
+	return strings.Join(parts, "::")
+}
+
+var rustBasicTypes = map[byte]string{
+	'a': "i8", 'b': "bool", 'c': "char", 'd': "f64", 'e': "str", 'f': "f32", 'h': "u8", 'i': "isize",
+	'j': "usize", 'l': "i32", 'm': "u32", 'n': "i128", 'o': "u128", 'p': "_", 's': "i16", 't': "u16",
+	'u': "()", 'v': "...", 'x': "i64", 'y': "u64", 'z': "!",
+}
+
+// rustV0 parses the Rust v0 mangling (_R prefix, already stripped).
+type rustV0 struct {
+	s   string
+	pos int
+	// nested backrefs, which can point back into the path containing them
+	depth int
+}
+
+func (d *rustV0) cur() *demangler {
+	return &demangler{d.s, d.pos}
+}
+
+func (d *rustV0) peek() byte {
+	if d.pos >= len(d.s) {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+func (d *rustV0) next() byte {
+	if d.pos >= len(d.s) {
+		panic(errDemangle)
+	}
+	d.pos++
+	return d.s[d.pos-1]
+}
+
+func (d *rustV0) consume(c byte) bool {
+	if d.peek() == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// base62 reads a base-62 number terminated by '_' ("_" alone is 0).
+func (d *rustV0) base62() int {
+	if d.consume('_') {
+		return 0
+	}
+	n := 0
+	for {
+		c := d.next()
+		switch {
+		case c == '_':
+			return n + 1
+		case c >= '0' && c <= '9':
+			n = n*62 + int(c-'0')
+		case c >= 'a' && c <= 'z':
+			n = n*62 + int(c-'a') + 10
+		case c >= 'A' && c <= 'Z':
+			n = n*62 + int(c-'A') + 36
+		default:
+			panic(errDemangle)
+		}
+	}
+}
+
+func (d *rustV0) disambiguator() int {
+	if d.consume('s') {
+		return d.base62() + 1
+	}
+	return 0
+}
+
+func (d *rustV0) ident() string {
+	punycode := d.consume('u')
+	c := d.cur()
+	n := c.number()
+	d.pos = c.pos
+	d.consume('_')
+	c.pos = d.pos
+	name := c.ident(n)
+	d.pos = c.pos
+	if punycode {
+		return "punycode{" + name + "}"
+	}
+	return name
+}
+
+// backref parses at an earlier position.
+func (d *rustV0) backref(fn func() string) string {
+	target := d.base62()
+	if target >= d.pos || d.depth >= demangleMaxDepth {
+		panic(errDemangle)
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	saved := d.pos
+	d.pos = target
+	ret := fn()
+	d.pos = saved
+	return ret
+}
+
+func (d *rustV0) symbol() string {
+	// optional encoding version
+	if c := d.peek(); c >= '0' && c <= '9' {
+		panic(errDemangle)
+	}
+	ret := d.path(true)
+	// the instantiating crate and vendor suffixes aren't shown
+	return ret
+}
+
+func (d *rustV0) path(value bool) string {
+	switch c := d.next(); c {
+	case 'C':
+		d.disambiguator()
+		return d.ident()
+	case 'N':
+		ns := d.next()
+		parent := d.path(value)
+		dis := d.disambiguator()
+		name := d.ident()
+		switch {
+		case ns >= 'a' && ns <= 'z':
+			if name == "" {
+				return parent
+			}
+			return parent + "::" + name
+		case ns == 'C':
+			name = "{closure"
+		case ns == 'S':
+			name = "{shim"
+		default:
+			name = "{" + string(ns) + name
+		}
+		return parent + "::" + name + "#" + strconv.Itoa(dis) + "}"
+	case 'M':
+		d.disambiguator()
+		d.path(value)
+		return "<" + d.typ() + ">"
+	case 'X':
+		d.disambiguator()
+		d.path(value)
+		t := d.typ()
+		return "<" + t + " as " + d.path(false) + ">"
+	case 'Y':
+		t := d.typ()
+		return "<" + t + " as " + d.path(false) + ">"
+	case 'I':
+		p := d.path(value)
+		var args []string
+		for !d.consume('E') {
+			if a := d.genericArg(); a != "" {
+				args = append(args, a)
+			}
+		}
+		if value {
+			p += "::"
+		}
+		return p + "<" + strings.Join(args, ", ") + ">"
+	case 'B':
+		return d.backref(func() string { return d.path(value) })
+	}
+	panic(errDemangle)
+}
+
+func (d *rustV0) genericArg() string {
+	switch d.peek() {
+	case 'L':
+		d.pos++
+		d.base62()
+		// lifetimes aren't shown
+		return ""
+	case 'K':
+		d.pos++
+		return d.constant()
+	}
+	return d.typ()
+}
+
+func (d *rustV0) constant() string {
+	if d.consume('p') {
+		return "_"
+	}
+	if d.consume('B') {
+		return d.backref(d.constant)
+	}
+	t := d.next()
+	neg := d.consume('n')
+	start := d.pos
+	for d.peek() != '_' {
+		d.next()
+	}
+	hex := d.s[start:d.pos]
+	d.pos++
+	v, err := strconv.ParseUint(hex, 16, 64)
+	if hex != "" && err != nil {
+		return "0x" + hex
+	}
+	switch t {
+	case 'b':
+		return strconv.FormatBool(v != 0)
+	case 'c':
+		return strconv.QuoteRune(rune(v))
+	}
+	if neg {
+		return "-" + strconv.FormatUint(v, 10)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func (d *rustV0) binder() {
+	if d.consume('G') {
+		d.base62()
+	}
+}
+
+func (d *rustV0) typ() string {
+	c := d.peek()
+	if name, ok := rustBasicTypes[c]; ok {
+		d.pos++
+		return name
+	}
+	switch c {
+	case 'R', 'Q':
+		d.pos++
+		if d.peek() == 'L' {
+			d.pos++
+			d.base62()
+		}
+		if c == 'Q' {
+			return "&mut " + d.typ()
+		}
+		return "&" + d.typ()
+	case 'P':
+		d.pos++
+		return "*const " + d.typ()
+	case 'O':
+		d.pos++
+		return "*mut " + d.typ()
+	case 'A':
+		d.pos++
+		t := d.typ()
+		return "[" + t + "; " + d.constant() + "]"
+	case 'S':
+		d.pos++
+		return "[" + d.typ() + "]"
+	case 'T':
+		d.pos++
+		var types []string
+		for !d.consume('E') {
+			types = append(types, d.typ())
+		}
+		if len(types) == 1 {
+			return "(" + types[0] + ",)"
+		}
+		return "(" + strings.Join(types, ", ") + ")"
+	case 'F':
+		d.pos++
+		d.binder()
+		var prefix string
+		if d.consume('U') {
+			prefix = "unsafe "
+		}
+		if d.consume('K') {
+			if d.consume('C') {
+				prefix += "extern \"C\" "
+			} else {
+				prefix += "extern \"" + strings.Replace(d.ident(), "_", "-", -1) + "\" "
+			}
+		}
+		var params []string
+		for !d.consume('E') {
+			params = append(params, d.typ())
+		}
+		ret := d.typ()
+		s := prefix + "fn(" + strings.Join(params, ", ") + ")"
+		if ret != "()" {
+			s += " -> " + ret
+		}
+		return s
+	case 'D':
+		d.pos++
+		d.binder()
+		var traits []string
+		for !d.consume('E') {
+			trait := d.path(false)
+			for d.consume('p') {
+				name := d.ident()
+				trait += "<" + name + " = " + d.typ() + ">"
+			}
+			traits = append(traits, trait)
+		}
+		// lifetime bound
+		if d.consume('L') {
+			d.base62()
+		}
+		return "dyn " + strings.Join(traits, " + ")
+	case 'B':
+		d.pos++
+		return d.backref(d.typ)
+	}
+	return d.path(false)
+}
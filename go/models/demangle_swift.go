@@ -0,0 +1,340 @@
+package models
+
+import (
+	"strings"
+)
+
+var swiftStdTypes = map[byte]string{
+	'a': "Array", 'b': "Bool", 'c': "UnicodeScalar", 'D': "Dictionary", 'd': "Double", 'f': "Float",
+	'h': "Set", 'I': "DefaultIndices", 'i': "Int", 'J': "Character", 'N': "ClosedRange", 'n': "Range",
+	'O': "ObjectIdentifier", 'P': "UnsafePointer", 'p': "UnsafeMutablePointer", 'Q': "ImplicitlyUnwrappedOptional",
+	'q': "Optional", 'R': "UnsafeBufferPointer", 'r': "UnsafeMutableBufferPointer", 'S': "String",
+	's': "Substring", 'u': "UInt", 'V': "UnsafeRawPointer", 'v': "UnsafeMutableRawPointer",
+	'W': "UnsafeRawBufferPointer", 'w': "UnsafeMutableRawBufferPointer",
+}
+
+const (
+	swiftIdent = iota
+	swiftContext
+	swiftType
+	swiftEmpty
+	swiftEntity
+)
+
+type swiftNode struct {
+	kind int
+	text string
+	// first element of a type list
+	first bool
+}
+
+// swift demangles common Swift 4+ entities (functions, variables, initializers and nominal types).
+// Anything else fails, leaving the symbol mangled.
+type swift struct {
+	demangler
+	params bool
+	stack  []*swiftNode
+	subs   []*swiftNode
+	words  []string
+}
+
+func demangleSwift(s string, params bool) string {
+	d := &swift{demangler: demangler{s: s}, params: params}
+	if !d.consume("$s") && !d.consume("$S") && !d.consume("_T0") {
+		d.fail()
+	}
+	for !d.eof() {
+		d.step()
+	}
+	if len(d.stack) != 1 || d.stack[0].kind == swiftIdent {
+		d.fail()
+	}
+	return d.stack[0].text
+}
+
+func (d *swift) push(n *swiftNode) {
+	d.stack = append(d.stack, n)
+}
+
+func (d *swift) pop() *swiftNode {
+	if len(d.stack) == 0 {
+		d.fail()
+	}
+	n := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	return n
+}
+
+func (d *swift) popKind(kinds ...int) *swiftNode {
+	n := d.pop()
+	for _, k := range kinds {
+		if n.kind == k {
+			return n
+		}
+	}
+	d.fail()
+	return nil
+}
+
+func (d *swift) popType() string {
+	n := d.popKind(swiftType, swiftContext, swiftEmpty)
+	if n.kind == swiftEmpty {
+		return "()"
+	}
+	return n.text
+}
+
+// popParams pops a parameter list (a tuple or a single type) without the surrounding parens.
+func (d *swift) popParams() string {
+	p := d.popType()
+	if strings.HasPrefix(p, "(") && strings.HasSuffix(p, ")") {
+		return p[1 : len(p)-1]
+	}
+	return p
+}
+
+func isSwiftWordEnd(c, prev byte) bool {
+	return c == '_' || c == 0 || !(prev >= 'A' && prev <= 'Z') && c >= 'A' && c <= 'Z'
+}
+
+func (d *swift) addWords(s string) {
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		var c byte
+		if i < len(s) {
+			c = s[i]
+		}
+		if start >= 0 && isSwiftWordEnd(c, s[i-1]) {
+			if i-start >= 2 && len(d.words) < 26 {
+				d.words = append(d.words, s[start:i])
+			}
+			start = -1
+		}
+		if start < 0 && c != 0 && c != '_' && !isDigit(c) {
+			start = i
+		}
+	}
+}
+
+func (d *swift) identifier() string {
+	substs := d.consume("0")
+	if substs && d.peek() == '0' {
+		// punycode
+		d.fail()
+	}
+	var ident string
+	for {
+		for substs && (d.peek() >= 'a' && d.peek() <= 'z' || d.peek() >= 'A' && d.peek() <= 'Z') {
+			c := d.next()
+			var i int
+			if c >= 'a' {
+				i = int(c - 'a')
+			} else {
+				i = int(c - 'A')
+				substs = false
+			}
+			if i >= len(d.words) {
+				d.fail()
+			}
+			ident += d.words[i]
+		}
+		if d.consume("0") {
+			break
+		}
+		s := d.ident(d.number())
+		ident += s
+		d.addWords(s)
+		if !substs {
+			break
+		}
+	}
+	return ident
+}
+
+func (d *swift) substitution() {
+	if !isDigit(d.peek()) && d.peek() != '_' {
+		for {
+			count := 1
+			if isDigit(d.peek()) {
+				count = d.number()
+			}
+			c := d.next()
+			var i int
+			switch {
+			case c >= 'a' && c <= 'z':
+				i = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				i = int(c - 'A')
+			default:
+				d.fail()
+			}
+			if i >= len(d.subs) {
+				d.fail()
+			}
+			for ; count > 0; count-- {
+				d.push(d.subs[i])
+			}
+			if c >= 'A' && c <= 'Z' {
+				return
+			}
+		}
+	}
+	i := 0
+	if !d.consume("_") {
+		i = d.number() + 1
+		d.expect('_')
+	}
+	i += 26
+	if i >= len(d.subs) {
+		d.fail()
+	}
+	d.push(d.subs[i])
+}
+
+// context returns the qualified name of a context node (a module identifier or a nominal type).
+func (d *swift) context() string {
+	return d.popKind(swiftIdent, swiftContext).text
+}
+
+// entity pops the name, argument labels and context of a function, variable or initializer.
+func (d *swift) entity(nparams int) (string, []string) {
+	var idents []string
+	for len(d.stack) > 0 && d.stack[len(d.stack)-1].kind == swiftIdent {
+		idents = append([]string{d.pop().text}, idents...)
+	}
+	if len(d.stack) > 0 && d.stack[len(d.stack)-1].kind == swiftContext {
+		idents = append([]string{d.pop().text}, idents...)
+	}
+	if len(idents) < 2 {
+		d.fail()
+	}
+	labels := idents[2:]
+	if len(labels) != nparams {
+		labels = nil
+	}
+	return idents[0] + "." + idents[1], labels
+}
+
+func (d *swift) signature(params string, labels []string, result string) string {
+	if !d.params {
+		return ""
+	}
+	if len(labels) > 0 {
+		types := strings.Split(params, ", ")
+		for i := range types {
+			types[i] = labels[i] + ": " + types[i]
+		}
+		params = strings.Join(types, ", ")
+	}
+	return "(" + params + ") -> " + result
+}
+
+func countParams(params string) int {
+	if params == "" {
+		return 0
+	}
+	return strings.Count(params, ", ") + 1
+}
+
+func (d *swift) step() {
+	c := d.peek()
+	if isDigit(c) {
+		n := &swiftNode{kind: swiftIdent, text: d.identifier()}
+		d.subs = append(d.subs, n)
+		d.push(n)
+		return
+	}
+	d.pos++
+	switch c {
+	case 'S':
+		c2 := d.next()
+		count := 1
+		if isDigit(c2) {
+			d.pos--
+			count = d.number()
+			c2 = d.next()
+		}
+		var n *swiftNode
+		switch {
+		case c2 == 'o':
+			n = &swiftNode{kind: swiftIdent, text: "__C"}
+		case c2 == 'g':
+			n = &swiftNode{kind: swiftType, text: d.popType() + "?"}
+		default:
+			name, ok := swiftStdTypes[c2]
+			if !ok {
+				d.fail()
+			}
+			n = &swiftNode{kind: swiftContext, text: "Swift." + name}
+		}
+		for ; count > 0; count-- {
+			d.push(n)
+		}
+	case 'A':
+		d.substitution()
+	case 'C', 'V', 'O', 'P':
+		name := d.popKind(swiftIdent).text
+		n := &swiftNode{kind: swiftContext, text: d.context() + "." + name}
+		d.subs = append(d.subs, n)
+		d.push(n)
+	case 'y':
+		d.push(&swiftNode{kind: swiftEmpty})
+	case '_':
+		if len(d.stack) == 0 {
+			d.fail()
+		}
+		top := *d.stack[len(d.stack)-1]
+		top.first = true
+		d.stack[len(d.stack)-1] = &top
+	case 't':
+		var elems []string
+		for {
+			n := d.pop()
+			if n.kind == swiftEmpty {
+				break
+			}
+			if n.kind != swiftType && n.kind != swiftContext {
+				d.fail()
+			}
+			elems = append([]string{n.text}, elems...)
+			if n.first {
+				break
+			}
+		}
+		d.push(&swiftNode{kind: swiftType, text: "(" + strings.Join(elems, ", ") + ")"})
+	case 'c':
+		params := d.popParams()
+		result := d.popType()
+		d.push(&swiftNode{kind: swiftType, text: "(" + params + ") -> " + result})
+	case 'F':
+		params := d.popParams()
+		result := d.popType()
+		name, labels := d.entity(countParams(params))
+		d.push(&swiftNode{kind: swiftEntity, text: name + d.signature(params, labels, result)})
+	case 'v':
+		t := d.popType()
+		name, _ := d.entity(0)
+		if d.params {
+			name += " : " + t
+		}
+		d.push(&swiftNode{kind: swiftEntity, text: name})
+	case 'f':
+		kind := d.next()
+		switch kind {
+		case 'C', 'c':
+			fn := d.popKind(swiftType).text
+			ctx := d.context()
+			var sig string
+			if d.params {
+				sig = fn
+			}
+			d.push(&swiftNode{kind: swiftEntity, text: ctx + ".init" + sig})
+		case 'D', 'd':
+			d.push(&swiftNode{kind: swiftEntity, text: d.context() + ".deinit"})
+		default:
+			d.fail()
+		}
+	default:
+		d.fail()
+	}
+}
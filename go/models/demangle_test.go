@@ -0,0 +1,82 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+var demangleTests = []struct {
+	mangled, params, name string
+}{
+	{"_Z3fooi", "foo(int)", "foo"},
+	{"__Z3fooi", "foo(int)", "foo"},
+	{"_ZN3foo3barEv", "foo::bar()", "foo::bar"},
+	{"_ZNK3Foo3getEv", "Foo::get() const", "Foo::get"},
+	{"_ZSt4swapIiEvRT_S1_", "void std::swap<int>(int&, int&)", "std::swap<int>"},
+	{"_ZN9__gnu_cxx13new_allocatorIcE8allocateEmPKv", "__gnu_cxx::new_allocator<char>::allocate(unsigned long, void const*)", "__gnu_cxx::new_allocator<char>::allocate"},
+	{"_ZNSt6vectorIiSaIiEE9push_backERKi", "std::vector<int, std::allocator<int> >::push_back(int const&)", "std::vector<int, std::allocator<int> >::push_back"},
+	{"_ZNSt3__16vectorIiNS_9allocatorIiEEE9push_backEOi", "std::__1::vector<int, std::__1::allocator<int> >::push_back(int&&)", "std::__1::vector<int, std::__1::allocator<int> >::push_back"},
+	{"_ZN3FooC2Ev", "Foo::Foo()", "Foo::Foo"},
+	{"_ZN3FooD0Ev", "Foo::~Foo()", "Foo::~Foo"},
+	{"_ZN3FooC1ERKS_", "Foo::Foo(Foo const&)", "Foo::Foo"},
+	{"_ZTV3Foo", "vtable for Foo", "vtable for Foo"},
+	{"_ZTI3Foo", "typeinfo for Foo", "typeinfo for Foo"},
+	{"_ZZ4mainE1x", "main::x", "main::x"},
+	{"_ZGVZ4mainE1x", "guard variable for main::x", "guard variable for main::x"},
+	{"_Z1fPFviE", "f(void (*)(int))", "f"},
+	{"_Z1fM3FooFivE", "f(int (Foo::*)())", "f"},
+	{"_Z1fA10_i", "f(int [10])", "f"},
+	{"_Z1fPKc", "f(char const*)", "f"},
+	{"_ZN12_GLOBAL__N_13fooEv", "(anonymous namespace)::foo()", "(anonymous namespace)::foo"},
+	{"_Z3fooILi5EEvv", "void foo<5>()", "foo<5>"},
+	{"_ZN3FoolsERKS_", "Foo::operator<<(Foo const&)", "Foo::operator<<"},
+	{"_ZNKSt8functionIFvvEEclEv", "std::function<void ()>::operator()() const", "std::function<void ()>::operator()"},
+	{"_Z3foov.cold", "foo() [clone .cold]", "foo [clone .cold]"},
+	{"_ZThn8_N3Foo3barEv", "non-virtual thunk to Foo::bar()", "non-virtual thunk to Foo::bar"},
+	{"_Z1fIJidEEvDpT_", "void f<int, double>(int, double)", "f<int, double>"},
+	{"_ZN5Outer5InnerIiE3getIlEET_v", "long Outer::Inner<int>::get<long>()", "Outer::Inner<int>::get<long>"},
+	{"_ZL3barv", "bar()", "bar"},
+	{"_ZNSt8ios_base4InitC1Ev", "std::ios_base::Init::Init()", "std::ios_base::Init::Init"},
+	// Rust
+	{"_ZN4core3fmt9Formatter3pad17h2b2bd4d3fc3a4d6cE", "core::fmt::Formatter::pad", "core::fmt::Formatter::pad"},
+	{"_ZN66_$LT$alloc..vec..Vec$LT$T$GT$$u20$as$u20$core..ops..drop..Drop$GT$4drop17h0123456789abcdefE", "<alloc::vec::Vec<T> as core::ops::drop::Drop>::drop", "<alloc::vec::Vec<T> as core::ops::drop::Drop>::drop"},
+	{"_RNvCs1234_7mycrate3foo", "mycrate::foo", "mycrate::foo"},
+	{"_RNvNtCs1234_7mycrate3bar3baz", "mycrate::bar::baz", "mycrate::bar::baz"},
+	{"_RINvCs1234_7mycrate3foomNtB2_3BarE", "mycrate::foo::<u32, mycrate::Bar>", "mycrate::foo::<u32, mycrate::Bar>"},
+	{"_RNCNvCs1234_7mycrate4main0", "mycrate::main::{closure#0}", "mycrate::main::{closure#0}"},
+	{"_RNvMCs1234_7mycrateNtB2_3Foo3new", "<mycrate::Foo>::new", "<mycrate::Foo>::new"},
+	// backref into the enclosing path
+	{"_RINvB0_1fE", "_RINvB0_1fE", "_RINvB0_1fE"},
+	// Swift
+	{"$s4main3fooyyF", "main.foo() -> ()", "main.foo"},
+	{"$s4main3FooV3baryyF", "main.Foo.bar() -> ()", "main.Foo.bar"},
+	{"$s4main3add1a1bS2i_SitF", "main.add(a: Swift.Int, b: Swift.Int) -> Swift.Int", "main.add"},
+	{"$s4main3FooVACycfC", "main.Foo.init() -> main.Foo", "main.Foo.init"},
+	// not mangled, or not supported
+	{"main", "main", "main"},
+	{"_Z", "_Z", "_Z"},
+	{"_ZN3foo", "_ZN3foo", "_ZN3foo"},
+	{"$s4main3FooVMn", "$s4main3FooVMn", "$s4main3FooVMn"},
+}
+
+func TestDemangle(t *testing.T) {
+	for _, test := range demangleTests {
+		if got := DemangleParams(test.mangled); got != test.params {
+			t.Errorf("DemangleParams(%s) = %q, want %q", test.mangled, got, test.params)
+		}
+		if got := Demangle(test.mangled); got != test.name {
+			t.Errorf("Demangle(%s) = %q, want %q", test.mangled, got, test.name)
+		}
+	}
+}
+
+func TestDemangleDepth(t *testing.T) {
+	deep := "_Z1f" + strings.Repeat("P", 2*demangleMaxDepth) + "i"
+	if got := DemangleParams(deep); got != deep {
+		t.Errorf("nesting past the depth limit was demangled: %.40q", got)
+	}
+	ok := "_Z1f" + strings.Repeat("P", 10) + "i"
+	if got := DemangleParams(ok); got != "f(int"+strings.Repeat("*", 10)+")" {
+		t.Errorf("DemangleParams(%s) = %q", ok, got)
+	}
+}
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bnagy/gapstone"
+)
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Addr     uint64
+	Bytes    []byte
+	Mnemonic string
+	OpStr    string
+	// OpStr split into operands
+	Operands []string
+	Call     bool
+	Jump     bool
+	Return   bool
+	// static destinations of a call or jump (indirect targets aren't known)
+	Targets []uint64
+}
+
+func (i *Instruction) String() string {
+	return fmt.Sprintf("0x%x: %s %s", i.Addr, i.Mnemonic, i.OpStr)
+}
+
+// splitOperands splits an operand string on commas outside of brackets.
+func splitOperands(s string) []string {
+	var ops []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				ops = append(ops, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if s = strings.TrimSpace(s[start:]); s != "" {
+		ops = append(ops, s)
+	}
+	return ops
+}
+
+// immediates returns the immediate operands from the arch-specific detail.
+func immediates(insn *gapstone.Instruction) []uint64 {
+	var imms []uint64
+	switch {
+	case insn.X86 != nil:
+		for _, op := range insn.X86.Operands {
+			if op.Type == gapstone.X86_OP_IMM {
+				imms = append(imms, uint64(op.Imm))
+			}
+		}
+	case insn.Arm != nil:
+		for _, op := range insn.Arm.Operands {
+			if op.Type == gapstone.ARM_OP_IMM {
+				imms = append(imms, uint64(uint32(op.Imm)))
+			}
+		}
+	case insn.Arm64 != nil:
+		for _, op := range insn.Arm64.Operands {
+			if op.Type == gapstone.ARM64_OP_IMM {
+				imms = append(imms, uint64(op.Imm))
+			}
+		}
+	case insn.Mips != nil:
+		for _, op := range insn.Mips.Operands {
+			if op.Type == gapstone.MIPS_OP_IMM {
+				imms = append(imms, uint64(op.Imm))
+			}
+		}
+	}
+	return imms
+}
+
+func newInstruction(insn *gapstone.Instruction) *Instruction {
+	i := &Instruction{
+		Addr:     uint64(insn.Address),
+		Bytes:    insn.Bytes,
+		Mnemonic: insn.Mnemonic,
+		OpStr:    insn.OpStr,
+		Operands: splitOperands(insn.OpStr),
+	}
+	for _, g := range insn.Groups {
+		switch g {
+		case gapstone.CS_GRP_CALL:
+			i.Call = true
+		case gapstone.CS_GRP_JUMP:
+			i.Jump = true
+		case gapstone.CS_GRP_RET:
+			i.Return = true
+		}
+	}
+	if i.Call || i.Jump {
+		i.Targets = immediates(insn)
+	}
+	return i
+}
+
+type disasKey struct {
+	addr uint64
+	mode uint
+	mem  string
+}
+
+type disasEntry struct {
+	key   disasKey
+	insns []*Instruction
+}
+
+// Disassembler decodes instructions for one arch, keeping an engine per mode and an LRU cache of results.
+// It is safe for concurrent use.
+type Disassembler struct {
+	mu      sync.Mutex
+	arch    *Arch
+	engines map[uint]*gapstone.Engine
+	size    int
+	lru     *list.List
+	cache   map[disasKey]*list.Element
+}
+
+// NewDisassembler creates a Disassembler caching up to size results.
+func NewDisassembler(arch *Arch, size int) *Disassembler {
+	return &Disassembler{
+		arch:    arch,
+		engines: make(map[uint]*gapstone.Engine),
+		size:    size,
+		lru:     list.New(),
+		cache:   make(map[disasKey]*list.Element),
+	}
+}
+
+func (d *Disassembler) engine(mode uint) (*gapstone.Engine, error) {
+	if e, ok := d.engines[mode]; ok {
+		return e, nil
+	}
+	e, err := gapstone.New(d.arch.CS_ARCH, mode)
+	if err != nil {
+		return nil, err
+	}
+	// detail is needed for instruction groups and branch targets
+	if err := e.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+		e.Close()
+		return nil, err
+	}
+	d.engines[mode] = &e
+	return &e, nil
+}
+
+// Disas decodes mem as code at addr in the arch's default mode.
+func (d *Disassembler) Disas(mem []byte, addr uint64) ([]*Instruction, error) {
+	return d.DisasMode(mem, addr, d.arch.CS_MODE)
+}
+
+// DisasMode decodes mem as code at addr using a specific capstone mode (such as CS_MODE_THUMB).
+// The returned instructions are shared with the cache and must not be modified.
+func (d *Disassembler) DisasMode(mem []byte, addr uint64, mode uint) ([]*Instruction, error) {
+	if len(mem) == 0 {
+		return nil, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := disasKey{addr, mode, string(mem)}
+	if el, ok := d.cache[key]; ok {
+		d.lru.MoveToFront(el)
+		return el.Value.(*disasEntry).insns, nil
+	}
+	engine, err := d.engine(mode)
+	if err != nil {
+		return nil, err
+	}
+	asm, err := engine.Disasm(mem, addr, 0)
+	if err != nil {
+		return nil, err
+	}
+	insns := make([]*Instruction, len(asm))
+	for i := range asm {
+		insns[i] = newInstruction(&asm[i])
+	}
+	d.cache[key] = d.lru.PushFront(&disasEntry{key, insns})
+	for d.size > 0 && d.lru.Len() > d.size {
+		el := d.lru.Back()
+		d.lru.Remove(el)
+		delete(d.cache, el.Value.(*disasEntry).key)
+	}
+	return insns, nil
+}
+
+// Decode decodes one instruction at addr in a capstone mode with full capstone detail.
+// Unlike Disas, the result isn't cached.
+func (d *Disassembler) Decode(mem []byte, addr uint64, mode uint) (*gapstone.Instruction, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	engine, err := d.engine(mode)
+	if err != nil {
+		return nil, err
+	}
+	asm, err := engine.Disasm(mem, addr, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(asm) == 0 {
+		return nil, fmt.Errorf("no instruction at 0x%x", addr)
+	}
+	return &asm[0], nil
+}
+
+// RegName returns capstone's name for a register, or "" if the engine can't be created.
+func (d *Disassembler) RegName(reg uint) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	engine, err := d.engine(d.arch.CS_MODE)
+	if err != nil {
+		return ""
+	}
+	return engine.RegName(reg)
+}
+
+// Close releases the capstone engines.
+func (d *Disassembler) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for mode, e := range d.engines {
+		e.Close()
+		delete(d.engines, mode)
+	}
+	d.lru.Init()
+	d.cache = make(map[disasKey]*list.Element)
+}
+
+// FormatDisas formats instructions one per line as "addr: bytes mnemonic operands",
+// padding the hex bytes to at least pad bytes wide.
+func FormatDisas(insns []*Instruction, pad int) string {
+	width := pad
+	for _, insn := range insns {
+		if len(insn.Bytes) > width {
+			width = len(insn.Bytes)
+		}
+	}
+	out := make([]string, len(insns))
+	for i, insn := range insns {
+		data := strings.Repeat(" ", (width-len(insn.Bytes))*2) + hex.EncodeToString(insn.Bytes)
+		out[i] = fmt.Sprintf("0x%x: %s %s %s", insn.Addr, data, insn.Mnemonic, insn.OpStr)
+	}
+	return strings.Join(out, "\n")
+}
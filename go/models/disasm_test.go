@@ -0,0 +1,76 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bnagy/gapstone"
+)
+
+func TestSplitOperands(t *testing.T) {
+	tests := map[string][]string{
+		"":                     nil,
+		"lr":                   {"lr"},
+		"rax, qword ptr [rbx]": {"rax", "qword ptr [rbx]"},
+		"{r4, r5, pc}":         {"{r4, r5, pc}"},
+		"pc, [sp], #4":         {"pc", "[sp]", "#4"},
+		"x0, [x1, #8]!":        {"x0", "[x1, #8]!"},
+		"$t9, 8($sp)":          {"$t9", "8($sp)"},
+	}
+	for op, want := range tests {
+		if got := splitOperands(op); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitOperands(%q) = %q, want %q", op, got, want)
+		}
+	}
+}
+
+func TestDisasCache(t *testing.T) {
+	d := NewDisassembler(&Arch{CS_ARCH: gapstone.CS_ARCH_X86, CS_MODE: gapstone.CS_MODE_64}, 2)
+	defer d.Close()
+	code := []byte{0xe8, 0, 0, 0, 0} // call $+5
+	for _, addr := range []uint64{0x1000, 0x2000, 0x1000, 0x3000} {
+		if _, err := d.Disas(code, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.lru.Len() != 2 {
+		t.Fatalf("cache has %d entries, want 2", d.lru.Len())
+	}
+	if _, ok := d.cache[disasKey{0x2000, gapstone.CS_MODE_64, string(code)}]; ok {
+		t.Error("least recently used entry wasn't evicted")
+	}
+	if _, ok := d.cache[disasKey{0x1000, gapstone.CS_MODE_64, string(code)}]; !ok {
+		t.Error("recently used entry was evicted")
+	}
+}
+
+func TestDisasClose(t *testing.T) {
+	d := NewDisassembler(&Arch{CS_ARCH: gapstone.CS_ARCH_X86, CS_MODE: gapstone.CS_MODE_64}, 2)
+	code := []byte{0x48, 0x31, 0xc0} // xor rax, rax
+	insn, err := d.Decode(code, 0x1000, gapstone.CS_MODE_64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if insn.X86 == nil || len(insn.X86.Operands) != 2 || d.RegName(insn.X86.Operands[0].Reg) != "rax" {
+		t.Errorf("decoded without detail: %+v", insn)
+	}
+	d.Close()
+	if len(d.engines) != 0 || d.lru.Len() != 0 {
+		t.Error("Close didn't release the engines and cache")
+	}
+	if _, err := d.Disas(code, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+}
+
+func TestFormatDisas(t *testing.T) {
+	insns := []*Instruction{
+		{Addr: 0x1000, Bytes: []byte{0x90}, Mnemonic: "nop"},
+		{Addr: 0x1001, Bytes: []byte{0x48, 0x89, 0xe5}, Mnemonic: "mov", OpStr: "rbp, rsp"},
+	}
+	want := "0x1000:     90 nop \n0x1001: 4889e5 mov rbp, rsp"
+	if got := FormatDisas(insns, 2); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GdbReg is a register as exposed to the GDB remote protocol.
+// Enum is a Unicorn register constant, or -1 if Unicorn can't access it (reads as zero, writes are ignored).
+type GdbReg struct {
+	Name string
+	Enum int
+	Bits int
+	Type string
+}
+
+type GdbFeature struct {
+	Name string
+	Regs []GdbReg
+}
+
+// GdbTarget describes an arch's registers in the order GDB expects them in `g` packets.
+type GdbTarget struct {
+	Arch     string
+	Features []GdbFeature
+}
+
+func (g *GdbTarget) Regs() []GdbReg {
+	var regs []GdbReg
+	for _, f := range g.Features {
+		regs = append(regs, f.Regs...)
+	}
+	return regs
+}
+
+func (g *GdbTarget) Xml() string {
+	out := []string{
+		`<?xml version="1.0"?>`,
+		`<!DOCTYPE target SYSTEM "gdb-target.dtd">`,
+		`<target version="1.0">`,
+		fmt.Sprintf("<architecture>%s</architecture>", g.Arch),
+	}
+	regnum := 0
+	for _, f := range g.Features {
+		out = append(out, fmt.Sprintf(`<feature name="%s">`, f.Name))
+		for _, r := range f.Regs {
+			typ := r.Type
+			if typ == "" {
+				typ = fmt.Sprintf("int%d", r.Bits)
+			}
+			out = append(out, fmt.Sprintf(`  <reg name="%s" bitsize="%d" type="%s" regnum="%d"/>`, r.Name, r.Bits, typ, regnum))
+			regnum++
+		}
+		out = append(out, "</feature>")
+	}
+	out = append(out, "</target>")
+	return strings.Join(out, "\n")
+}
+
+// GdbNumbered returns a list of registers named with a common prefix, e.g. r0-r31.
+func GdbNumbered(prefix string, enums []int, bits int, typ string) []GdbReg {
+	ret := make([]GdbReg, len(enums))
+	for i, enum := range enums {
+		ret[i] = GdbReg{fmt.Sprintf("%s%d", prefix, i), enum, bits, typ}
+	}
+	return ret
+}
+
+// GdbUnsupported returns n registers Unicorn doesn't expose, named with a common prefix.
+func GdbUnsupported(prefix string, n, bits int, typ string) []GdbReg {
+	enums := make([]int, n)
+	for i := range enums {
+		enums[i] = -1
+	}
+	return GdbNumbered(prefix, enums, bits, typ)
+}
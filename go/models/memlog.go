@@ -3,7 +3,7 @@ package models
 import (
 	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
 )
 
 type memDelta struct {
@@ -19,6 +19,8 @@ type MemLog struct {
 	log   []*memDelta
 	read  *memDelta
 	write *memDelta
+	// optional, marks tainted memory in Print
+	Tainted func(addr, size uint64) bool
 }
 
 func NewMemLog(order binary.ByteOrder) *MemLog {
@@ -102,17 +104,21 @@ func (m *MemLog) Update(addr uint64, size int, value int64, write bool) {
 	delta.value = value
 }
 
-func (m *MemLog) Print(indent string, bits int) {
+func (m *MemLog) Print(w io.Writer, indent string, bits int) {
 	for _, d := range m.log {
 		t := "R"
 		if d.write {
 			t = "W"
 		}
+		taint := ""
+		if m.Tainted != nil && m.Tainted(d.addr, uint64(len(d.data))) {
+			taint = " tainted"
+		}
 		for i, line := range HexDump(d.addr, d.data, bits) {
 			if i == 0 {
-				fmt.Fprintf(os.Stderr, "%s%s%c%s %s%c\n", indent, t, d.tag, line, t, d.tag)
+				fmt.Fprintf(w, "%s%s%c%s %s%c%s\n", indent, t, d.tag, line, t, d.tag, taint)
 			} else {
-				fmt.Fprintf(os.Stderr, "%s  %s\n", indent, line)
+				fmt.Fprintf(w, "%s  %s\n", indent, line)
 			}
 		}
 	}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Mmap describes a region of guest memory.
+type Mmap struct {
+	Addr, Size uint64
+	Prot       int
+	// guest mmap flags, if the guest mapped it
+	Flags int
+	// what the region is for: "exe", "interp", "stack", "brk", "anon" or "file"
+	Desc string
+	// backing file and offset of Addr into it
+	File string
+	Off  uint64
+}
+
+func (m *Mmap) End() uint64 {
+	return m.Addr + m.Size
+}
+
+func (m *Mmap) Contains(addr uint64) bool {
+	return addr >= m.Addr && addr < m.End()
+}
+
+func (m *Mmap) Overlaps(addr, size uint64) bool {
+	return addr < m.End() && addr+size > m.Addr
+}
+
+func (m *Mmap) String() string {
+	prot := []byte("---")
+	for i, c := range "rwx" {
+		if m.Prot&(1<<uint(i)) != 0 {
+			prot[i] = byte(c)
+		}
+	}
+	s := fmt.Sprintf("0x%x-0x%x %s %s", m.Addr, m.End(), prot, m.Desc)
+	if m.File != "" {
+		s += fmt.Sprintf(" %s+0x%x", m.File, m.Off)
+	}
+	return s
+}
@@ -5,24 +5,40 @@ import (
 	"github.com/lunixbochs/ghostrace/ghost/memio"
 	"github.com/lunixbochs/usercorn/go/models"
 	"github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+	"io"
+	"io/ioutil"
 )
 
 type Usercorn struct {
 	unicorn.Unicorn
 }
 
-func (u *Usercorn) Arch() *models.Arch                      { return nil }
-func (u *Usercorn) OS() string                              { return "" }
-func (u *Usercorn) Bits() uint                              { return 0 }
-func (u *Usercorn) ByteOrder() binary.ByteOrder             { return binary.BigEndian }
-func (u *Usercorn) Disas(addr, size uint64) (string, error) { return "", nil }
-func (u *Usercorn) Symbolicate(addr uint64) (string, error) { return "", nil }
-
-func (u *Usercorn) Brk(addr uint64) (uint64, error)                 { return 0, nil }
-func (u *Usercorn) Mmap(addr, size uint64) (uint64, error)          { return 0, nil }
-func (u *Usercorn) MmapWrite(addr uint64, p []byte) (uint64, error) { return 0, nil }
-func (u *Usercorn) Mem() memio.MemIO                                { return nil }
-func (u *Usercorn) StrucAt(addr uint64) *models.StrucStream         { return nil }
+func (u *Usercorn) Arch() *models.Arch                        { return nil }
+func (u *Usercorn) OS() string                                { return "" }
+func (u *Usercorn) Bits() uint                                { return 0 }
+func (u *Usercorn) ByteOrder() binary.ByteOrder               { return binary.BigEndian }
+func (u *Usercorn) Disas(addr, size uint64) (string, error)   { return "", nil }
+func (u *Usercorn) Symbolicate(addr uint64) (string, error)   { return "", nil }
+func (u *Usercorn) SourceLine(addr uint64) string             { return "" }
+func (u *Usercorn) ResolveSymbol(name string) (uint64, error) { return 0, nil }
+func (u *Usercorn) Stacktrace() *models.Stacktrace            { return nil }
+func (u *Usercorn) TraceOutput() io.Writer                    { return ioutil.Discard }
+func (u *Usercorn) Stdio() (io.Reader, io.Writer, io.Writer)  { return nil, nil, nil }
+
+func (u *Usercorn) Instructions(addr, size uint64) ([]*models.Instruction, error) { return nil, nil }
+func (u *Usercorn) Threads() models.Threads                                       { return nil }
+func (u *Usercorn) Processes() models.Processes                                   { return nil }
+
+func (u *Usercorn) Brk(addr uint64) (uint64, error)                      { return 0, nil }
+func (u *Usercorn) Mmap(addr, size uint64) (uint64, error)               { return 0, nil }
+func (u *Usercorn) MmapWrite(addr uint64, p []byte) (uint64, error)      { return 0, nil }
+func (u *Usercorn) MmapRegion(m models.Mmap, fixed bool) (uint64, error) { return 0, nil }
+func (u *Usercorn) Mremap(addr, oldSize, newSize uint64, mayMove bool) (uint64, error) {
+	return 0, nil
+}
+func (u *Usercorn) Mappings() []models.Mmap                 { return nil }
+func (u *Usercorn) Mem() memio.MemIO                        { return nil }
+func (u *Usercorn) StrucAt(addr uint64) *models.StrucStream { return nil }
 
 func (u *Usercorn) PackAddr(buf []byte, n uint64) ([]byte, error) { return nil, nil }
 func (u *Usercorn) UnpackAddr(buf []byte) uint64                  { return 0 }
@@ -0,0 +1,21 @@
+package models
+
+// Processes runs forked guest processes, each on its own emulator inside the host process.
+type Processes interface {
+	// Pid and Ppid return the guest ids of the running process and its parent.
+	Pid() int
+	Ppid() int
+	// Fork creates a child process which starts as a copy of this one as of the end of the current
+	// syscall, with a syscall return value of 0 and sp (if nonzero) as its stack pointer. If setTid is
+	// nonzero, the child's pid is written there in the child's memory. With vfork, the caller is
+	// suspended until the child execs or exits.
+	Fork(vfork bool, sp, setTid uint64) (int, error)
+	// Wait reaps an exited child (any child if pid is -1), returning its pid and wait(2) status.
+	// With nohang, it returns pid 0 instead of blocking.
+	Wait(pid int, nohang bool) (int, int, error)
+	// Exec replaces a forked process with a new emulated program. It returns false for the
+	// original process, whose exec is left to the host.
+	Exec(path string, argv, envp []string) (bool, error)
+	// Kill delivers sig to a forked process. It returns false if pid isn't one.
+	Kill(pid, sig int) (bool, error)
+}
@@ -2,12 +2,14 @@ package models
 
 import (
 	"fmt"
-	"os"
+	"io"
 )
 
 type stackFrame struct {
 	PC, SP uint64
 	Sym    string
+	// return address, if the frame was entered by Call
+	Ret uint64
 }
 
 type Stacktrace struct {
@@ -18,19 +20,34 @@ func (s *Stacktrace) Len() int {
 	return len(s.Stack)
 }
 
-func (s *Stacktrace) Print(u Usercorn) {
+func (s *Stacktrace) Print(w io.Writer, u Usercorn) {
 	pc, _ := u.RegRead(u.Arch().PC)
 	sp, _ := u.RegRead(u.Arch().SP)
 	sym, _ := u.Symbolicate(pc)
-	stack := append(s.Stack, stackFrame{pc, sp, sym})
+	stack := append(s.Stack, stackFrame{pc, sp, sym, 0})
 	for i := len(stack) - 1; i >= 0; i-- {
 		frame := stack[i]
-		fmt.Fprintf(os.Stderr, "  0x%x %s\n", frame.PC, frame.Sym)
+		// show where each function is, rather than where it starts
+		loc := frame.PC
+		if i == len(stack)-2 {
+			loc = pc
+		} else if i < len(stack)-1 && stack[i+1].Ret != 0 {
+			loc = stack[i+1].Ret - 1
+		}
+		if src := u.SourceLine(loc); src != "" {
+			fmt.Fprintf(w, "  0x%x %s %s\n", frame.PC, frame.Sym, src)
+		} else {
+			fmt.Fprintf(w, "  0x%x %s\n", frame.PC, frame.Sym)
+		}
 	}
 }
 
+func (s *Stacktrace) Copy() Stacktrace {
+	return Stacktrace{append([]stackFrame(nil), s.Stack...)}
+}
+
 func (s *Stacktrace) Push(pc, sp uint64, sym string) {
-	s.Stack = append(s.Stack, stackFrame{pc, sp, sym})
+	s.Stack = append(s.Stack, stackFrame{pc, sp, sym, 0})
 }
 
 func (s *Stacktrace) Empty() bool {
@@ -62,3 +79,20 @@ func (s *Stacktrace) Update(pc, sp uint64, sym string) {
 		}
 	}
 }
+
+// Call pushes a frame for a call which will return to ret.
+func (s *Stacktrace) Call(pc, sp, ret uint64, sym string) {
+	s.Stack = append(s.Stack, stackFrame{pc, sp, sym, ret})
+}
+
+// Return pops frames up to and including the innermost frame returning to pc.
+// It returns false and leaves the stack alone if no frame returns to pc.
+func (s *Stacktrace) Return(pc uint64) bool {
+	for i := s.Len() - 1; i >= 0; i-- {
+		if s.Stack[i].Ret == pc {
+			s.Stack = s.Stack[:i]
+			return true
+		}
+	}
+	return false
+}
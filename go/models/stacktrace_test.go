@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestStacktraceCallReturn(t *testing.T) {
+	var s Stacktrace
+	s.Push(0x1000, 0x8000, "main")
+	s.Call(0x2000, 0x7ff8, 0x1005, "a")
+	s.Call(0x3000, 0x7ff0, 0x2010, "b")
+	s.Call(0x4000, 0x7fe8, 0x3008, "c")
+	if s.Return(0x5555) || s.Len() != 4 {
+		t.Fatal("return to an unknown address changed the stack")
+	}
+	// unwinding past c (e.g. a tail call or longjmp) pops both frames
+	if !s.Return(0x2010) || s.Len() != 2 || s.Peek().Sym != "a" {
+		t.Fatalf("bad unwind: %+v", s.Stack)
+	}
+	if !s.Return(0x1005) || s.Len() != 1 || s.Peek().Sym != "main" {
+		t.Fatalf("bad return: %+v", s.Stack)
+	}
+}
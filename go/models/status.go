@@ -2,7 +2,7 @@ package models
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 
 	"github.com/mgutz/ansi"
@@ -78,25 +78,25 @@ func (c *Change) Mask(bsz int) []ChangeMask {
 	return masks
 }
 
-func (c *Change) Print(bsz int, color bool) {
+func (c *Change) Print(w io.Writer, bsz int, color bool) {
 	hexFmt := fmt.Sprintf("%%0%dx", bsz)
 	lineStart := fmt.Sprintf(" %4s 0x", c.Name)
 	if c.Changed() {
 		if color {
-			fmt.Fprintf(os.Stderr, " %s 0x", colorPad(c.Name, chNew, 4))
+			fmt.Fprintf(w, " %s 0x", colorPad(c.Name, chNew, 4))
 			for _, mask := range c.Mask(bsz) {
 				col := chSame
 				if mask.Changed {
 					col = chNew
 				}
-				fmt.Fprintf(os.Stderr, col+mask.New)
+				fmt.Fprintf(w, col+mask.New)
 			}
-			fmt.Fprintf(os.Stderr, ansi.Reset)
+			fmt.Fprintf(w, ansi.Reset)
 		} else {
-			fmt.Fprintf(os.Stderr, "+ "+lineStart+hexFmt, c.New)
+			fmt.Fprintf(w, "+ "+lineStart+hexFmt, c.New)
 		}
 	} else {
-		fmt.Fprintf(os.Stderr, lineStart+hexFmt, c.New)
+		fmt.Fprintf(w, lineStart+hexFmt, c.New)
 	}
 }
 
@@ -105,22 +105,22 @@ type Changes struct {
 	Changes []*Change
 }
 
-func (cs *Changes) Print(indent string, color, onlyChanged bool) {
+func (cs *Changes) Print(w io.Writer, indent string, color, onlyChanged bool) {
 	var printRow = func(changes []*Change, cols int) {
 		if len(changes) > 0 {
-			fmt.Fprintf(os.Stderr, "%s", indent)
+			fmt.Fprintf(w, "%s", indent)
 		}
 		if len(changes) < cols && len(changes) > 0 {
 			padLen := cs.Bsz + len(" regn 0x ")
 			pad := strings.Repeat(" ", padLen*(cols-len(changes)))
-			fmt.Fprintf(os.Stderr, pad)
+			fmt.Fprintf(w, pad)
 		}
 		for _, c := range changes {
-			c.Print(cs.Bsz, color)
-			fmt.Fprintf(os.Stderr, " ")
+			c.Print(w, cs.Bsz, color)
+			fmt.Fprintf(w, " ")
 		}
 		if len(changes) > 0 {
-			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(w)
 		}
 	}
 	changes := cs.Changes
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"sort"
+)
+
+// SymbolTable indexes a module's symbols by address and name.
+type SymbolTable struct {
+	syms []Symbol
+	// maxEnd[i] is the highest End of syms[:i+1] (^0 for unsized symbols)
+	maxEnd []uint64
+	names  map[string]Symbol
+}
+
+func NewSymbolTable(symbols []Symbol) *SymbolTable {
+	t := &SymbolTable{names: make(map[string]Symbol)}
+	for _, sym := range symbols {
+		if sym.Start == 0 || sym.Name == "" {
+			continue
+		}
+		t.syms = append(t.syms, sym)
+		if _, ok := t.names[sym.Name]; !ok {
+			t.names[sym.Name] = sym
+		}
+	}
+	sort.SliceStable(t.syms, func(i, j int) bool { return t.syms[i].Start < t.syms[j].Start })
+	t.maxEnd = make([]uint64, len(t.syms))
+	var max uint64
+	for i, sym := range t.syms {
+		end := sym.End
+		if end == 0 {
+			end = ^uint64(0)
+		}
+		if end > max {
+			max = end
+		}
+		t.maxEnd[i] = max
+	}
+	return t
+}
+
+func (sym *Symbol) contains(addr uint64) bool {
+	return addr >= sym.Start && (sym.End == 0 || addr <= sym.End)
+}
+
+// Lookup returns the symbol with the closest start containing addr, and addr's offset into it.
+func (t *SymbolTable) Lookup(addr uint64) (Symbol, uint64, bool) {
+	i := sort.Search(len(t.syms), func(i int) bool { return t.syms[i].Start > addr }) - 1
+	for ; i >= 0 && t.maxEnd[i] >= addr; i-- {
+		if !t.syms[i].contains(addr) {
+			continue
+		}
+		// prefer the first of several symbols at the same address
+		start, first := t.syms[i].Start, i
+		for j := i - 1; j >= 0 && t.syms[j].Start == start; j-- {
+			if t.syms[j].contains(addr) {
+				first = j
+			}
+		}
+		return t.syms[first], addr - start, true
+	}
+	return Symbol{}, 0, false
+}
+
+// Find returns the symbol with this exact name.
+func (t *SymbolTable) Find(name string) (Symbol, bool) {
+	sym, ok := t.names[name]
+	return sym, ok
+}
+
+// Symbols returns the indexed symbols, sorted by address.
+func (t *SymbolTable) Symbols() []Symbol {
+	return t.syms
+}
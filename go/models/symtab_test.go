@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestSymbolTable(t *testing.T) {
+	symtab := NewSymbolTable([]Symbol{
+		{Name: "outer", Start: 0x1000, End: 0x1100},
+		{Name: "inner", Start: 0x1010, End: 0x1020},
+		{Name: "alias2", Start: 0x2000, End: 0x2010},
+		{Name: "alias1", Start: 0x2000, End: 0x2010},
+		{Name: "label", Start: 0x3000, End: 0x3000},
+		{Name: "unsized", Start: 0x4000},
+		{Name: "ignored", Start: 0},
+	})
+	tests := []struct {
+		addr uint64
+		name string
+		off  uint64
+	}{
+		{0xfff, "", 0},
+		{0x1000, "outer", 0},
+		{0x1018, "inner", 8},
+		{0x1080, "outer", 0x80},
+		{0x1100, "outer", 0x100},
+		{0x1101, "", 0},
+		{0x2004, "alias2", 4},
+		{0x3000, "label", 0},
+		{0x3001, "", 0},
+		{0x5000, "unsized", 0x1000},
+	}
+	for _, test := range tests {
+		sym, off, ok := symtab.Lookup(test.addr)
+		if ok != (test.name != "") || sym.Name != test.name || off != test.off {
+			t.Errorf("Lookup(%#x) = %s+%#x, %v; want %s+%#x", test.addr, sym.Name, off, ok, test.name, test.off)
+		}
+	}
+	if sym, ok := symtab.Find("alias1"); !ok || sym.Start != 0x2000 {
+		t.Errorf("Find(alias1) = %v, %v", sym, ok)
+	}
+	if _, ok := symtab.Find("ignored"); ok {
+		t.Error("Find(ignored) found a symbol at 0")
+	}
+}
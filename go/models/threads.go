@@ -0,0 +1,21 @@
+package models
+
+// Threads runs guest threads on one emulator. Threads only switch between syscalls and
+// instruction quanta, so a call that blocks or yields takes effect once the current syscall returns.
+type Threads interface {
+	// Tid returns the id of the running thread.
+	Tid() int
+	// Clone creates a thread which starts with the registers of the running thread as of the
+	// end of the current syscall, with sp (if nonzero) and the TLS register (if setTLS) replaced
+	// and a syscall return value of 0.
+	Clone(sp, tls uint64, setTLS bool) (int, error)
+	// Exit ends the running thread. The guest exits with status after its last thread.
+	Exit(status int)
+	// Wait blocks the running thread on the futex at addr. If timed is set, it returns false
+	// instead of blocking when no other thread could wake it.
+	Wait(addr uint64, timed bool) bool
+	// Wake wakes up to n threads waiting on addr, then moves up to requeue of the remaining waiters to addr2.
+	Wake(addr uint64, n int, addr2 uint64, requeue int) (woken, requeued int)
+	// Yield lets the next runnable thread run.
+	Yield()
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+// Trace event types. These are also the type bytes used by the binary encoding.
+const (
+	TraceBlock = iota + 1
+	TraceInsn
+	TraceReg
+	TraceMem
+	TraceSyscall
+	TraceLoop
+	TraceThread
+)
+
+var traceNames = map[int]string{
+	TraceBlock:   "block",
+	TraceInsn:    "insn",
+	TraceReg:     "reg",
+	TraceMem:     "mem",
+	TraceSyscall: "syscall",
+	TraceLoop:    "loop",
+	TraceThread:  "thread",
+}
+
+type TraceEvent interface {
+	Type() int
+	// appends the binary encoding of the event body to buf
+	appendBinary(buf []byte) []byte
+}
+
+type BlockEvent struct {
+	Addr  uint64
+	Size  uint32
+	Sym   string `json:",omitempty"`
+	Depth int
+}
+
+type InsnEvent struct {
+	Addr uint64
+	Size uint32
+	Dis  string
+}
+
+type RegDelta struct {
+	Name string
+	Val  uint64
+}
+
+type RegEvent struct {
+	Addr uint64
+	Regs []RegDelta
+}
+
+type MemEvent struct {
+	Write bool
+	Addr  uint64
+	Size  int
+	Value uint64
+}
+
+type SyscallEvent struct {
+	Num  int
+	Name string
+	Args []uint64
+	// decoded arguments, as in -strace output
+	Desc []string
+	Ret  uint64
+}
+
+type LoopEvent struct {
+	Count int
+	Addrs []uint64
+}
+
+// ThreadEvent marks a switch to another guest thread. The events after it belong to that thread.
+type ThreadEvent struct {
+	Tid int
+}
+
+func (e *BlockEvent) Type() int   { return TraceBlock }
+func (e *InsnEvent) Type() int    { return TraceInsn }
+func (e *RegEvent) Type() int     { return TraceReg }
+func (e *MemEvent) Type() int     { return TraceMem }
+func (e *SyscallEvent) Type() int { return TraceSyscall }
+func (e *LoopEvent) Type() int    { return TraceLoop }
+func (e *ThreadEvent) Type() int  { return TraceThread }
+
+// NewRegEvent collects the changed registers from cs.
+func NewRegEvent(addr uint64, cs *Changes) *RegEvent {
+	e := &RegEvent{Addr: addr}
+	for _, c := range cs.Changed() {
+		e.Regs = append(e.Regs, RegDelta{c.Name, c.New})
+	}
+	return e
+}
+
+func appendUvarint(buf []byte, n uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], n)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func (e *BlockEvent) appendBinary(buf []byte) []byte {
+	buf = appendUvarint(buf, e.Addr)
+	buf = appendUvarint(buf, uint64(e.Size))
+	buf = appendString(buf, e.Sym)
+	return appendUvarint(buf, uint64(e.Depth))
+}
+
+func (e *InsnEvent) appendBinary(buf []byte) []byte {
+	buf = appendUvarint(buf, e.Addr)
+	buf = appendUvarint(buf, uint64(e.Size))
+	return appendString(buf, e.Dis)
+}
+
+func (e *RegEvent) appendBinary(buf []byte) []byte {
+	buf = appendUvarint(buf, e.Addr)
+	buf = appendUvarint(buf, uint64(len(e.Regs)))
+	for _, r := range e.Regs {
+		buf = appendString(buf, r.Name)
+		buf = appendUvarint(buf, r.Val)
+	}
+	return buf
+}
+
+func (e *MemEvent) appendBinary(buf []byte) []byte {
+	var write byte
+	if e.Write {
+		write = 1
+	}
+	buf = append(buf, write)
+	buf = appendUvarint(buf, e.Addr)
+	buf = appendUvarint(buf, uint64(e.Size))
+	return appendUvarint(buf, e.Value)
+}
+
+func (e *SyscallEvent) appendBinary(buf []byte) []byte {
+	buf = appendUvarint(buf, uint64(e.Num))
+	buf = appendString(buf, e.Name)
+	buf = appendUvarint(buf, uint64(len(e.Args)))
+	for _, a := range e.Args {
+		buf = appendUvarint(buf, a)
+	}
+	buf = appendUvarint(buf, uint64(len(e.Desc)))
+	for _, d := range e.Desc {
+		buf = appendString(buf, d)
+	}
+	return appendUvarint(buf, e.Ret)
+}
+
+func (e *LoopEvent) appendBinary(buf []byte) []byte {
+	buf = appendUvarint(buf, uint64(e.Count))
+	buf = appendUvarint(buf, uint64(len(e.Addrs)))
+	for _, a := range e.Addrs {
+		buf = appendUvarint(buf, a)
+	}
+	return buf
+}
+
+func (e *ThreadEvent) appendBinary(buf []byte) []byte {
+	return appendUvarint(buf, uint64(e.Tid))
+}
+
+// TraceWriter emits structured trace events.
+type TraceWriter interface {
+	Emit(e TraceEvent) error
+}
+
+type jsonTrace struct {
+	w io.Writer
+}
+
+// NewJsonTrace writes one JSON object per line, with a "type" key naming the event.
+func NewJsonTrace(w io.Writer) TraceWriter {
+	return &jsonTrace{w}
+}
+
+func (j *jsonTrace) Emit(e TraceEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"` + traceNames[e.Type()] + `"`)
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+	buf.WriteByte('\n')
+	_, err = j.w.Write(buf.Bytes())
+	return err
+}
+
+type binaryTrace struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewBinaryTrace writes events as a type byte, a uvarint body length and the body.
+// Integers in the body are uvarints, strings are a uvarint length followed by the bytes
+// and lists are a uvarint count followed by the items, in struct field order.
+func NewBinaryTrace(w io.Writer) TraceWriter {
+	return &binaryTrace{w: w}
+}
+
+func (b *binaryTrace) Emit(e TraceEvent) error {
+	body := e.appendBinary(nil)
+	b.buf = append(b.buf[:0], byte(e.Type()))
+	b.buf = appendUvarint(b.buf, uint64(len(body)))
+	b.buf = append(b.buf, body...)
+	_, err := b.w.Write(b.buf)
+	return err
+}
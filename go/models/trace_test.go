@@ -0,0 +1,28 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestJsonTrace(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewJsonTrace(&buf)
+	tr.Emit(&BlockEvent{0x1000, 4, "main", 1})
+	tr.Emit(&MemEvent{true, 0x2000, 4, 0x41})
+	expected := `{"type":"block","Addr":4096,"Size":4,"Sym":"main","Depth":1}` + "\n" +
+		`{"type":"mem","Write":true,"Addr":8192,"Size":4,"Value":65}` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected json trace:\n%s", buf.String())
+	}
+}
+
+func TestBinaryTrace(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewBinaryTrace(&buf)
+	tr.Emit(&InsnEvent{0x80, 2, "nop"})
+	expected := []byte{TraceInsn, 7, 0x80, 0x01, 2, 3, 'n', 'o', 'p'}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("unexpected binary trace: %x", buf.Bytes())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"github.com/lunixbochs/ghostrace/ghost/memio"
 	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+	"io"
 )
 
 type Usercorn interface {
@@ -13,11 +14,26 @@ type Usercorn interface {
 	Bits() uint
 	ByteOrder() binary.ByteOrder
 	Disas(addr, size uint64) (string, error)
+	// Instructions decodes the code in [addr, addr+size).
+	Instructions(addr, size uint64) ([]*Instruction, error)
 	Symbolicate(addr uint64) (string, error)
+	// SourceLine returns the DWARF source location of addr (e.g. "file.c:123"), or "".
+	SourceLine(addr uint64) string
+	ResolveSymbol(name string) (uint64, error)
+	Stacktrace() *Stacktrace
+	Threads() Threads
+	Processes() Processes
+	// TraceOutput is where all trace and diagnostic output goes.
+	TraceOutput() io.Writer
+	// Stdio returns replacements for the guest's stdin, stdout and stderr (nil means the host fd).
+	Stdio() (stdin io.Reader, stdout, stderr io.Writer)
 
 	Brk(addr uint64) (uint64, error)
 	Mmap(addr, size uint64) (uint64, error)
 	MmapWrite(addr uint64, p []byte) (uint64, error)
+	MmapRegion(m Mmap, fixed bool) (uint64, error)
+	Mremap(addr, oldSize, newSize uint64, mayMove bool) (uint64, error)
+	Mappings() []Mmap
 	Mem() memio.MemIO
 	StrucAt(addr uint64) *StrucStream
 
@@ -0,0 +1,10 @@
+package native
+
+import (
+	"errors"
+)
+
+// Shmat is not implemented on linux/386, which multiplexes SysV IPC through SYS_IPC.
+func Shmat(id, size int) ([]byte, error) {
+	return nil, errors.New("shmat is not supported on linux/386")
+}
@@ -0,0 +1,19 @@
+package native
+
+import (
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+// Shmat attaches the SysV shared memory segment id and returns the first size bytes.
+func Shmat(id, size int) ([]byte, error) {
+	addr, _, errno := syscall.Syscall(syscall.SYS_SHMAT, uintptr(id), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	var mem []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&mem))
+	hdr.Data, hdr.Len, hdr.Cap = addr, size, size
+	return mem, nil
+}
@@ -0,0 +1,557 @@
+package usercorn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/kernel/common"
+	"github.com/lunixbochs/usercorn/go/loader"
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// registers holding a syscall's return value
+var sysRetRegs = map[string]int{
+	"x86":    uc.X86_REG_EAX,
+	"x86_64": uc.X86_REG_RAX,
+	"arm":    uc.ARM_REG_R0,
+	"arm64":  uc.ARM64_REG_X0,
+	"mips":   uc.MIPS_REG_V0,
+}
+
+// wait(2) status of a process which exited with code or was killed by sig
+func exitedStatus(code int) int  { return (code & 0xff) << 8 }
+func signaledStatus(sig int) int { return sig & 0x7f }
+
+// process is a guest process (see models.Processes). Forked processes run on their own
+// emulator and goroutine, and exec by replacing the emulator.
+type process struct {
+	table     *procTable
+	pid, ppid int
+	// the original process, which execs on the host
+	root bool
+	u    *Usercorn
+	// closed once a vfork child execs or exits
+	release     chan struct{}
+	releaseOnce sync.Once
+	// set by Exec, and only touched by the process's own goroutine
+	exec *execImage
+	// set by Kill
+	signal int32
+	exited bool
+	status int
+}
+
+type execImage struct {
+	u         *Usercorn
+	args, env []string
+}
+
+type pendingFork struct {
+	p      *process
+	vfork  bool
+	sp     uint64
+	setTid uint64
+}
+
+// procTable holds every guest process, and allocates their pids along with thread ids.
+type procTable struct {
+	mu     sync.Mutex
+	exited *sync.Cond
+	procs  map[int]*process
+	next   int
+	// trace output is shared between processes once one forks
+	out    *lockedWriter
+	trace  *lockedTrace
+	tagged bool
+}
+
+func (t *procTable) newID() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.next
+	t.next++
+	return id
+}
+
+// process returns the running process, creating the process table for the original one.
+func (u *Usercorn) process() *process {
+	if u.proc == nil {
+		pid := os.Getpid()
+		u.procs = &procTable{procs: make(map[int]*process), next: pid + 1}
+		u.procs.exited = sync.NewCond(&u.procs.mu)
+		u.proc = &process{table: u.procs, pid: pid, ppid: os.Getppid(), root: true, u: u}
+		u.procs.procs[pid] = u.proc
+	}
+	return u.proc
+}
+
+// Processes returns the guest process table.
+func (u *Usercorn) Processes() models.Processes {
+	return u.process()
+}
+
+// tid returns the id of the running thread.
+func (u *Usercorn) tid() int {
+	if u.threads != nil {
+		return u.threads.cur.tid
+	}
+	return u.process().pid
+}
+
+func (p *process) Pid() int {
+	return p.pid
+}
+
+func (p *process) Ppid() int {
+	p.table.mu.Lock()
+	defer p.table.mu.Unlock()
+	return p.ppid
+}
+
+func (p *process) Fork(vfork bool, sp, setTid uint64) (int, error) {
+	u := p.u
+	if _, ok := sysRetRegs[u.loader.Arch()]; !ok {
+		return 0, fmt.Errorf("Fork is not supported on arch: %s", u.loader.Arch())
+	}
+	t := p.table
+	child := &process{table: t, pid: t.newID(), ppid: p.pid, release: make(chan struct{})}
+	t.mu.Lock()
+	t.procs[child.pid] = child
+	t.mu.Unlock()
+	// the child is created from a snapshot once the syscall returns
+	u.forks = append(u.forks, &pendingFork{child, vfork, sp, setTid})
+	u.Stop()
+	return child.pid, nil
+}
+
+func (p *process) Wait(pid int, nohang bool) (int, int, error) {
+	t := p.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		var reap *process
+		found := false
+		for _, c := range t.procs {
+			if c.ppid != p.pid || c == p || (pid > 0 && c.pid != pid) {
+				continue
+			}
+			found = true
+			if c.exited && (reap == nil || c.pid < reap.pid) {
+				reap = c
+			}
+		}
+		if reap != nil {
+			delete(t.procs, reap.pid)
+			return reap.pid, reap.status, nil
+		}
+		if !found {
+			return 0, 0, syscall.ECHILD
+		}
+		if nohang {
+			return 0, 0, nil
+		}
+		t.exited.Wait()
+	}
+}
+
+// Kill ends a forked process unless sig is ignored by default. Guest signal handlers aren't run.
+func (p *process) Kill(pid, sig int) (bool, error) {
+	t := p.table
+	t.mu.Lock()
+	target, ok := t.procs[pid]
+	t.mu.Unlock()
+	if !ok || target.root {
+		return false, nil
+	}
+	if sig < 0 || sig >= 65 {
+		return true, syscall.EINVAL
+	}
+	switch syscall.Signal(sig) {
+	case 0, syscall.SIGCHLD, syscall.SIGCONT, syscall.SIGURG, syscall.SIGWINCH,
+		syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		return true, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !target.exited && atomic.CompareAndSwapInt32(&target.signal, 0, int32(sig)) && target.u != nil {
+		target.u.Stop()
+	}
+	return true, nil
+}
+
+// current returns the process's emulator, which changes when it execs.
+func (p *process) current() *Usercorn {
+	p.table.mu.Lock()
+	defer p.table.mu.Unlock()
+	return p.u
+}
+
+// waitForks waits for forked processes still running after the original process exits
+// (such as daemons and background jobs), killing them if ctx is done first.
+func (t *procTable) waitForks(ctx context.Context) {
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				t.killForks()
+			case <-done:
+			}
+		}()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.forksRunning() {
+		t.exited.Wait()
+	}
+}
+
+// forksRunning returns true if a forked process hasn't exited. The caller holds t.mu.
+func (t *procTable) forksRunning() bool {
+	for _, p := range t.procs {
+		if !p.root && !p.exited {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *procTable) killForks() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.procs {
+		if !p.root && !p.exited && atomic.CompareAndSwapInt32(&p.signal, 0, int32(syscall.SIGKILL)) && p.u != nil {
+			p.u.Stop()
+		}
+	}
+}
+
+func (p *process) killed() bool {
+	return atomic.LoadInt32(&p.signal) != 0
+}
+
+func (p *process) Exec(path string, argv, envp []string) (bool, error) {
+	if p.root {
+		return false, nil
+	}
+	u := p.u
+	l, path, argv, err := u.loadExec(path, argv)
+	if err != nil {
+		return true, err
+	}
+	config := u.Config
+	config.Path = path
+	nu, err := newUsercorn(l, config)
+	if err != nil {
+		return true, syscall.ENOEXEC
+	}
+	nu.proc, nu.procs = p, p.table
+	if err := forkKernels(u, nu); err != nil {
+		return true, syscall.ENOMEM
+	}
+	p.exec = &execImage{nu, argv, envp}
+	p.releaseVfork()
+	u.Stop()
+	return true, nil
+}
+
+// loadExec opens a program for exec, following script interpreters.
+func (u *Usercorn) loadExec(path string, argv []string) (models.Loader, string, []string, error) {
+	for i := 0; i < 4; i++ {
+		target := u.PrefixPath(path, false)
+		f, err := os.Open(target)
+		if err != nil {
+			if perr, ok := err.(*os.PathError); ok {
+				if errno, ok := perr.Err.(syscall.Errno); ok {
+					return nil, "", nil, errno
+				}
+			}
+			return nil, "", nil, syscall.ENOENT
+		}
+		head := make([]byte, 256)
+		n, _ := io.ReadFull(f, head)
+		f.Close()
+		if !bytes.HasPrefix(head[:n], []byte("#!")) {
+			l, err := loader.LoadFile(target)
+			if err != nil {
+				return nil, "", nil, syscall.ENOEXEC
+			}
+			return l, path, argv, nil
+		}
+		line := string(head[2:n])
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if fields[0] == "" {
+			return nil, "", nil, syscall.ENOEXEC
+		}
+		args := []string{fields[0]}
+		if len(fields) > 1 {
+			args = append(args, strings.TrimSpace(fields[1]))
+		}
+		args = append(args, path)
+		if len(argv) > 1 {
+			args = append(args, argv[1:]...)
+		}
+		path, argv = fields[0], args
+	}
+	return nil, "", nil, syscall.ELOOP
+}
+
+func (p *process) releaseVfork() {
+	p.releaseOnce.Do(func() { close(p.release) })
+}
+
+// exit records a forked process's wait status, reparenting its children to init.
+func (p *process) exit(status int) {
+	t := p.table
+	t.mu.Lock()
+	p.exited, p.status = true, status
+	for pid, c := range t.procs {
+		if c.ppid == p.pid {
+			c.ppid = 1
+			if c.exited {
+				delete(t.procs, pid)
+			}
+		}
+	}
+	if p.ppid == 1 {
+		delete(t.procs, p.pid)
+	}
+	t.exited.Broadcast()
+	t.mu.Unlock()
+	p.releaseVfork()
+}
+
+// run runs a forked process until it exits, including any programs it execs.
+func (p *process) run(u *Usercorn, args, env []string) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for {
+		status := &RunStatus{Reason: StopCancel}
+		var err error
+		if !p.killed() {
+			// Kill's Stop is lost if it comes before the emulator starts, so check again at every block
+			_, err = u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+				if p.killed() {
+					u.Stop()
+				}
+			})
+			if err == nil {
+				status, err = u.RunContext(context.Background(), args, env)
+			}
+		}
+		if img := p.exec; img != nil && err == nil && !p.killed() {
+			p.exec = nil
+			releaseKernels(u)
+			u.Close()
+			u, args, env = img.u, img.args, img.env
+			p.table.mu.Lock()
+			p.u = u
+			p.table.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(u.TraceOutput(), "[pid %d] %s\n", p.pid, err)
+		}
+		var ws int
+		switch {
+		case p.killed():
+			ws = signaledStatus(int(atomic.LoadInt32(&p.signal)))
+		case err != nil || status.Reason == StopFault:
+			ws = signaledStatus(int(syscall.SIGSEGV))
+		case status.Exited:
+			ws = exitedStatus(status.ExitCode)
+		default:
+			ws = signaledStatus(int(syscall.SIGKILL))
+		}
+		releaseKernels(u)
+		u.Close()
+		p.exit(ws)
+		return
+	}
+}
+
+// forkKernels copies per-process kernel state (such as the fd table) from u to a child.
+func forkKernels(u, child *Usercorn) error {
+	for i, k := range u.kernels {
+		if f, ok := k.(common.Forker); ok && i < len(child.kernels) {
+			if err := f.UsercornFork(child.kernels[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func releaseKernels(u *Usercorn) {
+	for _, k := range u.kernels {
+		if f, ok := k.(common.Forker); ok {
+			f.UsercornRelease()
+		}
+	}
+}
+
+// shareTrace makes the process table's trace output safe for concurrent processes.
+func (u *Usercorn) shareTrace() {
+	t := u.procs
+	if t.out != nil {
+		return
+	}
+	w := u.TraceOut
+	if w == nil {
+		w = os.Stderr
+	}
+	t.out = &lockedWriter{w: w}
+	u.TraceOut = t.out
+	if u.Tracer != nil {
+		t.trace = &lockedTrace{w: u.Tracer, last: u.tid()}
+		u.Tracer = &procTracer{t.trace, u.proc}
+	}
+	t.tagged = u.FollowForks
+}
+
+// forkConfig is the config of a forked child. Without FollowForks it isn't traced.
+// Analyses which need the parent's history (or write results at exit) are left to the original process.
+func (u *Usercorn) forkConfig(p *process) Config {
+	c := u.Config
+	c.Coverage, c.CallGraph, c.Profile = false, false, false
+	c.HeapSanitizer, c.TaintTrack = false, false
+	if u.procs.trace != nil {
+		c.Tracer = &procTracer{u.procs.trace, p}
+	}
+	if !u.FollowForks {
+		c.Verbose, c.TraceSys, c.TraceMem, c.TraceMemBatch = false, false, false, false
+		c.TraceExec, c.TraceReg, c.TraceMatch, c.WXAudit = false, false, nil, false
+		c.Tracer = nil
+	}
+	return c
+}
+
+// spawnForks starts the children forked during the last syscall from a snapshot of the parent.
+func (u *Usercorn) spawnForks() error {
+	forks := u.forks
+	u.forks = nil
+	u.shareTrace()
+	s, err := u.takeSnapshot()
+	if err != nil {
+		return err
+	}
+	ret := sysRetRegs[u.loader.Arch()]
+	for i := range s.Regs {
+		if s.Regs[i].Enum == ret {
+			s.Regs[i].Val = 0
+		}
+	}
+	if arch, ok := threadArches[u.loader.Arch()]; ok {
+		if tls, err := u.RegRead(arch.tls); err == nil {
+			s.Regs = append(s.Regs, snapReg{arch.tls, tls})
+		}
+	}
+	for _, f := range forks {
+		child, err := newUsercorn(u.loader, u.forkConfig(f.p))
+		if err != nil {
+			return err
+		}
+		// copied, as libraries are parsed lazily by each process
+		for _, lib := range u.libs {
+			c := *lib
+			child.libs = append(child.libs, &c)
+		}
+		child.restored = u.forkSnapshot(s, f)
+		child.proc, child.procs = f.p, u.procs
+		if err := forkKernels(u, child); err != nil {
+			return err
+		}
+		u.procs.mu.Lock()
+		f.p.u = child
+		u.procs.mu.Unlock()
+		go f.p.run(child, nil, nil)
+		if f.vfork {
+			<-f.p.release
+		}
+	}
+	return nil
+}
+
+// forkSnapshot adjusts the parent's snapshot for one child, copying anything it changes.
+func (u *Usercorn) forkSnapshot(s *snapshot, f *pendingFork) *snapshot {
+	if f.sp == 0 && f.setTid == 0 {
+		return s
+	}
+	c := *s
+	if f.sp != 0 {
+		c.Regs = append([]snapReg(nil), s.Regs...)
+		for i := range c.Regs {
+			if c.Regs[i].Enum == u.arch.SP {
+				c.Regs[i].Val = f.sp
+			}
+		}
+	}
+	if f.setTid != 0 {
+		c.Memory = append([]snapMem(nil), s.Memory...)
+		for i, m := range c.Memory {
+			if f.setTid >= m.Addr && f.setTid+4 <= m.Addr+uint64(len(m.Data)) {
+				data := append([]byte(nil), m.Data...)
+				u.ByteOrder().PutUint32(data[f.setTid-m.Addr:], uint32(f.p.pid))
+				c.Memory[i].Data = data
+			}
+		}
+	}
+	return &c
+}
+
+// lockedWriter serializes writes from concurrent processes.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// lockedTrace serializes structured trace events from concurrent processes,
+// marking each change of process or thread with a ThreadEvent.
+type lockedTrace struct {
+	mu   sync.Mutex
+	w    models.TraceWriter
+	last int
+}
+
+type procTracer struct {
+	t *lockedTrace
+	p *process
+}
+
+func (p *procTracer) Emit(e models.TraceEvent) error {
+	l := p.t
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if te, ok := e.(*models.ThreadEvent); ok {
+		if te.Tid == l.last {
+			return nil
+		}
+		l.last = te.Tid
+	} else if tid := p.p.current().tid(); tid != l.last {
+		if err := l.w.Emit(&models.ThreadEvent{tid}); err != nil {
+			return err
+		}
+		l.last = tid
+	}
+	return l.w.Emit(e)
+}
@@ -0,0 +1,146 @@
+package usercorn
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func newTestProcs() (*procTable, *process) {
+	u := &Usercorn{}
+	root := u.process()
+	return u.procs, root
+}
+
+func addChild(t *procTable, parent *process) *process {
+	c := &process{table: t, pid: t.newID(), ppid: parent.pid, release: make(chan struct{})}
+	t.procs[c.pid] = c
+	return c
+}
+
+func TestWaitStatus(t *testing.T) {
+	if s := exitedStatus(3); s != 0x300 {
+		t.Errorf("exited(3) = 0x%x", s)
+	}
+	if s := exitedStatus(-1); s != 0xff00 {
+		t.Errorf("exited(-1) = 0x%x", s)
+	}
+	if s := signaledStatus(int(syscall.SIGSEGV)); s != 11 {
+		t.Errorf("signaled(SIGSEGV) = %d", s)
+	}
+}
+
+func TestProcessWait(t *testing.T) {
+	table, root := newTestProcs()
+	if _, _, err := root.Wait(-1, false); err != syscall.ECHILD {
+		t.Fatalf("Wait without children: got %v", err)
+	}
+	a, b := addChild(table, root), addChild(table, root)
+	if pid, _, err := root.Wait(-1, true); pid != 0 || err != nil {
+		t.Fatalf("WNOHANG: got pid %d, %v", pid, err)
+	}
+	grandchild := addChild(table, b)
+	b.exit(exitedStatus(1))
+	if grandchild.ppid != 1 {
+		t.Error("grandchild wasn't reparented")
+	}
+	if _, _, err := root.Wait(a.pid+100, true); err != syscall.ECHILD {
+		t.Errorf("Wait for a non-child: got %v", err)
+	}
+	if pid, status, err := root.Wait(-1, false); pid != b.pid || status != 0x100 || err != nil {
+		t.Fatalf("Wait: got pid %d, status 0x%x, %v", pid, status, err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.exit(signaledStatus(int(syscall.SIGKILL)))
+	}()
+	if pid, status, err := root.Wait(a.pid, false); pid != a.pid || status != 9 || err != nil {
+		t.Fatalf("blocking Wait: got pid %d, status 0x%x, %v", pid, status, err)
+	}
+	select {
+	case <-a.release:
+	default:
+		t.Error("exit didn't release a vfork parent")
+	}
+	if _, _, err := root.Wait(-1, false); err != syscall.ECHILD {
+		t.Errorf("children weren't reaped: got %v", err)
+	}
+}
+
+func TestProcessKill(t *testing.T) {
+	table, root := newTestProcs()
+	c := addChild(table, root)
+	if ok, _ := c.Kill(root.pid, 15); ok {
+		t.Error("the original process should be left to the host")
+	}
+	if ok, err := root.Kill(c.pid, int(syscall.SIGCHLD)); !ok || err != nil || c.killed() {
+		t.Error("SIGCHLD should be ignored")
+	}
+	if ok, err := root.Kill(c.pid, int(syscall.SIGTERM)); !ok || err != nil || !c.killed() {
+		t.Error("SIGTERM didn't kill the child")
+	}
+}
+
+func TestWaitForks(t *testing.T) {
+	table, root := newTestProcs()
+	a, b := addChild(table, root), addChild(table, root)
+	b.exit(exitedStatus(0))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.exit(exitedStatus(0))
+	}()
+	table.waitForks(context.Background())
+	if !a.exited {
+		t.Fatal("waitForks returned while a fork was running")
+	}
+
+	c := addChild(table, root)
+	go func() {
+		for !c.killed() {
+			time.Sleep(time.Millisecond)
+		}
+		c.exit(signaledStatus(int(syscall.SIGKILL)))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	table.waitForks(ctx)
+	if !c.exited {
+		t.Error("waitForks didn't kill the fork once ctx was done")
+	}
+}
+
+type eventLog []models.TraceEvent
+
+func (l *eventLog) Emit(e models.TraceEvent) error {
+	*l = append(*l, e)
+	return nil
+}
+
+func TestProcTracerExec(t *testing.T) {
+	table, root := newTestProcs()
+	c := addChild(table, root)
+	c.u = &Usercorn{proc: c, procs: table}
+	var log eventLog
+	tr := &procTracer{&lockedTrace{w: &log, last: root.pid}, c}
+	done := make(chan struct{})
+	go func() {
+		// exec swaps the emulator while the trace may be in use
+		for i := 0; i < 100; i++ {
+			nu := &Usercorn{proc: c, procs: table}
+			table.mu.Lock()
+			c.u = nu
+			table.mu.Unlock()
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		tr.Emit(&models.LoopEvent{})
+	}
+	<-done
+	if te, ok := log[0].(*models.ThreadEvent); !ok || te.Tid != c.pid || len(log) != 101 {
+		t.Errorf("events weren't tagged with the child's pid once: %v", log[:2])
+	}
+}
@@ -0,0 +1,231 @@
+package usercorn
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// profNode is a call stack in the profile, keyed by the entry address of each frame.
+type profNode struct {
+	pc       uint64
+	parent   *profNode
+	children map[uint64]*profNode
+	insns    uint64
+}
+
+func (n *profNode) child(pc uint64) *profNode {
+	c, ok := n.children[pc]
+	if !ok {
+		c = &profNode{pc: pc, parent: n, children: make(map[uint64]*profNode)}
+		n.children[pc] = c
+	}
+	return c
+}
+
+// stack returns frame addresses from the outermost frame to n.
+func (n *profNode) stack() []uint64 {
+	var ret []uint64
+	for ; n.parent != nil; n = n.parent {
+		ret = append(ret, n.pc)
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+// profile counts executed instructions by call stack.
+type profile struct {
+	root *profNode
+	cur  *profNode
+}
+
+func newProfile() *profile {
+	root := &profNode{children: make(map[uint64]*profNode)}
+	return &profile{root: root, cur: root}
+}
+
+// enter sets the call stack for the following instructions.
+func (p *profile) enter(s *models.Stacktrace) {
+	n := p.root
+	for _, frame := range s.Stack {
+		n = n.child(frame.PC)
+	}
+	p.cur = n
+}
+
+// nodes returns every stack that executed instructions, sorted by stack.
+func (p *profile) nodes() []*profNode {
+	var ret []*profNode
+	var walk func(n *profNode)
+	walk = func(n *profNode) {
+		if n.insns > 0 {
+			ret = append(ret, n)
+		}
+		pcs := make([]uint64, 0, len(n.children))
+		for pc := range n.children {
+			pcs = append(pcs, pc)
+		}
+		sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+		for _, pc := range pcs {
+			walk(n.children[pc])
+		}
+	}
+	walk(p.root)
+	return ret
+}
+
+// folded writes the profile in Brendan Gregg's folded stack format, as used by flamegraph.pl.
+func (p *profile) folded(w io.Writer, name func(addr uint64) string) error {
+	b := bufio.NewWriter(w)
+	for _, n := range p.nodes() {
+		stack := n.stack()
+		names := make([]string, len(stack))
+		for i, pc := range stack {
+			// ';' separates frames
+			names[i] = strings.Replace(name(pc), ";", ":", -1)
+		}
+		if len(names) == 0 {
+			names = []string{"[unknown]"}
+		}
+		fmt.Fprintf(b, "%s %d\n", strings.Join(names, ";"), n.insns)
+	}
+	return b.Flush()
+}
+
+// protobuf wire encoding, enough for profile.proto
+type protoBuf []byte
+
+func (p *protoBuf) varint(v uint64) {
+	for v >= 0x80 {
+		*p = append(*p, byte(v)|0x80)
+		v >>= 7
+	}
+	*p = append(*p, byte(v))
+}
+
+func (p *protoBuf) uint(field int, v uint64) {
+	p.varint(uint64(field) << 3)
+	p.varint(v)
+}
+
+func (p *protoBuf) bytes(field int, b []byte) {
+	p.varint(uint64(field)<<3 | 2)
+	p.varint(uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+func (p *protoBuf) packed(field int, vals []uint64) {
+	var b protoBuf
+	for _, v := range vals {
+		b.varint(v)
+	}
+	p.bytes(field, b)
+}
+
+// pprof writes the profile as a gzipped pprof protobuf, as read by `go tool pprof`.
+func (p *profile) pprof(w io.Writer, name func(addr uint64) string) error {
+	var out protoBuf
+	strs := map[string]uint64{"": 0}
+	strtab := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = uint64(len(strtab))
+		strtab = append(strtab, s)
+		return strs[s]
+	}
+	// sample_type
+	var vt protoBuf
+	vt.uint(1, str("instructions"))
+	vt.uint(2, str("count"))
+	out.bytes(1, vt)
+
+	// one location and function per frame address
+	locs := make(map[uint64]uint64)
+	var locOrder []uint64
+	for _, n := range p.nodes() {
+		stack := n.stack()
+		ids := make([]uint64, len(stack))
+		for i, pc := range stack {
+			id, ok := locs[pc]
+			if !ok {
+				id = uint64(len(locs) + 1)
+				locs[pc] = id
+				locOrder = append(locOrder, pc)
+			}
+			// leaf first
+			ids[len(stack)-1-i] = id
+		}
+		var sample protoBuf
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{n.insns})
+		out.bytes(2, sample)
+	}
+	for _, pc := range locOrder {
+		id := locs[pc]
+		var line, loc, fn protoBuf
+		line.uint(1, id)
+		loc.uint(1, id)
+		loc.uint(3, pc)
+		loc.bytes(4, line)
+		out.bytes(4, loc)
+
+		s := str(name(pc))
+		fn.uint(1, id)
+		fn.uint(2, s)
+		fn.uint(3, s)
+		out.bytes(5, fn)
+	}
+	// period_type and period
+	var pt protoBuf
+	pt.uint(1, str("instructions"))
+	pt.uint(2, str("count"))
+	out.bytes(11, pt)
+	out.uint(12, 1)
+	for _, s := range strtab {
+		out.bytes(6, []byte(s))
+	}
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(out); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func (u *Usercorn) addProfile() error {
+	p := newProfile()
+	u.profile = p
+	_, err := u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+		p.cur.insns++
+	})
+	return err
+}
+
+// WriteProfile writes the instructions executed so far by call stack.
+// Format is "folded" (for flamegraph.pl) or "pprof" (gzipped protobuf).
+func (u *Usercorn) WriteProfile(w io.Writer, format string) error {
+	p := u.profile
+	if p == nil {
+		return errors.New("Profiling was not enabled.")
+	}
+	switch format {
+	case "folded":
+		return p.folded(w, u.funcName)
+	case "pprof":
+		return p.pprof(w, u.funcName)
+	default:
+		return fmt.Errorf("Unknown profile format: %s", format)
+	}
+}
@@ -0,0 +1,64 @@
+package usercorn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func testProfile() *profile {
+	p := newProfile()
+	var s models.Stacktrace
+	s.Push(0x1000, 0x8000, "")
+	p.enter(&s)
+	p.cur.insns += 3
+	s.Push(0x2000, 0x7ff0, "")
+	p.enter(&s)
+	p.cur.insns += 5
+	s.Pop()
+	p.enter(&s)
+	p.cur.insns += 2
+	return p
+}
+
+func profName(addr uint64) string {
+	if addr == 0x1000 {
+		return "main"
+	}
+	return fmt.Sprintf("sub_%x", addr)
+}
+
+func TestProfileFolded(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testProfile().folded(&buf, profName); err != nil {
+		t.Fatal(err)
+	}
+	expect := "main 5\nmain;sub_2000 5\n"
+	if buf.String() != expect {
+		t.Fatalf("got %q, want %q", buf.String(), expect)
+	}
+}
+
+func TestProfilePprof(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testProfile().pprof(&buf, profName); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"instructions", "main", "sub_2000"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("string table is missing %q", s)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package usercorn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lunixbochs/usercorn/go/kernel/common"
+)
+
+type SyscallWrite struct {
+	Addr uint64
+	Data []byte
+}
+
+// SyscallLogHeader starts a syscall log. Replay runs the guest with the recorded arguments,
+// environment and path, so its initial stack (and every pointer into it) matches the recording.
+type SyscallLogHeader struct {
+	Exe  string
+	Args []string
+	Env  []string
+}
+
+// SyscallRecord is a single entry in a syscall record/replay log.
+type SyscallRecord struct {
+	Num    int
+	Name   string
+	Args   []uint64
+	Ret    uint64
+	Writes []SyscallWrite `json:",omitempty"`
+}
+
+// These syscalls only modify emulator state (memory layout, registers, threads, exit),
+// so they still run during replay. Their recorded memory writes are applied afterwards.
+// File-backed mmaps are mapped anonymously and filled from the recorded writes.
+var replayPassthrough = map[string]bool{
+	"brk":                          true,
+	"mmap":                         true,
+	"mmap2":                        true,
+	"munmap":                       true,
+	"mremap":                       true,
+	"mprotect":                     true,
+	"madvise":                      true,
+	"exit":                         true,
+	"exit_group":                   true,
+	"arch_prctl":                   true,
+	"set_tid_address":              true,
+	"set_tls":                      true,
+	"clone":                        true,
+	"futex":                        true,
+	"sched_yield":                  true,
+	"thread_fast_set_cthread_self": true,
+	"mach_vm_allocate":             true,
+	"mach_vm_deallocate":           true,
+}
+
+// Record logs every syscall (with its result and guest memory writes) to w as JSON lines.
+func (u *Usercorn) Record(w io.Writer) {
+	u.recorder = json.NewEncoder(w)
+}
+
+// Replay feeds syscall results from a log written by Record back to the guest instead of calling into the host.
+// The guest runs with the recorded arguments and environment instead of the ones passed to Run.
+func (u *Usercorn) Replay(r io.Reader) {
+	u.replayer = json.NewDecoder(r)
+}
+
+// syscallLog writes or reads the log header, returning the args and env to run the guest with.
+func (u *Usercorn) syscallLog(args, env []string) ([]string, []string, error) {
+	switch {
+	case u.replayer != nil:
+		var h SyscallLogHeader
+		if err := u.replayer.Decode(&h); err != nil {
+			return nil, nil, fmt.Errorf("Reading replay log header: %v", err)
+		}
+		u.Path = h.Exe
+		return h.Args, h.Env, nil
+	case u.recorder != nil:
+		return args, env, u.recorder.Encode(&SyscallLogHeader{u.Path, args, env})
+	}
+	return args, env, nil
+}
+
+func (u *Usercorn) recordSyscall(sys *common.Syscall, num int, args []uint64) (uint64, error) {
+	rec := &SyscallRecord{Num: num, Name: sys.Name, Args: args}
+	prev := u.memWatch
+	u.memWatch = func(addr uint64, p []byte) {
+		if prev != nil {
+			prev(addr, p)
+		}
+		data := make([]byte, len(p))
+		copy(data, p)
+		rec.Writes = append(rec.Writes, SyscallWrite{addr, data})
+	}
+	rec.Ret = sys.Call(args)
+	u.memWatch = prev
+	return rec.Ret, u.recorder.Encode(rec)
+}
+
+func (u *Usercorn) replaySyscall(sys *common.Syscall, num int, args []uint64) (uint64, error) {
+	var rec SyscallRecord
+	if err := u.replayer.Decode(&rec); err == io.EOF {
+		return 0, fmt.Errorf("Replay log ended before syscall %s", sys.Name)
+	} else if err != nil {
+		return 0, err
+	}
+	if rec.Name != sys.Name || !sameArgs(rec.Args, args) {
+		return 0, fmt.Errorf("Replay diverged: expected %s%v, got %s%v", rec.Name, rec.Args, sys.Name, args)
+	}
+	ret := rec.Ret
+	if replayPassthrough[sys.Name] {
+		callArgs := args
+		if (sys.Name == "mmap" || sys.Name == "mmap2") && len(args) > 4 {
+			// don't read the host file, its contents are in the recorded writes
+			callArgs = append([]uint64(nil), args...)
+			callArgs[4] = ^uint64(0)
+		}
+		ret = sys.Call(callArgs)
+	}
+	for _, w := range rec.Writes {
+		if err := u.MemWrite(w.Addr, w.Data); err != nil {
+			return 0, err
+		}
+	}
+	return ret, nil
+}
+
+func sameArgs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package usercorn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	co "github.com/lunixbochs/usercorn/go/kernel/common"
+)
+
+type replayKernel struct {
+	co.KernelBase
+	calls  int
+	mmapFd co.Fd
+}
+
+func (k *replayKernel) Getpid() int {
+	k.calls++
+	return 1000 + k.calls
+}
+
+func (k *replayKernel) Mmap(addr, size uint64, prot, flags int, fd co.Fd, off co.Off) uint64 {
+	k.mmapFd = fd
+	return 0x10000
+}
+
+func TestRecordReplay(t *testing.T) {
+	k := &replayKernel{}
+	k.UsercornInit(k, nil)
+	getpid, mmap := k.UsercornSyscall("getpid"), k.UsercornSyscall("mmap")
+	mmapArgs := []uint64{0, 0x1000, 1, 2, 3, 0}
+
+	var log bytes.Buffer
+	u := &Usercorn{Unicorn: &Unicorn{}}
+	u.Path = "/bin/recorded"
+	u.Record(&log)
+	if _, _, err := u.syscallLog([]string{"recorded", "-v"}, []string{"HOME=/home/a"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := u.recordSyscall(getpid, 39, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := u.recordSyscall(mmap, 9, mmapArgs); err != nil {
+		t.Fatal(err)
+	}
+	if k.calls != 2 || k.mmapFd != 3 {
+		t.Fatalf("recording didn't call the kernel: %d calls, fd %d", k.calls, k.mmapFd)
+	}
+
+	u = &Usercorn{Unicorn: &Unicorn{}}
+	u.Replay(bytes.NewReader(log.Bytes()))
+	args, env, err := u.syscallLog([]string{"other"}, []string{"HOME=/home/b", "TERM=xterm"})
+	if err != nil || fmt.Sprint(args, env) != "[recorded -v] [HOME=/home/a]" || u.Exe() != "/bin/recorded" {
+		t.Fatalf("replay didn't use the recorded command line: %v %v %s, %v", args, env, u.Exe(), err)
+	}
+	for _, want := range []uint64{1001, 1002} {
+		if ret, err := u.replaySyscall(getpid, 39, nil); err != nil || ret != want {
+			t.Fatalf("replayed getpid: got %d, %v; want %d", ret, err, want)
+		}
+	}
+	if k.calls != 2 {
+		t.Error("replay called into the kernel")
+	}
+	if ret, err := u.replaySyscall(mmap, 9, mmapArgs); err != nil || ret != 0x10000 {
+		t.Fatalf("replayed mmap: got 0x%x, %v", ret, err)
+	}
+	if k.mmapFd != -1 {
+		t.Errorf("replayed mmap used host fd %d", k.mmapFd)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	k := &replayKernel{}
+	k.UsercornInit(k, nil)
+	mmap := k.UsercornSyscall("mmap")
+	var log bytes.Buffer
+	json.NewEncoder(&log).Encode(&SyscallRecord{Num: 9, Name: "mmap", Args: []uint64{0, 0x1000, 1, 2, 3, 0}, Ret: 0x10000})
+
+	u := &Usercorn{Unicorn: &Unicorn{}}
+	u.Replay(&log)
+	_, err := u.replaySyscall(mmap, 9, []uint64{0, 0x2000, 1, 2, 3, 0})
+	if err == nil || !strings.Contains(err.Error(), "diverged") {
+		t.Errorf("different arguments weren't detected: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package usercorn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/kernel/common"
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+type snapMem struct {
+	Addr uint64
+	Prot int
+	Data []byte
+}
+
+type snapReg struct {
+	Enum int
+	Val  uint64
+}
+
+type snapshot struct {
+	Exe  string
+	Arch string
+	OS   string
+
+	Base, InterpBase uint64
+	Entry, BinEntry  uint64
+	StackBase, Brk   uint64
+	PC               uint64
+
+	Regs    []snapReg
+	Memory  []snapMem
+	Maps    []models.Mmap
+	Kernels [][]byte
+}
+
+// snapRegs lists every register we know how to access for the current arch.
+func (u *Usercorn) snapRegs() []int {
+	seen := make(map[int]bool)
+	var regs []int
+	add := func(enum int) {
+		if enum >= 0 && !seen[enum] {
+			seen[enum] = true
+			regs = append(regs, enum)
+		}
+	}
+	for enum := range u.arch.Regs {
+		add(enum)
+	}
+	add(u.arch.PC)
+	add(u.arch.SP)
+	if u.arch.Gdb != nil {
+		for _, r := range u.arch.Gdb.Regs() {
+			add(r.Enum)
+		}
+	}
+	return regs
+}
+
+// takeSnapshot captures the full emulator state (memory, registers, brk, kernel state).
+func (u *Usercorn) takeSnapshot() (*snapshot, error) {
+	pc, err := u.RegRead(u.arch.PC)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{
+		Exe:        u.Path,
+		Arch:       u.loader.Arch(),
+		OS:         u.os.Name,
+		Base:       u.base,
+		InterpBase: u.interpBase,
+		Entry:      u.entry,
+		BinEntry:   u.binEntry,
+		StackBase:  u.StackBase,
+		Brk:        u.brk,
+		PC:         pc,
+	}
+	for _, enum := range u.snapRegs() {
+		val, err := u.RegRead(enum)
+		if err != nil {
+			continue
+		}
+		s.Regs = append(s.Regs, snapReg{enum, val})
+	}
+	regions, err := u.MemRegions()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range regions {
+		data, err := u.MemRead(r.Begin, r.End-r.Begin+1)
+		if err != nil {
+			return nil, err
+		}
+		s.Memory = append(s.Memory, snapMem{r.Begin, r.Prot, data})
+	}
+	s.Maps = u.Mappings()
+	for _, k := range u.kernels {
+		var state []byte
+		if snap, ok := k.(common.Snapshotter); ok {
+			var buf bytes.Buffer
+			if err := snap.UsercornSnapshot(&buf); err != nil {
+				return nil, err
+			}
+			state = buf.Bytes()
+		}
+		s.Kernels = append(s.Kernels, state)
+	}
+	return s, nil
+}
+
+// Snapshot writes the full emulator state (memory, registers, brk, kernel state) to w.
+func (u *Usercorn) Snapshot(w io.Writer) error {
+	s, err := u.takeSnapshot()
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(w, s)
+}
+
+func writeSnapshot(w io.Writer, s *snapshot) error {
+	gz := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func readSnapshot(r io.Reader) (*snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := gob.NewDecoder(gz).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// check returns an error if the snapshot was taken from a different program.
+func (s *snapshot) check(exe, arch, os string, kernels int) error {
+	if s.Arch != arch || s.OS != os {
+		return fmt.Errorf("Snapshot is for %s/%s, not %s/%s", s.Arch, s.OS, arch, os)
+	}
+	if s.Exe != "" && exe != "" && s.Exe != exe {
+		return fmt.Errorf("Snapshot is for %s, not %s", s.Exe, exe)
+	}
+	if len(s.Kernels) != kernels {
+		return errors.New("Snapshot kernel count mismatch.")
+	}
+	return nil
+}
+
+// SnapshotFile writes a snapshot to path.
+func (u *Usercorn) SnapshotFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return u.Snapshot(f)
+}
+
+// Restore loads a snapshot written by Snapshot. It takes effect when Run is called,
+// which then resumes from the saved program counter instead of the entry point.
+func (u *Usercorn) Restore(r io.Reader) error {
+	s, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	if err := s.check(u.Path, u.loader.Arch(), u.os.Name, len(u.kernels)); err != nil {
+		return err
+	}
+	u.restored = s
+	return nil
+}
+
+// RestoreFile loads a snapshot from path.
+func (u *Usercorn) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return u.Restore(f)
+}
+
+// applySnapshot replaces the current emulator state with a restored snapshot.
+func (u *Usercorn) applySnapshot(s *snapshot) error {
+	regions, err := u.MemRegions()
+	if err != nil {
+		return err
+	}
+	for _, r := range regions {
+		if err := u.Unicorn.Unicorn.MemUnmap(r.Begin, r.End-r.Begin+1); err != nil {
+			return err
+		}
+	}
+	u.memory = nil
+	for i := range s.Maps {
+		m := s.Maps[i]
+		u.memory.insert(&m)
+	}
+	for _, m := range s.Memory {
+		size := uint64(len(m.Data))
+		if err := u.Unicorn.Unicorn.MemMapProt(m.Addr, size, m.Prot); err != nil {
+			return err
+		}
+		if len(s.Maps) == 0 {
+			u.memory.insert(&models.Mmap{Addr: m.Addr, Size: size, Prot: m.Prot, Desc: "anon"})
+		}
+		// the region might not be writable
+		if m.Prot&uc.PROT_WRITE == 0 {
+			u.Unicorn.Unicorn.MemProtect(m.Addr, size, uc.PROT_ALL)
+		}
+		if err := u.MemWrite(m.Addr, m.Data); err != nil {
+			return err
+		}
+		if m.Prot&uc.PROT_WRITE == 0 {
+			u.Unicorn.Unicorn.MemProtect(m.Addr, size, m.Prot)
+		}
+	}
+	return u.applySnapshotState(s)
+}
+
+// applySnapshotState restores everything but memory.
+func (u *Usercorn) applySnapshotState(s *snapshot) error {
+	for _, r := range s.Regs {
+		if err := u.RegWrite(r.Enum, r.Val); err != nil {
+			return err
+		}
+	}
+	for i, k := range u.kernels {
+		if snap, ok := k.(common.Snapshotter); ok && s.Kernels[i] != nil {
+			if err := snap.UsercornRestore(bytes.NewReader(s.Kernels[i])); err != nil {
+				return err
+			}
+		}
+	}
+	u.base, u.interpBase = s.Base, s.InterpBase
+	u.srcLast = nil
+	u.entry, u.binEntry = s.Entry, s.BinEntry
+	u.StackBase, u.brk = s.StackBase, s.Brk
+	return nil
+}
+
+// SnapshotAt writes a snapshot to path the first time execution reaches addr.
+func (u *Usercorn) SnapshotAt(addr uint64, path string) error {
+	var hh uc.Hook
+	var err error
+	hh, err = u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, pc uint64, size uint32) {
+		if pc != addr {
+			return
+		}
+		u.HookDel(hh)
+		if err := u.SnapshotFile(path); err != nil {
+			fmt.Fprintf(u.TraceOutput(), "snapshot failed: %s\n", err)
+		} else if u.Verbose {
+			fmt.Fprintf(u.TraceOutput(), "[snapshot @ 0x%x written to %s]\n", pc, path)
+		}
+	})
+	return err
+}
@@ -0,0 +1,39 @@
+package usercorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := &snapshot{
+		Exe: "/bin/true", Arch: "x86_64", OS: "linux",
+		PC:      0x401000,
+		Regs:    []snapReg{{1, 0x1234}},
+		Memory:  []snapMem{{0x400000, 5, []byte("\x7fELF")}},
+		Kernels: [][]byte{[]byte("state")},
+	}
+	var buf bytes.Buffer
+	if err := writeSnapshot(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	r, err := readSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PC != s.PC || len(r.Regs) != 1 || r.Regs[0] != s.Regs[0] || string(r.Memory[0].Data) != "\x7fELF" || string(r.Kernels[0]) != "state" {
+		t.Fatalf("snapshot didn't survive a round trip: %+v", r)
+	}
+	if err := r.check("/bin/true", "x86_64", "linux", 1); err != nil {
+		t.Error(err)
+	}
+	if err := r.check("/bin/false", "x86_64", "linux", 1); err == nil {
+		t.Error("snapshot of a different executable was accepted")
+	}
+	if err := r.check("/bin/true", "arm", "linux", 1); err == nil {
+		t.Error("snapshot of a different arch was accepted")
+	}
+	if err := r.check("/bin/true", "x86_64", "linux", 2); err == nil {
+		t.Error("kernel count mismatch was accepted")
+	}
+}
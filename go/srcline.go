@@ -0,0 +1,224 @@
+package usercorn
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+type srcRow struct {
+	addr uint64
+	file string
+	line int
+	// end of a sequence, so no code until the next row
+	end bool
+}
+
+// inlineFrame is an inlined call covering [low, high), made from file:line.
+type inlineFrame struct {
+	low, high uint64
+	name      string
+	file      string
+	line      int
+}
+
+// srcInfo is the DWARF line table and inlined calls of one loader, relative to its base.
+type srcInfo struct {
+	rows    []srcRow
+	inlines []inlineFrame
+	// maxHigh[i] is the highest high of inlines[:i+1]
+	maxHigh []uint64
+}
+
+func newSrcInfo(d *dwarf.Data) *srcInfo {
+	s := &srcInfo{}
+	names := make(map[dwarf.Offset]string)
+	nameOf := func(off dwarf.Offset) string {
+		if name, ok := names[off]; ok {
+			return name
+		}
+		r := d.Reader()
+		r.Seek(off)
+		var name string
+		if e, err := r.Next(); err == nil && e != nil {
+			name, _ = e.Val(dwarf.AttrName).(string)
+			if name == "" {
+				name, _ = e.Val(dwarf.AttrLinkageName).(string)
+			}
+		}
+		names[off] = name
+		return name
+	}
+	r := d.Reader()
+	var files []*dwarf.LineFile
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			files = nil
+			lr, err := d.LineReader(e)
+			if err != nil || lr == nil {
+				continue
+			}
+			files = lr.Files()
+			var le dwarf.LineEntry
+			for lr.Next(&le) == nil {
+				row := srcRow{addr: le.Address, line: le.Line, end: le.EndSequence}
+				if le.File != nil {
+					row.file = le.File.Name
+				}
+				s.rows = append(s.rows, row)
+			}
+		case dwarf.TagInlinedSubroutine:
+			f := inlineFrame{}
+			if off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+				f.name = nameOf(off)
+			}
+			if i, ok := e.Val(dwarf.AttrCallFile).(int64); ok && i >= 0 && int(i) < len(files) && files[i] != nil {
+				f.file = files[i].Name
+			}
+			if line, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+				f.line = int(line)
+			}
+			ranges, _ := d.Ranges(e)
+			for _, rg := range ranges {
+				f.low, f.high = rg[0], rg[1]
+				s.inlines = append(s.inlines, f)
+			}
+		}
+	}
+	s.index()
+	return s
+}
+
+// index sorts the line table and inlined calls for lookups.
+func (s *srcInfo) index() {
+	// rows ending a sequence sort before rows starting the next one at the same address
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		a, b := s.rows[i], s.rows[j]
+		return a.addr < b.addr || a.addr == b.addr && a.end && !b.end
+	})
+	// by start, outermost first at the same start
+	sort.SliceStable(s.inlines, func(i, j int) bool {
+		a, b := s.inlines[i], s.inlines[j]
+		return a.low < b.low || a.low == b.low && a.high > b.high
+	})
+	s.maxHigh = make([]uint64, len(s.inlines))
+	var max uint64
+	for i, f := range s.inlines {
+		if f.high > max {
+			max = f.high
+		}
+		s.maxHigh[i] = max
+	}
+}
+
+// line returns the source location of addr.
+func (s *srcInfo) line(addr uint64) (string, int, bool) {
+	i := sort.Search(len(s.rows), func(i int) bool { return s.rows[i].addr > addr }) - 1
+	if i < 0 || s.rows[i].end || s.rows[i].line == 0 {
+		return "", 0, false
+	}
+	return s.rows[i].file, s.rows[i].line, true
+}
+
+// inlined returns the inlined calls containing addr, innermost first.
+func (s *srcInfo) inlined(addr uint64) []inlineFrame {
+	var ret []inlineFrame
+	i := sort.Search(len(s.inlines), func(i int) bool { return s.inlines[i].low > addr }) - 1
+	// nested calls start at or after their callers, so walking back finds the innermost first
+	for ; i >= 0 && s.maxHigh[i] > addr; i-- {
+		if f := s.inlines[i]; addr < f.high {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// srcModule is the DWARF info of a module and its base address.
+type srcModule struct {
+	s    *srcInfo
+	base uint64
+}
+
+func (u *Usercorn) srcInfo(l models.Loader) *srcInfo {
+	if u.srcCache == nil {
+		u.srcCache = make(map[models.Loader]*srcInfo)
+	}
+	s, ok := u.srcCache[l]
+	if !ok {
+		if d, err := l.DWARF(); err == nil && d != nil {
+			s = newSrcInfo(d)
+		}
+		u.srcCache[l] = s
+	}
+	return s
+}
+
+// source finds the DWARF info covering addr, and addr relative to it.
+func (u *Usercorn) source(addr uint64) (*srcInfo, uint64) {
+	// consecutive lookups are usually in the same module
+	if last := u.srcLast; last != nil && addr >= last.base {
+		if _, _, ok := last.s.line(addr - last.base); ok {
+			return last.s, addr - last.base
+		}
+	}
+	for _, m := range u.modules() {
+		if addr < m.base {
+			continue
+		}
+		if s := u.srcInfo(m.l); s != nil {
+			if _, _, ok := s.line(addr - m.base); ok {
+				u.srcLast = &srcModule{s, m.base}
+				return s, addr - m.base
+			}
+		}
+	}
+	return nil, 0
+}
+
+// SourceLine returns the DWARF source location of addr as "file.c:123", followed by any inlined calls
+// containing it, or "" if addr has no line info.
+func (u *Usercorn) SourceLine(addr uint64) string {
+	s, rel := u.source(addr)
+	if s == nil {
+		return ""
+	}
+	file, line, _ := s.line(rel)
+	ret := fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	var inlined []string
+	for _, f := range s.inlined(rel) {
+		inlined = append(inlined, fmt.Sprintf("%s inlined at %s:%d", f.name, filepath.Base(f.file), f.line))
+	}
+	if len(inlined) > 0 {
+		ret += " (" + strings.Join(inlined, ", ") + ")"
+	}
+	return ret
+}
+
+// matchSource returns true if addr is at a source location like "file.c:120".
+func (u *Usercorn) matchSource(addr uint64, loc string) bool {
+	i := strings.LastIndex(loc, ":")
+	if i < 0 {
+		return false
+	}
+	want, err := strconv.Atoi(loc[i+1:])
+	if err != nil {
+		return false
+	}
+	s, rel := u.source(addr)
+	if s == nil {
+		return false
+	}
+	file, line, _ := s.line(rel)
+	name := loc[:i]
+	return line == want && (file == name || filepath.Base(file) == name || strings.HasSuffix(file, "/"+name))
+}
@@ -0,0 +1,56 @@
+package usercorn
+
+import (
+	"testing"
+)
+
+func TestSrcInfoLine(t *testing.T) {
+	s := &srcInfo{
+		rows: []srcRow{
+			{0x1000, "/src/main.c", 10, false},
+			{0x1008, "/src/main.c", 11, false},
+			{0x1010, "/src/util.h", 3, false},
+			{0x1020, "", 0, true},
+			{0x2000, "/src/other.c", 5, false},
+			{0x2004, "", 0, true},
+		},
+		inlines: []inlineFrame{
+			{0x1014, 0x1018, "inner", "/src/util.h", 4},
+			{0x1010, 0x1020, "helper", "/src/main.c", 12},
+		},
+	}
+	s.index()
+	tests := []struct {
+		addr uint64
+		file string
+		line int
+		ok   bool
+	}{
+		{0xfff, "", 0, false},
+		{0x1000, "/src/main.c", 10, true},
+		{0x100c, "/src/main.c", 11, true},
+		{0x101f, "/src/util.h", 3, true},
+		{0x1020, "", 0, false},
+		{0x1800, "", 0, false},
+		{0x2002, "/src/other.c", 5, true},
+		{0x3000, "", 0, false},
+	}
+	for _, test := range tests {
+		file, line, ok := s.line(test.addr)
+		if file != test.file || line != test.line || ok != test.ok {
+			t.Errorf("line(0x%x) = %s:%d %v, want %s:%d %v", test.addr, file, line, ok, test.file, test.line, test.ok)
+		}
+	}
+	if f := s.inlined(0x1010); len(f) != 1 || f[0].name != "helper" {
+		t.Errorf("inlined(0x1010) = %+v", f)
+	}
+	if f := s.inlined(0x1014); len(f) != 2 || f[0].name != "inner" || f[1].name != "helper" {
+		t.Errorf("inlined(0x1014) = %+v", f)
+	}
+	if f := s.inlined(0x1018); len(f) != 1 || f[0].name != "helper" {
+		t.Errorf("inlined(0x1018) = %+v", f)
+	}
+	if f := s.inlined(0x1008); len(f) != 0 {
+		t.Errorf("inlined(0x1008) = %+v", f)
+	}
+}
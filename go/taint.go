@@ -0,0 +1,230 @@
+package usercorn
+
+import (
+	"fmt"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// TaintReport is a use of tainted data found by taint tracking.
+type TaintReport struct {
+	// "indirect branch", "branch condition" or "syscall argument"
+	Kind string
+	PC   uint64
+	Desc string
+}
+
+func (r *TaintReport) String() string {
+	return fmt.Sprintf("tainted %s @0x%x: %s", r.Kind, r.PC, r.Desc)
+}
+
+// tainter tracks which guest bytes and registers hold data derived from input syscalls.
+// Taint is propagated one instruction at a time: register flow comes from disassembly,
+// and memory flow from the memory accesses made while the instruction runs.
+type tainter struct {
+	u   *Usercorn
+	dec *taintDecoder
+	// decoded instructions by address
+	insns map[uint64]*taintInsn
+	mem   map[uint64]bool
+	regs  map[string]bool
+
+	// the instruction currently executing
+	pc       uint64
+	cur      *taintInsn
+	srcTaint bool
+	cgcArgs  []uint64
+
+	seen    map[string]bool
+	reports []TaintReport
+}
+
+func (u *Usercorn) addTaint() error {
+	ta, ok := taintArches[u.loader.Arch()]
+	if !ok {
+		return fmt.Errorf("Taint tracking does not support arch: %s", u.loader.Arch())
+	}
+	t := &tainter{
+		u:     u,
+		dec:   &taintDecoder{regName: u.disas.RegName, ta: ta, cgc: u.os.Name == "cgc"},
+		insns: make(map[uint64]*taintInsn),
+		mem:   make(map[uint64]bool),
+		regs:  make(map[string]bool),
+		seen:  make(map[string]bool),
+	}
+	u.taint = t
+	if _, err := u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+		t.finish()
+		t.start(addr, size)
+	}); err != nil {
+		return err
+	}
+	_, err := u.HookAdd(uc.HOOK_MEM_READ|uc.HOOK_MEM_WRITE, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) {
+		if access == uc.MEM_WRITE {
+			// branches only write return addresses
+			t.set(addr, uint64(size), t.srcTaint && t.cur != nil && !t.cur.branch)
+		} else if !t.srcTaint && t.tainted(addr, uint64(size)) {
+			t.srcTaint = true
+		}
+	})
+	return err
+}
+
+// Taint marks guest memory as tainted, as if it was read from an input syscall.
+func (u *Usercorn) Taint(addr, size uint64) {
+	if u.taint != nil {
+		u.taint.set(addr, size, true)
+	}
+}
+
+// Tainted returns true if any byte in [addr, addr+size) is tainted.
+func (u *Usercorn) Tainted(addr, size uint64) bool {
+	return u.taint != nil && u.taint.tainted(addr, size)
+}
+
+// TaintReports returns the tainted control flow and syscall arguments found so far.
+func (u *Usercorn) TaintReports() []TaintReport {
+	if u.taint == nil {
+		return nil
+	}
+	return u.taint.reports
+}
+
+func (t *tainter) set(addr, size uint64, taint bool) {
+	for i := addr; i < addr+size; i++ {
+		if taint {
+			t.mem[i] = true
+		} else {
+			delete(t.mem, i)
+		}
+	}
+}
+
+func (t *tainter) tainted(addr, size uint64) bool {
+	if len(t.mem) == 0 {
+		return false
+	}
+	for i := addr; i < addr+size; i++ {
+		if t.mem[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tainter) start(addr uint64, size uint32) {
+	insn, ok := t.insns[addr]
+	if !ok {
+		insn = &taintInsn{}
+		if mem, err := t.u.MemRead(addr, uint64(size)); err == nil {
+			if dis, err := t.u.disas.Decode(mem, addr, t.u.csMode()); err == nil {
+				insn = t.dec.decode(dis)
+			}
+		}
+		t.insns[addr] = insn
+	}
+	t.pc, t.cur = addr, insn
+	t.srcTaint = false
+	if !insn.clear {
+		for _, reg := range insn.src {
+			if t.regs[reg] {
+				t.srcTaint = true
+				break
+			}
+		}
+	}
+	if insn.cgcSyscall {
+		t.cgcArgs, _ = t.u.ReadRegs([]int{uc.X86_REG_EAX, uc.X86_REG_EBX, uc.X86_REG_ECX, uc.X86_REG_EDX, uc.X86_REG_ESI})
+	}
+}
+
+// finish applies the register effects of the last instruction, once its memory reads are known.
+func (t *tainter) finish() {
+	insn := t.cur
+	if insn == nil {
+		return
+	}
+	t.cur = nil
+	if insn.branch {
+		if t.srcTaint {
+			kind := "branch condition"
+			if insn.indirect {
+				kind = "indirect branch"
+			}
+			t.report(kind, t.pc, insn.dis)
+		}
+		// calls only write return addresses
+		for _, reg := range insn.dst {
+			delete(t.regs, reg)
+		}
+		return
+	}
+	for _, reg := range insn.dst {
+		if t.srcTaint {
+			t.regs[reg] = true
+		} else {
+			delete(t.regs, reg)
+		}
+	}
+	if insn.cgcSyscall && t.cgcArgs != nil {
+		// CGC receive(fd, buf, count, rx_bytes)
+		args := t.cgcArgs
+		t.cgcArgs = nil
+		if args[0] == 3 && args[4] != 0 {
+			var buf [4]byte
+			if err := t.u.MemReadInto(buf[:], args[4]); err == nil {
+				t.set(args[2], uint64(t.u.UnpackAddr(buf[:])), true)
+			}
+		}
+	}
+}
+
+func (t *tainter) report(kind string, pc uint64, desc string) {
+	key := fmt.Sprintf("%s %x %s", kind, pc, desc)
+	if t.seen[key] {
+		return
+	}
+	t.seen[key] = true
+	r := TaintReport{kind, pc, desc}
+	t.reports = append(t.reports, r)
+	sym, _ := t.u.Symbolicate(pc)
+	if sym != "" {
+		sym = " (" + sym + ")"
+	}
+	fmt.Fprintf(t.u.TraceOutput(), "[taint] %s%s\n", r.String(), sym)
+}
+
+// syscall checks syscall arguments and taints data read by input syscalls.
+func (t *tainter) syscall(name string, args []uint64, ret uint64) {
+	u := t.u
+	pc, _ := u.RegRead(u.arch.PC)
+	for i, reg := range t.dec.ta.sysArgs {
+		if i < len(args) && t.regs[reg] {
+			t.report("syscall argument", pc, fmt.Sprintf("%s argument %d (%s = 0x%x)", name, i, reg, args[i]))
+		}
+	}
+	// the syscall instruction itself doesn't propagate anything
+	t.cur = nil
+	delete(t.regs, t.dec.ta.sysRet)
+	n := int64(ret)
+	if n <= 0 {
+		return
+	}
+	switch name {
+	case "read", "pread64", "recv", "recvfrom":
+		t.set(args[1], uint64(n), true)
+	case "readv", "preadv":
+		for i := uint64(0); i < args[2] && n > 0; i++ {
+			iov := make([]byte, u.Bsz*2)
+			if err := u.MemReadInto(iov, args[1]+i*uint64(len(iov))); err != nil {
+				return
+			}
+			base, size := u.UnpackAddr(iov), int64(u.UnpackAddr(iov[u.Bsz:]))
+			if size > n {
+				size = n
+			}
+			t.set(base, uint64(size), true)
+			n -= size
+		}
+	}
+}
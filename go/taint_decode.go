@@ -0,0 +1,353 @@
+package usercorn
+
+import (
+	"fmt"
+	"strings"
+
+	cs "github.com/bnagy/gapstone"
+)
+
+// taintInsn is the data flow of an instruction, by normalized register name.
+type taintInsn struct {
+	dis string
+	// registers read as data (not as addresses)
+	src []string
+	dst []string
+	// jump, call or return
+	branch bool
+	// the branch target comes from a register or memory
+	indirect bool
+	// clears its destination regardless of sources (e.g. xor eax, eax)
+	clear bool
+	// int 0x80 under CGC
+	cgcSyscall bool
+}
+
+type taintArch struct {
+	sysArgs []string
+	sysRet  string
+	// registers that never carry data (stack pointer, program counter, zero registers)
+	ignore map[string]bool
+	// normalizes register names (e.g. eax -> rax)
+	alias func(name string) string
+}
+
+var x86Alias = make(map[string]string)
+
+func init() {
+	for _, r := range []string{"a", "b", "c", "d"} {
+		for _, name := range []string{r + "l", r + "h", r + "x", "e" + r + "x"} {
+			x86Alias[name] = "r" + r + "x"
+		}
+	}
+	for _, r := range []string{"si", "di", "bp", "sp", "ip"} {
+		for _, name := range []string{r + "l", r, "e" + r} {
+			x86Alias[name] = "r" + r
+		}
+	}
+	for i := 8; i < 16; i++ {
+		full := fmt.Sprintf("r%d", i)
+		for _, suffix := range []string{"b", "w", "d"} {
+			x86Alias[full+suffix] = full
+		}
+	}
+	x86Alias["rflags"] = "eflags"
+}
+
+func set(names ...string) map[string]bool {
+	ret := make(map[string]bool, len(names))
+	for _, name := range names {
+		ret[name] = true
+	}
+	return ret
+}
+
+var taintArches = map[string]*taintArch{
+	"x86": {
+		sysArgs: []string{"rbx", "rcx", "rdx", "rsi", "rdi", "rbp"},
+		sysRet:  "rax",
+		ignore:  set("rsp", "rip"),
+		alias: func(name string) string {
+			if full, ok := x86Alias[name]; ok {
+				return full
+			}
+			return name
+		},
+	},
+	"x86_64": {
+		sysArgs: []string{"rdi", "rsi", "rdx", "r10", "r8", "r9"},
+		sysRet:  "rax",
+		ignore:  set("rsp", "rip"),
+		alias: func(name string) string {
+			if full, ok := x86Alias[name]; ok {
+				return full
+			}
+			return name
+		},
+	},
+	"arm": {
+		sysArgs: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6"},
+		sysRet:  "r0",
+		ignore:  set("sp", "pc"),
+		alias: func(name string) string {
+			switch name {
+			case "r13":
+				return "sp"
+			case "r14":
+				return "lr"
+			case "r15":
+				return "pc"
+			}
+			return name
+		},
+	},
+	"arm64": {
+		sysArgs: []string{"x0", "x1", "x2", "x3", "x4", "x5"},
+		sysRet:  "x0",
+		ignore:  set("sp", "pc", "xzr"),
+		alias: func(name string) string {
+			switch name {
+			case "wsp":
+				return "sp"
+			case "wzr":
+				return "xzr"
+			}
+			if strings.HasPrefix(name, "w") {
+				return "x" + name[1:]
+			}
+			return name
+		},
+	},
+	"mips": {
+		sysArgs: []string{"a0", "a1", "a2", "a3"},
+		sysRet:  "v0",
+		ignore:  set("sp", "pc", "zero"),
+		alias: func(name string) string {
+			return strings.TrimPrefix(name, "$")
+		},
+	},
+}
+
+func hasPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type taintDecoder struct {
+	// capstone register names
+	regName func(id uint) string
+	ta      *taintArch
+	cgc     bool
+}
+
+func (d *taintDecoder) reg(id uint) string {
+	return d.ta.alias(d.regName(id))
+}
+
+// regs appends non-ignored register names.
+func (d *taintDecoder) regs(list []string, ids ...uint) []string {
+	for _, id := range ids {
+		if id == 0 {
+			continue
+		}
+		if name := d.reg(id); name != "" && !d.ta.ignore[name] {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+func (d *taintDecoder) decode(insn *cs.Instruction) *taintInsn {
+	t := &taintInsn{dis: fmt.Sprintf("%s %s", insn.Mnemonic, insn.OpStr)}
+	for _, g := range insn.Groups {
+		if g == cs.CS_GRP_JUMP || g == cs.CS_GRP_CALL || g == cs.CS_GRP_RET {
+			t.branch = true
+		}
+	}
+	t.src = d.regs(t.src, insn.RegistersRead...)
+	t.dst = d.regs(t.dst, insn.RegistersWritten...)
+	switch {
+	case insn.X86 != nil:
+		d.x86(insn, t)
+	case insn.Arm != nil:
+		d.arm(insn, t)
+	case insn.Arm64 != nil:
+		d.arm64(insn, t)
+	case insn.Mips != nil:
+		d.mips(insn, t)
+	}
+	return t
+}
+
+func x86StringOp(m string, ops []cs.X86Operand) bool {
+	if len(m) != 5 || !hasPrefix(m, "movs", "stos", "lods", "cmps", "scas") || !strings.ContainsAny(m[4:], "bwdq") {
+		return false
+	}
+	// movsd and cmpsd are also SSE instructions, but only those take register operands
+	if hasPrefix(m, "movs", "cmps") {
+		for _, op := range ops {
+			if op.Type == cs.X86_OP_REG {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (d *taintDecoder) x86(insn *cs.Instruction, t *taintInsn) {
+	m := insn.Mnemonic
+	ops := insn.X86.Operands
+	if hasPrefix(m, "rep") {
+		m = strings.TrimSpace(m[strings.Index(m, " ")+1:])
+	}
+	// string instructions use their implicit registers as pointers and counters
+	if x86StringOp(m, ops) {
+		t.src, t.dst = nil, nil
+		if hasPrefix(m, "stos", "scas") {
+			t.src = []string{"rax"}
+		}
+		if hasPrefix(m, "lods") {
+			t.dst = []string{"rax"}
+		}
+		if hasPrefix(m, "cmps", "scas") {
+			t.dst = []string{"eflags"}
+		}
+		return
+	}
+	if m == "int" && d.cgc && len(ops) == 1 && ops[0].Imm == 0x80 {
+		t.cgcSyscall = true
+	}
+	if t.branch {
+		for _, op := range ops {
+			switch op.Type {
+			case cs.X86_OP_REG:
+				t.indirect = true
+				t.src = d.regs(t.src, op.Reg)
+			case cs.X86_OP_MEM:
+				t.indirect = true
+			}
+		}
+		if m == "ret" || m == "retf" {
+			t.indirect = true
+		}
+		return
+	}
+	lea := m == "lea"
+	writesFirst := !hasPrefix(m, "cmp", "test", "push", "bt", "ucomis", "comis", "ptest", "nop", "out")
+	pureMove := lea || hasPrefix(m, "mov", "lea", "pop", "set", "cvt", "pinsr", "vmov")
+	for i, op := range ops {
+		switch op.Type {
+		case cs.X86_OP_REG:
+			if i == 0 && writesFirst {
+				t.dst = d.regs(t.dst, op.Reg)
+				if pureMove {
+					continue
+				}
+			}
+			t.src = d.regs(t.src, op.Reg)
+		case cs.X86_OP_MEM:
+			// address registers only carry data into lea
+			if lea {
+				t.src = d.regs(t.src, op.Mem.Base, op.Mem.Index)
+			}
+		}
+	}
+	// sbb reg, reg isn't one, it computes -CF
+	if len(ops) == 2 && ops[0].Type == cs.X86_OP_REG && ops[1].Type == cs.X86_OP_REG && ops[0].Reg == ops[1].Reg {
+		if hasPrefix(m, "xor", "sub", "pxor", "xorp") {
+			t.clear = true
+		}
+	}
+}
+
+func (d *taintDecoder) arm(insn *cs.Instruction, t *taintInsn) {
+	m := insn.Mnemonic
+	ops := insn.Arm.Operands
+	var regs []uint
+	for _, op := range ops {
+		if op.Type == cs.ARM_OP_REG {
+			regs = append(regs, op.Reg)
+		}
+	}
+	store := hasPrefix(m, "str", "stm", "push", "vst", "cmp", "cmn", "tst", "teq")
+	switch {
+	case store:
+		t.src = d.regs(t.src, regs...)
+	case hasPrefix(m, "pop", "vpop"):
+		t.dst = d.regs(t.dst, regs...)
+	case hasPrefix(m, "ldm", "vldm"):
+		if len(regs) > 0 {
+			t.dst = d.regs(t.dst, regs[1:]...)
+		}
+	case t.branch:
+		t.src = d.regs(t.src, regs...)
+		t.indirect = len(regs) > 0 && !hasPrefix(m, "cb")
+	case len(regs) > 0:
+		t.dst = d.regs(t.dst, regs[0])
+		t.src = d.regs(t.src, regs[1:]...)
+	}
+	for _, id := range regs {
+		if !store && d.reg(id) == "pc" {
+			// writes to pc (pop {pc}, ldr pc, mov pc, lr)
+			t.branch, t.indirect = true, true
+		}
+	}
+}
+
+func (d *taintDecoder) arm64(insn *cs.Instruction, t *taintInsn) {
+	m := insn.Mnemonic
+	var regs []uint
+	for _, op := range insn.Arm64.Operands {
+		if op.Type == cs.ARM64_OP_REG {
+			regs = append(regs, op.Reg)
+		}
+	}
+	switch {
+	case hasPrefix(m, "st", "cmp", "cmn", "tst", "ccmp", "ccmn"):
+		t.src = d.regs(t.src, regs...)
+	case hasPrefix(m, "ldp", "ldnp", "ldxp", "ldaxp"):
+		t.dst = d.regs(t.dst, regs...)
+	case m == "ret":
+		t.indirect = true
+		if len(regs) == 0 {
+			t.src = append(t.src, "x30")
+		} else {
+			t.src = d.regs(t.src, regs...)
+		}
+	case m == "br" || m == "blr":
+		t.indirect = true
+		t.src = d.regs(t.src, regs...)
+	case t.branch:
+		// conditional branches (cbz, tbnz) read their register
+		t.src = d.regs(t.src, regs...)
+	case len(regs) > 0:
+		t.dst = d.regs(t.dst, regs[0])
+		t.src = d.regs(t.src, regs[1:]...)
+	}
+}
+
+func (d *taintDecoder) mips(insn *cs.Instruction, t *taintInsn) {
+	m := insn.Mnemonic
+	var regs []uint
+	for _, op := range insn.Mips.Operands {
+		if op.Type == cs.MIPS_OP_REG {
+			regs = append(regs, op.Reg)
+		}
+	}
+	switch {
+	case hasPrefix(m, "sb", "sh", "sw", "sd", "sc"):
+		t.src = d.regs(t.src, regs...)
+	case m == "jr" || m == "jalr":
+		t.indirect = true
+		t.src = d.regs(t.src, regs...)
+	case t.branch:
+		t.src = d.regs(t.src, regs...)
+	case len(regs) > 0:
+		t.dst = d.regs(t.dst, regs[0])
+		t.src = d.regs(t.src, regs[1:]...)
+	}
+}
@@ -0,0 +1,138 @@
+package usercorn
+
+import (
+	"reflect"
+	"testing"
+
+	cs "github.com/bnagy/gapstone"
+)
+
+func TestTaintMem(t *testing.T) {
+	tt := &tainter{mem: make(map[uint64]bool)}
+	tt.set(0x1000, 8, true)
+	if !tt.tainted(0x1007, 1) || !tt.tainted(0xfff, 2) {
+		t.Fatal("expected tainted bytes")
+	}
+	if tt.tainted(0x1008, 8) || tt.tainted(0xff0, 16) {
+		t.Fatal("untainted bytes reported as tainted")
+	}
+	tt.set(0x1000, 4, false)
+	if tt.tainted(0x1000, 4) || !tt.tainted(0x1004, 1) {
+		t.Fatal("partial untaint failed")
+	}
+}
+
+func TestTaintAlias(t *testing.T) {
+	alias := taintArches["x86_64"].alias
+	for name, full := range map[string]string{"al": "rax", "eax": "rax", "sil": "rsi", "r10d": "r10", "rdi": "rdi"} {
+		if got := alias(name); got != full {
+			t.Errorf("alias(%s) = %s, want %s", name, got, full)
+		}
+	}
+	if got := taintArches["arm64"].alias("w3"); got != "x3" {
+		t.Errorf("arm64 alias(w3) = %s", got)
+	}
+}
+
+// testRegs stands in for capstone's register names in decoder tests.
+var testRegs = []string{"", "rax", "eax", "rcx", "rsi", "rdi", "rflags", "xmm0", "r0", "r1", "r4", "lr", "pc", "sp"}
+
+func testReg(name string) uint {
+	for i, r := range testRegs {
+		if r == name {
+			return uint(i)
+		}
+	}
+	panic("unknown test register " + name)
+}
+
+func testDecoder(arch string) *taintDecoder {
+	return &taintDecoder{
+		regName: func(id uint) string { return testRegs[id] },
+		ta:      taintArches[arch],
+	}
+}
+
+func x86Insn(m string, read []string, ops ...cs.X86Operand) *cs.Instruction {
+	insn := &cs.Instruction{X86: &cs.X86Instruction{Operands: ops}}
+	insn.Mnemonic = m
+	for _, r := range read {
+		insn.RegistersRead = append(insn.RegistersRead, testReg(r))
+	}
+	return insn
+}
+
+func x86Reg(name string) cs.X86Operand {
+	return cs.X86Operand{Type: cs.X86_OP_REG, Reg: testReg(name)}
+}
+
+var x86Mem = cs.X86Operand{Type: cs.X86_OP_MEM}
+
+func armInsn(m string, regs ...string) *cs.Instruction {
+	insn := &cs.Instruction{Arm: &cs.ArmInstruction{}}
+	insn.Mnemonic = m
+	for _, r := range regs {
+		insn.Arm.Operands = append(insn.Arm.Operands, cs.ArmOperand{Type: cs.ARM_OP_REG, Reg: testReg(r)})
+	}
+	return insn
+}
+
+// sameRegs compares register lists as sets, as the decoder may repeat names.
+func sameRegs(a, b []string) bool {
+	return reflect.DeepEqual(set(a...), set(b...))
+}
+
+func TestTaintDecodeX86(t *testing.T) {
+	d := testDecoder("x86_64")
+	tests := []struct {
+		insn     *cs.Instruction
+		src, dst []string
+		clear    bool
+	}{
+		// string ops only move data through memory and their implicit registers
+		{x86Insn("rep movsb", []string{"rcx", "rsi", "rdi"}, x86Mem, x86Mem), nil, nil, false},
+		{x86Insn("rep stosd", []string{"eax", "rcx", "rdi"}, x86Mem, x86Reg("eax")), []string{"rax"}, nil, false},
+		{x86Insn("stosd", []string{"eax", "rdi"}, x86Mem), []string{"rax"}, nil, false},
+		{x86Insn("lodsb", []string{"rsi"}, x86Mem), nil, []string{"rax"}, false},
+		{x86Insn("repe cmpsb", []string{"rcx", "rsi", "rdi"}, x86Mem, x86Mem), nil, []string{"eflags"}, false},
+		// movsd with a register operand is SSE
+		{x86Insn("movsd", nil, x86Reg("xmm0"), x86Mem), nil, []string{"xmm0"}, false},
+		{x86Insn("xor", nil, x86Reg("eax"), x86Reg("eax")), []string{"rax"}, []string{"rax"}, true},
+		{x86Insn("pxor", nil, x86Reg("xmm0"), x86Reg("xmm0")), []string{"xmm0"}, []string{"xmm0"}, true},
+		// sbb eax, eax depends on the carry flag
+		{x86Insn("sbb", []string{"rflags"}, x86Reg("eax"), x86Reg("eax")), []string{"eflags", "rax"}, []string{"rax"}, false},
+	}
+	for _, test := range tests {
+		ti := d.decode(test.insn)
+		if !sameRegs(ti.src, test.src) || !sameRegs(ti.dst, test.dst) || ti.clear != test.clear {
+			t.Errorf("%s: src=%v dst=%v clear=%v, want src=%v dst=%v clear=%v",
+				ti.dis, ti.src, ti.dst, ti.clear, test.src, test.dst, test.clear)
+		}
+	}
+}
+
+func TestTaintDecodeArmPc(t *testing.T) {
+	d := testDecoder("arm")
+	tests := []struct {
+		insn     *cs.Instruction
+		src, dst []string
+		branch   bool
+	}{
+		{armInsn("pop", "r4", "pc"), nil, []string{"r4"}, true},
+		{armInsn("ldr", "pc"), nil, nil, true},
+		{armInsn("mov", "pc", "lr"), []string{"lr"}, nil, true},
+		{armInsn("ldm", "sp", "r4", "pc"), nil, []string{"r4"}, true},
+		// storing pc doesn't branch
+		{armInsn("str", "pc"), nil, nil, false},
+		{armInsn("push", "r4", "lr"), []string{"r4", "lr"}, nil, false},
+		{armInsn("mov", "r0", "r1"), []string{"r1"}, []string{"r0"}, false},
+	}
+	for _, test := range tests {
+		ti := d.decode(test.insn)
+		if !sameRegs(ti.src, test.src) || !sameRegs(ti.dst, test.dst) ||
+			ti.branch != test.branch || ti.indirect != test.branch {
+			t.Errorf("%s: src=%v dst=%v branch=%v indirect=%v, want src=%v dst=%v branch=%v",
+				ti.dis, ti.src, ti.dst, ti.branch, ti.indirect, test.src, test.dst, test.branch)
+		}
+	}
+}
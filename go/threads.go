@@ -0,0 +1,331 @@
+package usercorn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+// instructions a thread runs before the scheduler moves on to the next one
+const threadQuantum = 10000
+
+// threadArch lists the registers a new thread needs changed, besides the syscall return value (see sysRetRegs).
+type threadArch struct {
+	// thread pointer
+	tls int
+}
+
+var threadArches = map[string]threadArch{
+	"x86_64": {uc.X86_REG_FS},
+	"arm":    {uc.ARM_REG_C13_C0_3},
+}
+
+type thread struct {
+	tid int
+	// saved CPU context (every register, including FPU and SIMD state) while the thread isn't running
+	ctx uc.Context
+	// registers to write once ctx is restored (syscall results, a new thread's stack and TLS)
+	set   []snapReg
+	stack models.Stacktrace
+	last  blockExit
+	// set by Clone until the parent's registers can be copied
+	start *threadStart
+	// futex the thread is waiting on
+	futex          uint64
+	blocked, timed bool
+}
+
+type threadStart struct {
+	sp, tls uint64
+	setTLS  bool
+}
+
+// threads is a deterministic round-robin scheduler for guest threads (see models.Threads).
+// Threads are switched with the emulator stopped, by saving and restoring the CPU context.
+type threads struct {
+	u    *Usercorn
+	arch threadArch
+	ret  int
+	list []*thread
+	cur  *thread
+	// index of cur in list, or of the thread before it if cur exited
+	pos int
+	// waiters by futex address, in the order they started waiting
+	queues map[uint64][]*thread
+	// switch threads once the emulator stops
+	resched bool
+	count   uint64
+	hooked  bool
+	// trace output is tagged with thread ids once a thread is created
+	tagged bool
+}
+
+func newThreads(u *Usercorn) *threads {
+	main := &thread{tid: u.process().pid}
+	return &threads{
+		u:      u,
+		list:   []*thread{main},
+		cur:    main,
+		queues: make(map[uint64][]*thread),
+	}
+}
+
+// Threads returns the guest thread scheduler.
+func (u *Usercorn) Threads() models.Threads {
+	if u.threads == nil {
+		u.threads = newThreads(u)
+	}
+	return u.threads
+}
+
+func (t *threads) Tid() int {
+	return t.cur.tid
+}
+
+func (t *threads) Clone(sp, tls uint64, setTLS bool) (int, error) {
+	arch, ok := threadArches[t.u.loader.Arch()]
+	if !ok {
+		return 0, fmt.Errorf("Threads are not supported on arch: %s", t.u.loader.Arch())
+	}
+	t.arch, t.ret = arch, sysRetRegs[t.u.loader.Arch()]
+	th := &thread{tid: t.u.procs.newID(), start: &threadStart{sp, tls, setTLS}}
+	t.list = append(t.list, th)
+	t.tagged = true
+	// the child's registers are copied from the parent once the syscall returns
+	t.reschedule()
+	return th.tid, nil
+}
+
+func (t *threads) Exit(status int) {
+	i := t.index(t.cur)
+	t.list = append(t.list[:i], t.list[i+1:]...)
+	t.pos = i - 1
+	if len(t.list) == 0 {
+		t.u.Exit(status)
+		return
+	}
+	t.cur.ctx = nil
+	t.reschedule()
+}
+
+func (t *threads) Wait(addr uint64, timed bool) bool {
+	if timed && t.runnable() == 1 {
+		return false
+	}
+	t.cur.blocked, t.cur.timed, t.cur.futex = true, timed, addr
+	t.queues[addr] = append(t.queues[addr], t.cur)
+	t.reschedule()
+	return true
+}
+
+func (t *threads) Wake(addr uint64, n int, addr2 uint64, requeue int) (woken, requeued int) {
+	queue := t.queues[addr]
+	for len(queue) > 0 && woken < n {
+		queue[0].blocked = false
+		queue = queue[1:]
+		woken++
+	}
+	for len(queue) > 0 && requeued < requeue && addr2 != addr {
+		queue[0].futex = addr2
+		t.queues[addr2] = append(t.queues[addr2], queue[0])
+		queue = queue[1:]
+		requeued++
+	}
+	if len(queue) > 0 {
+		t.queues[addr] = queue
+	} else {
+		delete(t.queues, addr)
+	}
+	return woken, requeued
+}
+
+func (t *threads) Yield() {
+	if t.runnable() > 1 {
+		t.reschedule()
+	}
+}
+
+// reschedule stops the emulator so start() can switch threads.
+func (t *threads) reschedule() {
+	t.resched = true
+	t.u.Stop()
+}
+
+func (t *threads) index(th *thread) int {
+	for i, other := range t.list {
+		if other == th {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *threads) runnable() int {
+	n := 0
+	for _, th := range t.list {
+		if !th.blocked {
+			n++
+		}
+	}
+	return n
+}
+
+// next picks the thread to run after cur, waking a timed futex waiter with ETIMEDOUT if every thread is blocked.
+func (t *threads) next() (*thread, error) {
+	for i := 1; i <= len(t.list); i++ {
+		th := t.list[(t.pos+i+len(t.list))%len(t.list)]
+		if !th.blocked {
+			return th, nil
+		}
+	}
+	for _, th := range t.list {
+		if th.timed {
+			queue := t.queues[th.futex]
+			for i, w := range queue {
+				if w == th {
+					t.queues[th.futex] = append(queue[:i], queue[i+1:]...)
+					break
+				}
+			}
+			th.blocked = false
+			th.set = append(th.set, snapReg{t.ret, errno(syscall.ETIMEDOUT)})
+			return th, nil
+		}
+	}
+	return nil, errors.New("Deadlock: all guest threads are blocked.")
+}
+
+// switchThread saves the stopped thread and restores the next one, returning its pc.
+func (t *threads) switchThread() (uint64, error) {
+	t.resched = false
+	t.count = 0
+	u := t.u
+	if t.index(t.cur) >= 0 {
+		ctx, err := u.ContextSave(t.cur.ctx)
+		if err != nil {
+			return 0, err
+		}
+		t.cur.ctx, t.cur.stack = ctx, u.stacktrace
+		if u.calls != nil {
+			t.cur.last = u.calls.last
+		}
+		for _, th := range t.list {
+			if s := th.start; s != nil {
+				// new threads start as a copy of the parent returning from clone
+				if th.ctx, err = u.ContextSave(nil); err != nil {
+					return 0, err
+				}
+				th.set = append(th.set, snapReg{t.ret, 0})
+				if s.sp != 0 {
+					th.set = append(th.set, snapReg{u.arch.SP, s.sp})
+				}
+				if s.setTLS {
+					th.set = append(th.set, snapReg{t.arch.tls, s.tls})
+				}
+				th.start = nil
+			}
+		}
+	}
+	next, err := t.next()
+	if err != nil {
+		return 0, err
+	}
+	if err := u.ContextRestore(next.ctx); err != nil {
+		return 0, err
+	}
+	for _, r := range next.set {
+		if err := u.RegWrite(r.Enum, r.Val); err != nil {
+			return 0, err
+		}
+	}
+	next.set = nil
+	u.stacktrace = next.stack
+	if u.calls != nil {
+		u.calls.last = next.last
+	}
+	if next != t.cur && u.Tracer != nil {
+		u.Tracer.Emit(&models.ThreadEvent{next.tid})
+	}
+	t.cur, t.pos = next, t.index(next)
+	if !t.hooked && len(t.list) > 1 {
+		t.hooked = true
+		_, err := u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
+			if t.count++; t.count >= threadQuantum && !t.resched && t.runnable() > 1 {
+				t.reschedule()
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return u.RegRead(u.arch.PC)
+}
+
+// start runs the guest from pc, switching threads and starting forked children each time the emulator is stopped for them.
+func (u *Usercorn) start(pc uint64) error {
+	for {
+		err := u.Unicorn.Start(pc, 0xffffffffffffffff)
+		if err != nil || u.exitStatus != nil || StopReason(atomic.LoadInt32(&u.stopReason)) != StopExit {
+			return err
+		}
+		if p := u.proc; p != nil && (p.exec != nil || p.killed()) {
+			return nil
+		}
+		forked := len(u.forks) > 0
+		if forked {
+			if err := u.spawnForks(); err != nil {
+				return err
+			}
+		}
+		if t := u.threads; t != nil && t.resched {
+			pc, err = t.switchThread()
+		} else if forked {
+			pc, err = u.RegRead(u.arch.PC)
+		} else {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tidWriter prefixes each line of trace output with the running thread's id.
+type tidWriter struct {
+	u *Usercorn
+	w io.Writer
+	// the last write didn't end a line
+	mid bool
+}
+
+func (w *tidWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	prefix := "[" + strconv.Itoa(w.u.tid()) + "] "
+	var buf []byte
+	for len(p) > 0 {
+		if !w.mid {
+			buf = append(buf, prefix...)
+		}
+		end := len(p)
+		for i, c := range p {
+			if c == '\n' {
+				end = i + 1
+				break
+			}
+		}
+		buf = append(buf, p[:end]...)
+		w.mid = p[end-1] != '\n'
+		p = p[end:]
+	}
+	if _, err := w.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package usercorn
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestFutexQueue(t *testing.T) {
+	th := &threads{queues: make(map[uint64][]*thread)}
+	var waiters []*thread
+	for i := 0; i < 4; i++ {
+		w := &thread{tid: i, blocked: true, futex: 0x1000}
+		waiters = append(waiters, w)
+		th.list = append(th.list, w)
+		th.queues[0x1000] = append(th.queues[0x1000], w)
+	}
+	if woken, requeued := th.Wake(0x1000, 1, 0x2000, 2); woken != 1 || requeued != 2 {
+		t.Fatalf("Wake: got %d woken, %d requeued", woken, requeued)
+	}
+	if waiters[0].blocked || !waiters[1].blocked {
+		t.Error("threads weren't woken in wait order")
+	}
+	if len(th.queues[0x1000]) != 1 || th.queues[0x1000][0] != waiters[3] {
+		t.Error("wrong thread left on the original futex")
+	}
+	if q := th.queues[0x2000]; len(q) != 2 || q[0] != waiters[1] || waiters[2].futex != 0x2000 {
+		t.Error("threads weren't requeued in order")
+	}
+	if next, err := th.next(); err != nil || next != waiters[0] {
+		t.Errorf("next: got %v, %v", next, err)
+	}
+	th.Wake(0x2000, 10, 0, 0)
+	if _, ok := th.queues[0x2000]; ok || th.runnable() != 3 {
+		t.Error("Wake didn't empty the queue")
+	}
+}
+
+func TestThreadRoundRobin(t *testing.T) {
+	th := &threads{}
+	for i := 0; i < 3; i++ {
+		th.list = append(th.list, &thread{tid: i})
+	}
+	var order []int
+	for i := 0; i < 5; i++ {
+		next, err := th.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		th.cur, th.pos = next, th.index(next)
+		order = append(order, next.tid)
+	}
+	if fmt.Sprint(order) != "[1 2 0 1 2]" {
+		t.Errorf("got order %v", order)
+	}
+	for _, thread := range th.list {
+		thread.blocked = true
+	}
+	if _, err := th.next(); err == nil {
+		t.Error("expected a deadlock error")
+	}
+}
+
+func TestTidWriter(t *testing.T) {
+	var buf bytes.Buffer
+	th := &threads{cur: &thread{tid: 42}}
+	w := &tidWriter{u: &Usercorn{threads: th}, w: &buf}
+	fmt.Fprint(w, "s ")
+	fmt.Fprint(w, "read(0) = 1\n\n+ block")
+	th.cur = &thread{tid: 43}
+	fmt.Fprint(w, " @0x1000\nnext\n")
+	want := "[42] s read(0) = 1\n[42] \n[42] + block @0x1000\n[43] next\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// ctxUnicorn keeps registers in a map, and saves contexts as copies of it.
+type ctxUnicorn struct {
+	uc.Unicorn
+	regs map[int]uint64
+	ctxs map[uc.Context]map[int]uint64
+}
+
+func (f *ctxUnicorn) RegRead(reg int) (uint64, error) {
+	return f.regs[reg], nil
+}
+
+func (f *ctxUnicorn) RegWrite(reg int, val uint64) error {
+	f.regs[reg] = val
+	return nil
+}
+
+func (f *ctxUnicorn) ContextSave(reuse uc.Context) (uc.Context, error) {
+	ctx := reuse
+	if ctx == nil {
+		// contexts are opaque cgo pointers, so allocate one through reflection
+		typ := reflect.TypeOf(ctx)
+		ctx = reflect.New(typ.Elem()).Convert(typ).Interface().(uc.Context)
+	}
+	regs := make(map[int]uint64)
+	for reg, val := range f.regs {
+		regs[reg] = val
+	}
+	f.ctxs[ctx] = regs
+	return ctx, nil
+}
+
+func (f *ctxUnicorn) ContextRestore(ctx uc.Context) error {
+	f.regs = make(map[int]uint64)
+	for reg, val := range f.ctxs[ctx] {
+		f.regs[reg] = val
+	}
+	return nil
+}
+
+func TestThreadSwitchContext(t *testing.T) {
+	fake := &ctxUnicorn{regs: make(map[int]uint64), ctxs: make(map[uc.Context]map[int]uint64)}
+	arch := &models.Arch{PC: uc.X86_REG_RIP, SP: uc.X86_REG_RSP}
+	u := &Usercorn{Unicorn: &Unicorn{Unicorn: fake, arch: arch}}
+	main, child := &thread{tid: 1}, &thread{tid: 2, start: &threadStart{sp: 0x8000}}
+	th := &threads{u: u, arch: threadArches["x86_64"], ret: uc.X86_REG_RAX, list: []*thread{main, child}, cur: main, hooked: true}
+	fake.regs = map[int]uint64{uc.X86_REG_RIP: 0x1000, uc.X86_REG_RSP: 0x7000, uc.X86_REG_RAX: 2, uc.X86_REG_XMM0: 1}
+
+	if pc, err := th.switchThread(); err != nil || pc != 0x1000 || th.cur != child {
+		t.Fatalf("switch to child: pc=0x%x, %v", pc, err)
+	}
+	if fake.regs[uc.X86_REG_RAX] != 0 || fake.regs[uc.X86_REG_RSP] != 0x8000 || fake.regs[uc.X86_REG_XMM0] != 1 {
+		t.Fatalf("child didn't start from the parent's context: %v", fake.regs)
+	}
+	fake.regs[uc.X86_REG_XMM0] = 2
+	fake.regs[uc.X86_REG_RIP] = 0x2000
+
+	if pc, err := th.switchThread(); err != nil || pc != 0x1000 || th.cur != main {
+		t.Fatalf("switch to main: pc=0x%x, %v", pc, err)
+	}
+	if fake.regs[uc.X86_REG_XMM0] != 1 || fake.regs[uc.X86_REG_RAX] != 2 || fake.regs[uc.X86_REG_RSP] != 0x7000 {
+		t.Fatalf("main's context wasn't restored: %v", fake.regs)
+	}
+	if pc, err := th.switchThread(); err != nil || pc != 0x2000 || fake.regs[uc.X86_REG_XMM0] != 2 {
+		t.Fatalf("child's xmm0 wasn't restored: pc=0x%x, %v, %v", pc, fake.regs, err)
+	}
+}
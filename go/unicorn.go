@@ -3,6 +3,8 @@ package usercorn
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	cs "github.com/bnagy/gapstone"
 	"github.com/lunixbochs/ghostrace/ghost/memio"
 	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
 
@@ -16,8 +18,13 @@ type Unicorn struct {
 	bits   int
 	Bsz    int
 	order  binary.ByteOrder
-	memory []mmap
+	memory memMap
 	memio  memio.MemIO
+	disas  *models.Disassembler
+	// called before each host-side memory write
+	memWatch func(addr uint64, p []byte)
+	// called when memory is mapped or its permissions change
+	protWatch func(addr, size uint64, prot int)
 }
 
 func NewUnicorn(arch *models.Arch, os *models.OS, order binary.ByteOrder) (*Unicorn, error) {
@@ -25,30 +32,49 @@ func NewUnicorn(arch *models.Arch, os *models.OS, order binary.ByteOrder) (*Unic
 	if err != nil {
 		return nil, err
 	}
-	return &Unicorn{
+	u := &Unicorn{
 		Unicorn: Uc,
 		arch:    arch,
 		os:      os,
 		bits:    arch.Bits,
 		Bsz:     arch.Bits / 8,
 		order:   order,
-		memio: memio.NewMemIO(
-			// ReadAt() callback
-			func(p []byte, addr uint64) (int, error) {
-				if err := Uc.MemReadInto(p, addr); err != nil {
-					return 0, err
-				}
-				return len(p), nil
-			},
-			// WriteAt() callback
-			func(p []byte, addr uint64) (int, error) {
-				if err := Uc.MemWrite(addr, p); err != nil {
-					return 0, err
-				}
-				return len(p), nil
-			},
-		),
-	}, nil
+		disas:   models.NewDisassembler(arch, disasCacheSize),
+	}
+	u.memio = memio.NewMemIO(
+		// ReadAt() callback
+		func(p []byte, addr uint64) (int, error) {
+			if err := Uc.MemReadInto(p, addr); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		},
+		// WriteAt() callback
+		func(p []byte, addr uint64) (int, error) {
+			if err := u.MemWrite(addr, p); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		},
+	)
+	return u, nil
+}
+
+// csMode returns the capstone mode for the code at pc, which is Thumb on ARM when CPSR.T is set.
+func (u *Unicorn) csMode() uint {
+	mode := u.arch.CS_MODE
+	if u.arch.CS_ARCH == cs.CS_ARCH_ARM {
+		if cpsr, err := u.RegRead(uc.ARM_REG_CPSR); err == nil && cpsr&(1<<5) != 0 {
+			mode |= cs.CS_MODE_THUMB
+		}
+	}
+	return mode
+}
+
+// Close releases the disassembler and the unicorn engine.
+func (u *Unicorn) Close() error {
+	u.disas.Close()
+	return u.Unicorn.Close()
 }
 
 func (u *Unicorn) Arch() *models.Arch {
@@ -67,63 +93,171 @@ func (u *Unicorn) ByteOrder() binary.ByteOrder {
 	return u.order
 }
 
-func (u *Unicorn) mapping(addr, size uint64) *mmap {
-	for _, m := range u.memory {
-		if addr < m.Start && addr+size > m.Start {
-			return &m
-		}
-		if addr >= m.Start && addr < m.Start+m.Size {
-			return &m
-		}
+// number of decoded blocks kept by Disas and Instructions
+const disasCacheSize = 4096
+
+func (u *Unicorn) Disas(addr, size uint64) (string, error) {
+	insns, err := u.Instructions(addr, size)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return models.FormatDisas(insns, u.Bsz), nil
 }
 
-func (u *Unicorn) Disas(addr, size uint64) (string, error) {
+// Instructions decodes the code in [addr, addr+size).
+func (u *Unicorn) Instructions(addr, size uint64) ([]*models.Instruction, error) {
 	mem, err := u.MemRead(addr, size)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return models.Disas(mem, addr, u.arch, u.Bsz)
+	return u.disas.Disas(mem, addr)
 }
 
+// MemMapProt maps the unmapped parts of [addr, addr+size).
 func (u *Unicorn) MemMapProt(addr, size uint64, prot int) error {
-	m := u.mapping(addr, size)
-	for m != nil {
-		a, b := m.Start, m.Start+m.Size
-		if addr < a {
-			size = a - addr
-		} else if addr < b && addr+size > b {
-			right := addr + size
-			addr = b
-			size = right - addr
-		} else {
-			return nil
-		}
-		m = u.mapping(addr, size)
-	}
-	u.memory = append(u.memory, mmap{addr, size})
-	addr, size = align(addr, size, true)
-	return u.Unicorn.MemMap(addr, size)
+	return u.mapRegion(&models.Mmap{Addr: addr, Size: size, Prot: prot, Desc: "anon"})
 }
 
 func (u *Unicorn) MemMap(addr, size uint64) error {
 	return u.MemMapProt(addr, size, uc.PROT_ALL)
 }
 
+// mapRegion maps the unmapped parts of m, recording m's attributes for them.
+// m is only widened to page boundaries, so a fixed mapping can't take over the rest of a UC_MEM_ALIGN block.
+func (u *Unicorn) mapRegion(m *models.Mmap) error {
+	addr := m.Addr &^ (PAGE_SIZE - 1)
+	size := pageAlign(m.Addr+m.Size) - addr
+	for _, gap := range u.memory.gaps(addr, size) {
+		if err := u.Unicorn.MemMapProt(gap[0], gap[1], m.Prot); err != nil {
+			return err
+		}
+		r := *m
+		r.Addr, r.Size = gap[0], gap[1]
+		if r.File != "" {
+			r.Off = uint64(int64(m.Off) + int64(gap[0]-m.Addr))
+		}
+		u.memory.insert(&r)
+		if u.protWatch != nil {
+			u.protWatch(r.Addr, r.Size, r.Prot)
+		}
+	}
+	return nil
+}
+
+// labelMem sets the origin of the mapped parts of [addr, addr+size).
+func (u *Unicorn) labelMem(addr, size uint64, desc, file string, off uint64) {
+	u.memory.update(addr, size, func(m *models.Mmap) {
+		m.Desc, m.File = desc, file
+		if file != "" {
+			m.Off = off + (m.Addr - addr)
+		}
+	})
+}
+
+// MemUnmap unmaps the mapped parts of [addr, addr+size).
+func (u *Unicorn) MemUnmap(addr, size uint64) error {
+	end := addr + size
+	for i := u.memory.index(addr); i < len(u.memory) && u.memory[i].Addr < end; i++ {
+		m := u.memory[i]
+		a, b := m.Addr, m.End()
+		if a < addr {
+			a = addr
+		}
+		if b > end {
+			b = end
+		}
+		if err := u.Unicorn.MemUnmap(a, b-a); err != nil {
+			return err
+		}
+	}
+	u.memory.remove(addr, size)
+	return nil
+}
+
+func (u *Unicorn) MemProtect(addr, size uint64, prot int) error {
+	if !u.memory.covered(addr, size) {
+		return fmt.Errorf("Memory at 0x%x-0x%x is not mapped.", addr, addr+size)
+	}
+	if err := u.Unicorn.MemProtect(addr, size, prot); err != nil {
+		return err
+	}
+	u.memory.update(addr, size, func(m *models.Mmap) { m.Prot = prot })
+	if u.protWatch != nil {
+		u.protWatch(addr, size, prot)
+	}
+	return nil
+}
+
+// Mappings returns the guest memory regions, sorted by address.
+func (u *Unicorn) Mappings() []models.Mmap {
+	ret := make([]models.Mmap, len(u.memory))
+	for i, m := range u.memory {
+		ret[i] = *m
+	}
+	return ret
+}
+
 func (u *Unicorn) Mmap(addr, size uint64) (uint64, error) {
-	if addr == 0 {
-		addr = BASE
-	}
-	_, size = align(0, size, true)
-	addr, size = align(addr, size)
-	for i := addr; i < uint64(1)<<uint64(u.bits-1); i += UC_MEM_ALIGN {
-		if u.mapping(i, size) == nil {
-			err := u.MemMap(i, size)
-			return i, err
+	return u.MmapRegion(models.Mmap{Addr: addr, Size: size, Prot: uc.PROT_ALL, Desc: "anon"}, false)
+}
+
+// MmapRegion maps m.Size bytes with the attributes in m and returns the address.
+// If fixed is set, existing mappings at m.Addr are replaced. Otherwise m.Addr is a hint.
+func (u *Unicorn) MmapRegion(m models.Mmap, fixed bool) (uint64, error) {
+	if fixed {
+		m.Size = pageAlign(m.Size)
+		if err := u.MemUnmap(m.Addr, m.Size); err != nil {
+			return 0, err
 		}
+		return m.Addr, u.mapRegion(&m)
+	}
+	if m.Addr == 0 {
+		m.Addr = BASE
 	}
-	return 0, errors.New("Unicorn.Mmap() failed.")
+	_, size := align(0, m.Size, true)
+	addr, size := align(m.Addr, size)
+	addr, ok := u.memory.free(addr, size, UC_MEM_ALIGN, uint64(1)<<uint64(u.bits-1))
+	if !ok {
+		return 0, errors.New("Unicorn.Mmap() failed.")
+	}
+	m.Addr, m.Size = addr, size
+	return addr, u.mapRegion(&m)
+}
+
+// Mremap resizes the mapping at addr. If it can't grow in place and mayMove is set, it's moved.
+func (u *Unicorn) Mremap(addr, oldSize, newSize uint64, mayMove bool) (uint64, error) {
+	oldSize, newSize = pageAlign(oldSize), pageAlign(newSize)
+	m := u.memory.find(addr)
+	if m == nil || addr+oldSize > m.End() {
+		return 0, fmt.Errorf("Memory at 0x%x-0x%x is not a single mapping.", addr, addr+oldSize)
+	}
+	if newSize <= oldSize {
+		return addr, u.MemUnmap(addr+newSize, oldSize-newSize)
+	}
+	tail := *m
+	tail.Addr, tail.Size = addr+oldSize, newSize-oldSize
+	tail.Off = m.Off + (tail.Addr - m.Addr)
+	if !u.memory.overlaps(tail.Addr, tail.Size) {
+		return addr, u.mapRegion(&tail)
+	}
+	if !mayMove {
+		return 0, fmt.Errorf("Memory at 0x%x can't grow in place.", addr)
+	}
+	data, err := u.MemRead(addr, oldSize)
+	if err != nil {
+		return 0, err
+	}
+	moved := *m
+	moved.Addr, moved.Size = 0, newSize
+	moved.Off = m.Off + (addr - m.Addr)
+	newAddr, err := u.MmapRegion(moved, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := u.MemWrite(newAddr, data); err != nil {
+		return 0, err
+	}
+	return newAddr, u.MemUnmap(addr, oldSize)
 }
 
 func (u *Unicorn) MmapWrite(addr uint64, p []byte) (uint64, error) {
@@ -134,6 +268,14 @@ func (u *Unicorn) MmapWrite(addr uint64, p []byte) (uint64, error) {
 	return addr, u.MemWrite(addr, p)
 }
 
+// MemWrite wraps Unicorn.MemWrite so host-side writes (e.g. from syscalls) can be observed.
+func (u *Unicorn) MemWrite(addr uint64, p []byte) error {
+	if u.memWatch != nil {
+		u.memWatch(addr, p)
+	}
+	return u.Unicorn.MemWrite(addr, p)
+}
+
 func (u *Unicorn) Mem() memio.MemIO {
 	return u.memio
 }
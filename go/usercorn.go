@@ -1,9 +1,12 @@
 package usercorn
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,7 +19,7 @@ import (
 
 type Usercorn struct {
 	*Unicorn
-	exe          string
+	Config
 	loader       models.Loader
 	interpLoader models.Loader
 	kernels      []common.Kernel
@@ -29,27 +32,44 @@ type Usercorn struct {
 	StackBase uint64
 	brk       uint64
 
-	Verbose         bool
-	TraceSys        bool
-	TraceMem        bool
-	TraceMemBatch   bool
-	TraceExec       bool
-	TraceReg        bool
-	TraceMatch      []string
-	TraceMatchDepth int
-	traceMatching   bool
-	ForceBase       uint64
-	ForceInterpBase uint64
-	LoopCollapse    int
-	Demangle        bool
-
-	LoadPrefix string
-	status     models.StatusDiff
-	stacktrace models.Stacktrace
-	blockloop  *models.LoopDetect
-	memlog     models.MemLog
+	traceMatching bool
+	status        models.StatusDiff
+	stacktrace    models.Stacktrace
+	blockloop     *models.LoopDetect
+	memlog        models.MemLog
 
 	exitStatus error
+	stopReason int32
+	coverage   *coverage
+	heapsan    *heapSan
+	taint      *tainter
+	callgraph  *callGraph
+	profile    *profile
+	calls      *callTracker
+	srcCache   map[models.Loader]*srcInfo
+	srcLast    *srcModule
+	threads    *threads
+	proc       *process
+	procs      *procTable
+	symtabs    map[models.Loader]*models.SymbolTable
+	demangled  map[string]string
+	fuzz       *fuzzer
+	// shared libraries mapped by the guest
+	libs []*mappedLib
+	// children forked during the current syscall
+	forks []*pendingFork
+	// trace output tagged with thread or process ids
+	out tidWriter
+	// public hooks (see hooks.go)
+	sysEnter   []*SyscallEnterHook
+	sysExit    []*SyscallExitHook
+	exitHooks  []*ExitHook
+	invalidMem []*InvalidMemHook
+	// pending snapshot, applied by Run()
+	restored *snapshot
+	// syscall record/replay
+	recorder *json.Encoder
+	replayer *json.Decoder
 
 	// deadlock detection
 	lastBlock uint64
@@ -62,6 +82,31 @@ func NewUsercorn(exe string, prefix string) (*Usercorn, error) {
 	if err != nil {
 		return nil, err
 	}
+	exe, _ = filepath.Abs(exe)
+	return newUsercorn(l, Config{Path: exe, LoadPrefix: prefix})
+}
+
+// NewUsercornReader loads a binary from r (e.g. a bytes.Reader), so it doesn't need to exist on disk.
+func NewUsercornReader(r io.ReaderAt, config Config) (*Usercorn, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	l, err := loader.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return newUsercorn(l, config)
+}
+
+// NewUsercornLoader runs an already opened models.Loader, such as one from loader.NewRawLoader.
+func NewUsercornLoader(l models.Loader, config Config) (*Usercorn, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return newUsercorn(l, config)
+}
+
+func newUsercorn(l models.Loader, config Config) (*Usercorn, error) {
 	a, os, err := arch.GetArch(l.Arch(), l.OS())
 	if err != nil {
 		return nil, err
@@ -70,12 +115,10 @@ func NewUsercorn(exe string, prefix string) (*Usercorn, error) {
 	if err != nil {
 		return nil, err
 	}
-	exe, _ = filepath.Abs(exe)
 	u := &Usercorn{
 		Unicorn:       unicorn,
-		exe:           exe,
+		Config:        config,
 		loader:        l,
-		LoadPrefix:    prefix,
 		traceMatching: true,
 	}
 	// load kernels
@@ -92,11 +135,13 @@ func NewUsercorn(exe string, prefix string) (*Usercorn, error) {
 	u.status = models.StatusDiff{U: u, Color: true}
 	u.interpBase, u.entry, u.base, u.binEntry, err = u.mapBinary(u.loader, false)
 	if err != nil {
+		u.Close()
 		return nil, err
 	}
 	// find data segment for brk
 	segments, err := l.Segments()
 	if err != nil {
+		u.Close()
 		return nil, err
 	}
 	for _, seg := range segments {
@@ -113,7 +158,12 @@ func NewUsercorn(exe string, prefix string) (*Usercorn, error) {
 	return u, nil
 }
 
-func (u *Usercorn) Run(args []string, env []string) error {
+// prepare sets up hooks, the stack and the OS, leaving the guest ready to start at u.entry.
+func (u *Usercorn) prepare(args []string, env []string) error {
+	args, env, err := u.syscallLog(args, env)
+	if err != nil {
+		return err
+	}
 	if u.LoopCollapse > 0 {
 		u.blockloop = models.NewLoopDetect(u.LoopCollapse)
 	}
@@ -128,62 +178,90 @@ func (u *Usercorn) Run(args []string, env []string) error {
 			return err
 		}
 	}
+	if u.restored != nil {
+		if err := u.applySnapshot(u.restored); err != nil {
+			return err
+		}
+		u.entry = u.restored.PC
+		u.restored = nil
+	}
+	if u.WXAudit {
+		u.auditWX()
+	}
+	if u.HeapSanitizer {
+		if err := u.addHeapSan(); err != nil {
+			return err
+		}
+	}
+	if u.TaintTrack {
+		if err := u.addTaint(); err != nil {
+			return err
+		}
+	}
 	if u.Verbose {
-		fmt.Fprintf(os.Stderr, "[entry @ 0x%x]\n", u.entry)
+		fmt.Fprintln(u.TraceOutput(), "[memory map]")
+		for _, m := range u.Mappings() {
+			fmt.Fprintf(u.TraceOutput(), "  %s\n", m.String())
+		}
+		fmt.Fprintf(u.TraceOutput(), "[entry @ 0x%x]\n", u.entry)
 		dis, err := u.Disas(u.entry, 64)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(u.TraceOutput(), err)
 		} else {
-			fmt.Fprintln(os.Stderr, dis)
+			fmt.Fprintln(u.TraceOutput(), dis)
 		}
 		sp, err := u.RegRead(u.arch.SP)
 		if err != nil {
 			return err
 		}
-		buf := make([]byte, u.StackBase+STACK_SIZE-sp)
+		buf := make([]byte, u.StackBase+u.stackSize()-sp)
 		if err := u.MemReadInto(buf, sp); err != nil {
 			return err
 		}
-		fmt.Fprintf(os.Stderr, "[stack @ 0x%x]\n", sp)
+		fmt.Fprintf(u.TraceOutput(), "[stack @ 0x%x]\n", sp)
 		for _, line := range models.HexDump(sp, buf[:], u.arch.Bits) {
-			fmt.Fprintf(os.Stderr, "%s\n", line)
+			fmt.Fprintf(u.TraceOutput(), "%s\n", line)
 		}
 	}
-	if u.Verbose || u.TraceReg {
-		u.status.Changes().Print("", true, false)
+	if u.TraceReg && u.Tracer != nil {
+		u.Tracer.Emit(models.NewRegEvent(u.entry, u.status.Changes()))
+	} else if u.Verbose || u.TraceReg {
+		u.status.Changes().Print(u.TraceOutput(), "", true, false)
 	}
 	if u.Verbose {
-		fmt.Fprintln(os.Stderr, "=====================================")
-		fmt.Fprintln(os.Stderr, "==== Program output begins here. ====")
-		fmt.Fprintln(os.Stderr, "=====================================")
+		fmt.Fprintln(u.TraceOutput(), "=====================================")
+		fmt.Fprintln(u.TraceOutput(), "==== Program output begins here. ====")
+		fmt.Fprintln(u.TraceOutput(), "=====================================")
 	}
-	if u.TraceReg || u.TraceExec {
+	if u.trackStack() {
 		sp, _ := u.RegRead(u.arch.SP)
 		sym, _ := u.Symbolicate(u.entry)
-		u.stacktrace.Update(u.entry, sp, sym)
+		u.updateStack(u.entry, 0, sp, sym)
 	}
 	if u.TraceMemBatch {
 		u.memlog = *models.NewMemLog(u.ByteOrder())
+		if u.taint != nil {
+			u.memlog.Tainted = u.Tainted
+		}
 	}
-	err := u.Unicorn.Start(u.entry, 0xffffffffffffffff)
-	if u.TraceMemBatch && !u.memlog.Empty() {
-		u.memlog.Print("", u.arch.Bits)
-		u.memlog.Reset()
-	}
+	return nil
+}
+
+// RunConfig runs the guest with Config.Args and Config.Env.
+func (u *Usercorn) RunConfig() error {
+	return u.Run(u.Args, u.Env)
+}
+
+func (u *Usercorn) Run(args []string, env []string) error {
+	status, err := u.RunContext(context.Background(), args, env)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Registers:")
-		u.status.Changes().Print("", true, false)
-		fmt.Fprintln(os.Stderr, "Stacktrace:")
-		u.stacktrace.Print(u)
-	}
-	if err == nil && u.exitStatus != nil {
-		err = u.exitStatus
+		return err
 	}
-	return err
+	return status.Err()
 }
 
 func (u *Usercorn) Exe() string {
-	return u.exe
+	return u.Path
 }
 
 func (u *Usercorn) Loader() models.Loader {
@@ -223,44 +301,20 @@ func (u *Usercorn) PrefixPath(path string, force bool) string {
 }
 
 func (u *Usercorn) Symbolicate(addr uint64) (string, error) {
-	var symbolicate = func(addr uint64, symbols []models.Symbol) (result models.Symbol, distance uint64) {
-		if len(symbols) == 0 {
-			return
+	var sym models.Symbol
+	var sdist uint64
+	for _, m := range u.modules() {
+		if addr < m.base {
+			continue
 		}
-		nearest := make(map[uint64][]models.Symbol)
-		var min int64 = -1
-		for _, sym := range symbols {
-			if sym.Start == 0 {
-				continue
-			}
-			dist := int64(addr - sym.Start)
-			if dist >= 0 && (sym.Start+uint64(dist) <= sym.End || sym.End == 0) && sym.Name != "" {
-				if dist < min || min == -1 {
-					min = dist
-				}
-				nearest[uint64(dist)] = append(nearest[uint64(dist)], sym)
-			}
+		msym, mdist, ok := u.symtab(m.l).Lookup(addr - m.base)
+		if ok && (sym.Name == "" || mdist < sdist) {
+			sym, sdist = msym, mdist
 		}
-		if len(nearest) > 0 {
-			sym := nearest[uint64(min)][0]
-			return sym, uint64(min)
-		}
-		return
-	}
-	symbols, _ := u.loader.Symbols()
-	var interpSym []models.Symbol
-	if u.interpLoader != nil {
-		interpSym, _ = u.interpLoader.Symbols()
-	}
-	sym, sdist := symbolicate(addr-u.base, symbols)
-	isym, idist := symbolicate(addr-u.interpBase, interpSym)
-	if idist < sdist && isym.Name != "" || sym.Name == "" {
-		sym = isym
-		sdist = idist
 	}
 	if sym.Name != "" {
-		if u.Demangle {
-			sym.Name = models.Demangle(sym.Name)
+		if u.Demangle || u.DemangleParams {
+			sym.Name = u.demangle(sym.Name)
 		}
 		if sdist > 0 {
 			return fmt.Sprintf("%s+0x%x", sym.Name, sdist), nil
@@ -269,10 +323,50 @@ func (u *Usercorn) Symbolicate(addr uint64) (string, error) {
 	return sym.Name, nil
 }
 
+// demangle caches demangled symbol names for the run.
+func (u *Usercorn) demangle(name string) string {
+	if d, ok := u.demangled[name]; ok {
+		return d
+	}
+	if u.demangled == nil {
+		u.demangled = make(map[string]string)
+	}
+	d := models.Demangle(name)
+	if u.DemangleParams {
+		d = models.DemangleParams(name)
+	}
+	u.demangled[name] = d
+	return d
+}
+
+func (u *Usercorn) ResolveSymbol(name string) (uint64, error) {
+	modules := u.modules()
+	for _, m := range modules {
+		if sym, ok := u.symtab(m.l).Find(name); ok {
+			return m.base + sym.Start, nil
+		}
+	}
+	if u.Demangle || u.DemangleParams {
+		for _, m := range modules {
+			for _, sym := range u.symtab(m.l).Symbols() {
+				// with -demangle-params, names without a parameter list still match
+				if u.demangle(sym.Name) == name || models.Demangle(sym.Name) == name {
+					return m.base + sym.Start, nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("Symbol not found: %s", name)
+}
+
+func (u *Usercorn) Stacktrace() *models.Stacktrace {
+	return &u.stacktrace
+}
+
 func (u *Usercorn) Brk(addr uint64) (uint64, error) {
 	// TODO: this is linux specific
 	if addr > 0 {
-		err := u.MemMapProt(u.brk, addr-u.brk, uc.PROT_READ|uc.PROT_WRITE)
+		err := u.mapRegion(&models.Mmap{Addr: u.brk, Size: addr - u.brk, Prot: uc.PROT_READ | uc.PROT_WRITE, Desc: "brk"})
 		if err != nil {
 			return u.brk, err
 		}
@@ -286,7 +380,7 @@ func (u *Usercorn) checkTraceMatch(addr uint64, sym string) bool {
 		return true
 	}
 	match := func(addr uint64, sym string, trace string) bool {
-		return sym == trace || strings.HasPrefix(sym, trace+"+") || fmt.Sprintf("0x%x", addr) == strings.ToLower(trace)
+		return sym == trace || strings.HasPrefix(sym, trace+"+") || fmt.Sprintf("0x%x", addr) == strings.ToLower(trace) || u.matchSource(addr, trace)
 	}
 	for _, v := range u.TraceMatch {
 		if match(addr, sym, v) {
@@ -305,37 +399,73 @@ func (u *Usercorn) checkTraceMatch(addr uint64, sym string) bool {
 	return false
 }
 
+// trackStack returns true if call frames are tracked during execution.
+func (u *Usercorn) trackStack() bool {
+	return u.TraceReg || u.TraceExec || u.TraceStack || u.HeapSanitizer || u.CallGraph || u.Profile
+}
+
 func (u *Usercorn) addHooks() error {
+	if u.Coverage {
+		if err := u.addCoverage(); err != nil {
+			return err
+		}
+	}
+	if u.trackStack() && callTrackArches[u.loader.Arch()] {
+		u.calls = newCallTracker(u)
+	}
+	if u.CallGraph {
+		u.callgraph = newCallGraph()
+	}
+	if u.Profile {
+		if err := u.addProfile(); err != nil {
+			return err
+		}
+	}
 	if u.TraceExec || u.TraceReg {
 		u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
 			sym, _ := u.Symbolicate(addr)
+			// the stack is updated for every block, so calls and returns aren't missed
+			if sp, err := u.RegRead(u.arch.SP); err == nil {
+				u.updateStack(addr, size, sp, sym)
+			}
+			// match, indent and emit at the depth the block runs at
+			depth := u.stacktrace.Len()
 			if !u.checkTraceMatch(addr, sym) {
 				u.traceMatching = false
 				return
 			}
 			u.traceMatching = true
 			var indent string
-			if u.stacktrace.Len() > 2 {
-				indent = strings.Repeat("  ", u.stacktrace.Len()-1)
+			if depth > 2 {
+				indent = strings.Repeat("  ", depth-1)
 			}
 			if u.blockloop != nil {
 				if looped, loop, count := u.blockloop.Update(addr); looped {
 					return
+				} else if count > 1 && u.Tracer != nil {
+					u.Tracer.Emit(&models.LoopEvent{count, loop})
 				} else if count > 1 {
 					// TODO: maybe print a message when we start collapsing loops
 					// with the symbols or even all disassembly involved encapsulated
 					chain := u.blockloop.String(u, loop)
-					fmt.Fprintf(os.Stderr, indent+"- (%d) loops over %s\n", count, chain)
+					fmt.Fprintf(u.TraceOutput(), indent+"- (%d) loops over %s\n", count, chain)
 				}
 			}
-			if u.TraceMemBatch {
-				u.memlog.Print(indent, u.arch.Bits)
+			if u.TraceMemBatch && u.Tracer == nil {
+				u.memlog.Print(u.TraceOutput(), indent, u.arch.Bits)
 				u.memlog.Reset()
 			}
-			if sp, err := u.RegRead(u.arch.SP); err == nil {
-				u.stacktrace.Update(addr, sp, sym)
+			if u.Tracer != nil {
+				u.Tracer.Emit(&models.BlockEvent{addr, size, sym, depth})
+				if !u.TraceExec && u.TraceReg && u.deadlock == 0 {
+					if changes := u.status.Changes(); changes.Count() > 0 {
+						u.Tracer.Emit(models.NewRegEvent(addr, changes))
+					}
+				}
+				u.lastBlock = addr
+				return
 			}
-			indent = strings.Repeat("  ", u.stacktrace.Len())
+			indent = strings.Repeat("  ", depth)
 			blockIndent := indent
 			if len(indent) >= 2 {
 				blockIndent = indent[:len(indent)-2]
@@ -344,19 +474,31 @@ func (u *Usercorn) addHooks() error {
 				sym = " (" + sym + ")"
 			}
 			blockLine := fmt.Sprintf("\n%s+ block%s @0x%x", blockIndent, sym, addr)
+			if src := u.SourceLine(addr); src != "" {
+				blockLine += " " + src
+			}
 			if !u.TraceExec && u.TraceReg && u.deadlock == 0 {
 				changes := u.status.Changes()
 				if changes.Count() > 0 {
-					fmt.Fprintln(os.Stderr, blockLine)
-					changes.Print(indent, true, true)
+					fmt.Fprintln(u.TraceOutput(), blockLine)
+					changes.Print(u.TraceOutput(), indent, true, true)
 				}
 			} else {
-				fmt.Fprintln(os.Stderr, blockLine)
+				fmt.Fprintln(u.TraceOutput(), blockLine)
 			}
 			u.lastBlock = addr
 		})
 	}
+	if u.trackStack() && !(u.TraceExec || u.TraceReg) {
+		u.HookAdd(uc.HOOK_BLOCK, func(_ uc.Unicorn, addr uint64, size uint32) {
+			if sp, err := u.RegRead(u.arch.SP); err == nil {
+				sym, _ := u.Symbolicate(addr)
+				u.updateStack(addr, size, sp, sym)
+			}
+		})
+	}
 	if u.TraceExec {
+		var lastSrc string
 		u.HookAdd(uc.HOOK_CODE, func(_ uc.Unicorn, addr uint64, size uint32) {
 			if !u.traceMatching {
 				return
@@ -366,11 +508,21 @@ func (u *Usercorn) addHooks() error {
 			if addr == u.lastCode || u.TraceReg && u.TraceExec {
 				changes = u.status.Changes()
 			}
-			if u.TraceExec && u.blockloop == nil || u.blockloop.Loops == 0 {
+			if u.Tracer != nil && (u.blockloop == nil || u.blockloop.Loops == 0) {
 				dis, _ := u.Disas(addr, uint64(size))
-				fmt.Fprintf(os.Stderr, "%s", indent+dis)
+				u.Tracer.Emit(&models.InsnEvent{addr, size, dis})
+				if u.TraceReg && changes.Count() > 0 {
+					u.Tracer.Emit(models.NewRegEvent(addr, changes))
+				}
+			} else if u.TraceExec && u.blockloop == nil || u.blockloop.Loops == 0 {
+				if src := u.SourceLine(addr); src != "" && src != lastSrc {
+					fmt.Fprintf(u.TraceOutput(), "%s; %s\n", indent, src)
+					lastSrc = src
+				}
+				dis, _ := u.Disas(addr, uint64(size))
+				fmt.Fprintf(u.TraceOutput(), "%s", indent+dis)
 				if !u.TraceReg || changes.Count() == 0 {
-					fmt.Fprintln(os.Stderr)
+					fmt.Fprintln(u.TraceOutput())
 				} else {
 					dindent := ""
 					// TODO: I can count the max dis length in the block and reuse it here
@@ -378,14 +530,14 @@ func (u *Usercorn) addHooks() error {
 					if pad > 0 {
 						dindent = strings.Repeat(" ", pad)
 					}
-					changes.Print(dindent, true, true)
+					changes.Print(u.TraceOutput(), dindent, true, true)
 				}
 			}
 			if addr == u.lastCode {
 				u.deadlock++
 				if changes.Count() > 0 {
 					if u.TraceReg {
-						changes.Print(indent, true, true)
+						changes.Print(u.TraceOutput(), indent, true, true)
 					}
 					u.deadlock = 0
 				}
@@ -394,8 +546,8 @@ func (u *Usercorn) addHooks() error {
 					if sym != "" {
 						sym = " (" + sym + ")"
 					}
-					fmt.Fprintf(os.Stderr, "FATAL: deadlock detected at 0x%x%s\n", addr, sym)
-					changes.Print(indent, true, false)
+					fmt.Fprintf(u.TraceOutput(), "FATAL: deadlock detected at 0x%x%s\n", addr, sym)
+					changes.Print(u.TraceOutput(), indent, true, false)
 					u.Stop()
 				}
 			} else {
@@ -428,18 +580,22 @@ func (u *Usercorn) addHooks() error {
 					}
 				}
 			}
+			if u.Tracer != nil {
+				u.Tracer.Emit(&models.MemEvent{letter == "W", addr, size, uint64(value)})
+				return
+			}
 			if u.TraceMem {
 				memFmt := fmt.Sprintf("%%s%%s 0x%%0%dx 0x%%0%dx\n", u.Bsz*2, size*2)
 				indent := ""
 				if u.stacktrace.Len() > 0 {
 					indent = strings.Repeat("  ", u.stacktrace.Len()-1)
 				}
-				fmt.Fprintf(os.Stderr, memFmt, indent, letter, addr, value)
+				fmt.Fprintf(u.TraceOutput(), memFmt, indent, letter, addr, value)
 			}
 			if u.TraceMemBatch {
 				write := (letter == "W")
 				if !(u.TraceExec || u.TraceReg) && !u.memlog.Adjacent(addr, value, size, write) {
-					u.memlog.Print("", u.arch.Bits)
+					u.memlog.Print(u.TraceOutput(), "", u.arch.Bits)
 					u.memlog.Reset()
 				}
 				u.memlog.Update(addr, size, value, letter == "W")
@@ -448,17 +604,24 @@ func (u *Usercorn) addHooks() error {
 	}
 	invalid := uc.HOOK_MEM_READ_INVALID | uc.HOOK_MEM_WRITE_INVALID | uc.HOOK_MEM_FETCH_INVALID
 	u.HookAdd(invalid, func(_ uc.Unicorn, access int, addr uint64, size int, value int64) bool {
+		if u.invalidMemHooks(access, addr, size, value) {
+			return true
+		}
 		switch access {
 		case uc.MEM_WRITE_UNMAPPED, uc.MEM_WRITE_PROT:
-			fmt.Fprintf(os.Stderr, "invalid write")
+			fmt.Fprintf(u.TraceOutput(), "invalid write")
 		case uc.MEM_READ_UNMAPPED, uc.MEM_READ_PROT:
-			fmt.Fprintf(os.Stderr, "invalid read")
+			fmt.Fprintf(u.TraceOutput(), "invalid read")
 		case uc.MEM_FETCH_UNMAPPED, uc.MEM_FETCH_PROT:
-			fmt.Fprintf(os.Stderr, "invalid fetch")
+			fmt.Fprintf(u.TraceOutput(), "invalid fetch")
 		default:
-			fmt.Fprintf(os.Stderr, "unknown memory error")
+			fmt.Fprintf(u.TraceOutput(), "unknown memory error")
 		}
-		fmt.Fprintf(os.Stderr, ": @0x%x, 0x%x = 0x%x\n", addr, size, uint64(value))
+		fmt.Fprintf(u.TraceOutput(), ": @0x%x, 0x%x = 0x%x", addr, size, uint64(value))
+		if m := u.memory.find(addr); m != nil {
+			fmt.Fprintf(u.TraceOutput(), " (protection fault in %s)", m)
+		}
+		fmt.Fprintln(u.TraceOutput())
 		return false
 	})
 	u.HookAdd(uc.HOOK_INTR, func(_ uc.Unicorn, intno uint32) {
@@ -501,21 +664,31 @@ outer:
 	if isInterp {
 		loadBias = u.ForceInterpBase
 	}
+	// segments are mapped writable for loading, then protected per page
 	for _, seg := range merged {
 		size := seg.End - seg.Start
 		if dynamic && seg.Start == 0 && loadBias == 0 {
 			loadBias, err = u.Mmap(0x1000000, size)
 		} else {
-			prot := seg.Prot
-			if prot == 0 {
-				prot = uc.PROT_ALL
-			}
-			err = u.MemMapProt(loadBias+seg.Start, seg.End-seg.Start, prot)
+			err = u.MemMapProt(loadBias+seg.Start, seg.End-seg.Start, uc.PROT_ALL)
 		}
 		if err != nil {
 			return
 		}
 	}
+	// record where each segment came from
+	desc, file := "exe", u.Path
+	if isInterp {
+		desc, file = "interp", u.PrefixPath(u.loader.Interp(), true)
+	}
+	for _, seg := range segments {
+		addr, size := align(seg.Addr, seg.Size, true)
+		off := uint64(0)
+		if seg.Off >= seg.Addr-addr {
+			off = seg.Off - (seg.Addr - addr)
+		}
+		u.labelMem(loadBias+addr, size, desc, file, off)
+	}
 	// write segment memory
 	var data []byte
 	for _, seg := range segments {
@@ -526,6 +699,11 @@ outer:
 			return
 		}
 	}
+	for _, run := range segmentProts(segments, merged) {
+		if err = u.MemProtect(loadBias+run.Start, run.End-run.Start, run.Prot); err != nil {
+			return
+		}
+	}
 	entry = loadBias + l.Entry()
 	// load interpreter if present
 	interp := l.Interp()
@@ -547,25 +725,68 @@ outer:
 	}
 }
 
+// segmentProts splits merged segments into runs of pages with the same permissions.
+// Pages shared by segments get the union, and alignment padding gets the permissions of the page before it.
+func segmentProts(segments []models.SegmentData, merged []*models.Segment) []models.Segment {
+	pages := make(map[uint64]int)
+	for _, seg := range segments {
+		prot := seg.Prot
+		if prot == 0 {
+			prot = uc.PROT_ALL
+		}
+		for page := seg.Addr &^ (PAGE_SIZE - 1); page < seg.Addr+seg.Size; page += PAGE_SIZE {
+			pages[page] |= prot
+		}
+	}
+	var runs []models.Segment
+	for _, seg := range merged {
+		// padding before the first segment page takes its permissions
+		prot := uc.PROT_ALL
+		for page := seg.Start; page < seg.End; page += PAGE_SIZE {
+			if p, ok := pages[page]; ok {
+				prot = p
+				break
+			}
+		}
+		start := seg.Start
+		for page := seg.Start; page <= seg.End; page += PAGE_SIZE {
+			p, ok := pages[page]
+			if !ok {
+				p = prot
+			}
+			if page == seg.End || p != prot {
+				runs = append(runs, models.Segment{start, page, prot})
+				start, prot = page, p
+			}
+		}
+	}
+	return runs
+}
+
 func (u *Usercorn) mapStack() error {
-	stack, err := u.Mmap(STACK_BASE, STACK_SIZE)
+	stack, err := u.MmapRegion(models.Mmap{Addr: STACK_BASE, Size: u.stackSize(), Prot: uc.PROT_READ | uc.PROT_WRITE, Desc: "stack"}, false)
 	if err != nil {
 		return err
 	}
 	u.StackBase = stack
-	stackEnd := stack + STACK_SIZE
+	stackEnd := stack + u.stackSize()
 	if err := u.RegWrite(u.arch.SP, stackEnd); err != nil {
 		return err
 	}
-	return u.MemMapProt(stackEnd, UC_MEM_ALIGN, uc.PROT_NONE)
+	return u.mapRegion(&models.Mmap{Addr: stackEnd, Size: UC_MEM_ALIGN, Desc: "stack"})
 }
 
 func (u *Usercorn) Syscall(num int, name string, getArgs func(n int) ([]uint64, error)) (uint64, error) {
 	if name == "" {
 		panic(fmt.Sprintf("Syscall missing: %d", num))
 	}
-	if u.TraceSys && u.stacktrace.Len() > 0 {
-		fmt.Fprintf(os.Stderr, strings.Repeat("  ", u.stacktrace.Len()-1)+"s ")
+	if u.TraceSys && u.stacktrace.Len() > 0 && u.Tracer == nil {
+		fmt.Fprintf(u.TraceOutput(), strings.Repeat("  ", u.stacktrace.Len()-1)+"s ")
+		if pc, err := u.RegRead(u.arch.PC); err == nil {
+			if src := u.SourceLine(pc); src != "" {
+				fmt.Fprintf(u.TraceOutput(), "[%s] ", src)
+			}
+		}
 	}
 	for _, k := range u.kernels {
 		if sys := k.UsercornSyscall(name); sys != nil {
@@ -573,11 +794,52 @@ func (u *Usercorn) Syscall(num int, name string, getArgs func(n int) ([]uint64,
 			if err != nil {
 				return 0, err
 			}
-			if u.TraceSys {
+			if u.TraceSys && u.Tracer == nil {
 				sys.Trace(args)
 			}
-			ret := sys.Call(args)
-			if u.TraceSys {
+			var ret uint64
+			skip := false
+			for _, hook := range u.sysEnter {
+				if ret, skip = (*hook)(num, name, args); skip {
+					break
+				}
+			}
+			switch {
+			case skip:
+			case u.fuzz != nil && u.fuzz.handles(name, args):
+				ret = u.fuzz.syscall(name, args)
+			case u.replayer != nil:
+				ret, err = u.replaySyscall(sys, num, args)
+			case u.recorder != nil:
+				ret, err = u.recordSyscall(sys, num, args)
+			default:
+				ret = sys.Call(args)
+			}
+			for _, hook := range u.sysExit {
+				ret = (*hook)(num, name, args, ret)
+			}
+			if u.taint != nil {
+				u.taint.syscall(name, args, ret)
+			}
+			if err != nil {
+				// arch syscall handlers ignore errors, so stop the guest here
+				u.exitStatus = err
+				u.Stop()
+				return 0, err
+			}
+			if name == "mmap" || name == "mmap2" {
+				if u.coverage != nil {
+					u.coverMmap(ret)
+				}
+				if lib := u.mapLib(ret); lib != nil && u.heapsan != nil {
+					if l := u.libLoader(lib); l != nil {
+						u.heapsan.addLoader(l, lib.base)
+					}
+				}
+			}
+			if u.TraceSys && u.Tracer != nil {
+				u.Tracer.Emit(&models.SyscallEvent{num, name, args, sys.ArgStrings(args), ret})
+			} else if u.TraceSys {
 				sys.TraceRet(args, ret)
 			}
 			return ret, nil
@@ -586,6 +848,22 @@ func (u *Usercorn) Syscall(num int, name string, getArgs func(n int) ([]uint64,
 	panic(fmt.Errorf("Kernel not found for syscall '%s'", name))
 }
 
+func (u *Usercorn) TraceOutput() io.Writer {
+	w := u.TraceOut
+	if w == nil {
+		w = os.Stderr
+	}
+	if t := u.threads; t != nil && t.tagged || u.procs != nil && u.procs.tagged {
+		u.out.u, u.out.w = u, w
+		return &u.out
+	}
+	return w
+}
+
+func (u *Usercorn) Stdio() (io.Reader, io.Writer, io.Writer) {
+	return u.Stdin, u.Stdout, u.Stderr
+}
+
 func (u *Usercorn) Exit(status int) {
 	u.exitStatus = models.ExitStatus(status)
 	u.Stop()
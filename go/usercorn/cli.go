@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -10,6 +12,8 @@ import (
 	"strings"
 
 	usercorn "github.com/lunixbochs/usercorn/go"
+	"github.com/lunixbochs/usercorn/go/debug"
+	"github.com/lunixbochs/usercorn/go/loader"
 	"github.com/lunixbochs/usercorn/go/models"
 )
 
@@ -25,12 +29,39 @@ func main() {
 	mtrace2 := fs.Bool("mtrace2", false, "trace memory access (batched)")
 	etrace := fs.Bool("etrace", false, "trace execution")
 	rtrace := fs.Bool("rtrace", false, "trace register modification")
+	followForks := fs.Bool("follow-forks", false, "trace forked child processes too (output is tagged with the pid)")
+	coverage := fs.String("coverage", "", "write basic block coverage to this file (drcov format)")
+	profile := fs.String("profile", "", "write an instruction count profile to this file (.folded for flamegraph.pl, or .pb.gz/.pprof for pprof)")
+	callgraph := fs.String("callgraph", "", "write a call graph to this file (.dot, or .json for JSON)")
+	heapSan := fs.Bool("asan", false, "heap sanitizer: detect heap overflows, use-after-free and double free")
+	taint := fs.Bool("taint", false, "track data read from input syscalls and report tainted branches and syscall arguments")
+	wxAudit := fs.Bool("wx-audit", false, "log memory that becomes both writable and executable")
+	traceFile := fs.String("o", "", "write trace output to this file instead of stderr")
+	traceFormat := fs.String("trace-format", "text", "trace output format (text, json, binary)")
 	match := fs.String("match", "", "trace from specific function(s) (func[,func...][+depth]")
 	looproll := fs.Int("loop", 0, "collapse loop blocks of this depth")
 	prefix := fs.String("prefix", "", "library load prefix")
 	base := fs.Uint64("base", 0, "force executable base address")
 	ibase := fs.Uint64("ibase", 0, "force interpreter base address")
-	demangle := fs.Bool("demangle", false, "demangle symbols using c++filt")
+	raw := fs.Bool("raw", false, "load <exe> as a headerless blob (requires -arch, see -os, -base, -entry)")
+	rawArch := fs.String("arch", "", "arch for -raw (arm, arm64, m68k, mips[el], sparc, x86, x86_64)")
+	rawOS := fs.String("os", "linux", "OS (syscall interface) for -raw")
+	rawEntry := fs.Uint64("entry", 0, "start -raw execution at this offset into the blob")
+	demangle := fs.Bool("demangle", false, "demangle C++, Rust and Swift symbols")
+	demangleParams := fs.Bool("demangle-params", false, "demangle symbols, keeping parameter lists")
+	gdb := fs.String("gdb", "", "listen for a gdb remote connection on this address (e.g. :1234)")
+	dbg := fs.Bool("debug", false, "interactive debugger (prompts before entry, on breakpoints and on invalid memory access)")
+	snapAt := fs.String("snapshot-at", "", "write a snapshot when execution first reaches this address or symbol")
+	snapFile := fs.String("snapshot", "usercorn.snap", "snapshot file for -snapshot-at")
+	maxInsns := fs.Uint64("max-insns", 0, "stop after executing this many instructions")
+	timeout := fs.Duration("timeout", 0, "stop after running this long (e.g. 10s)")
+	fuzz := fs.Bool("fuzz", false, "run as an AFL target (forkserver protocol, resets to a snapshot between test cases)")
+	fuzzAt := fs.String("fuzz-at", "", "address or symbol to snapshot and start each test case from (default: entry point)")
+	fuzzInput := fs.String("fuzz-input", "", "guest path to serve the test case on (default: stdin)")
+	fuzzTimeout := fs.Duration("fuzz-timeout", 0, "stop test cases after this long (default: $AFL_TIMEOUT milliseconds, or 1s)")
+	restore := fs.String("restore", "", "resume execution from a snapshot file")
+	record := fs.String("record", "", "record syscall results to this file")
+	replay := fs.String("replay", "", "replay syscall results from a -record file instead of calling the host")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] <exe> [args...]\n", os.Args[0])
@@ -50,41 +81,215 @@ func main() {
 			panic(err)
 		}
 	}
-	corn, err := usercorn.NewUsercorn(args[0], absPrefix)
-	if err != nil {
-		panic(err)
+	config := usercorn.Config{
+		Verbose:         *verbose,
+		TraceSys:        *strace || *trace,
+		TraceMem:        *mtrace,
+		TraceMemBatch:   *mtrace2 || *trace,
+		TraceReg:        *rtrace || *trace,
+		TraceExec:       *etrace || *trace,
+		FollowForks:     *followForks,
+		ForceBase:       *base,
+		ForceInterpBase: *ibase,
+		Demangle:        *demangle,
+		DemangleParams:  *demangleParams,
+		TraceStack:      *dbg,
+		Coverage:        *coverage != "",
+		CallGraph:       *callgraph != "",
+		Profile:         *profile != "",
+		WXAudit:         *wxAudit,
+		HeapSanitizer:   *heapSan,
+		TaintTrack:      *taint,
+		LoadPrefix:      absPrefix,
+		MaxInsns:        *maxInsns,
+		Timeout:         *timeout,
 	}
-	corn.Verbose = *verbose
-	corn.TraceSys = *strace || *trace
-	corn.TraceMem = *mtrace
-	corn.TraceMemBatch = *mtrace2 || *trace
-	corn.TraceReg = *rtrace || *trace
-	corn.TraceExec = *etrace || *trace
 	if *match != "" {
 		split := strings.SplitN(*match, "+", 2)
 		if len(split) > 1 {
 			if split[1] == "" {
-				corn.TraceMatchDepth = 999999
+				config.TraceMatchDepth = 999999
 			} else {
-				corn.TraceMatchDepth, _ = strconv.Atoi(split[1])
+				config.TraceMatchDepth, _ = strconv.Atoi(split[1])
 			}
 		}
-		corn.TraceMatch = strings.Split(split[0], ",")
+		config.TraceMatch = strings.Split(split[0], ",")
 	}
 	if *looproll == 0 && *trace {
 		*looproll = 8
 	}
-	corn.LoopCollapse = *looproll
-	corn.ForceBase = *base
-	corn.ForceInterpBase = *ibase
-	corn.Demangle = *demangle
+	config.LoopCollapse = *looproll
+	var traceOut *bufio.Writer
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		traceOut = bufio.NewWriter(f)
+		config.TraceOut = traceOut
+	}
+	var sink io.Writer = os.Stderr
+	if traceOut != nil {
+		sink = traceOut
+	}
+	switch *traceFormat {
+	case "text":
+	case "json":
+		config.Tracer = models.NewJsonTrace(sink)
+	case "binary":
+		config.Tracer = models.NewBinaryTrace(sink)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown trace format: %s\n", *traceFormat)
+		os.Exit(1)
+	}
+	if config.Path, err = filepath.Abs(args[0]); err != nil {
+		panic(err)
+	}
+	exe, err := os.Open(args[0])
+	if err != nil {
+		panic(err)
+	}
+	defer exe.Close()
+	var corn *usercorn.Usercorn
+	if *raw {
+		if *rawArch == "" {
+			fmt.Fprintln(os.Stderr, "-raw requires -arch")
+			os.Exit(1)
+		}
+		l, err := loader.NewRawLoader(exe, *rawArch, *rawOS, *rawEntry)
+		if err != nil {
+			panic(err)
+		}
+		corn, err = usercorn.NewUsercornLoader(l, config)
+	} else {
+		corn, err = usercorn.NewUsercornReader(exe, config)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if *restore != "" {
+		if err := corn.RestoreFile(*restore); err != nil {
+			panic(err)
+		}
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		corn.Record(f)
+	}
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		corn.Replay(f)
+	}
+	if *snapAt != "" {
+		addr, err := parseAddr(corn, *snapAt)
+		if err != nil {
+			panic(err)
+		}
+		if err := corn.SnapshotAt(addr, *snapFile); err != nil {
+			panic(err)
+		}
+	}
 
-	err = corn.Run(args, os.Environ())
+	var stub *debug.GdbStub
+	if *gdb != "" {
+		fmt.Fprintf(os.Stderr, "Waiting for gdb on %s\n", *gdb)
+		stub, err = debug.ListenGdb(corn, *gdb)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if *dbg {
+		// the guest owns stdin, so prefer the terminal for debugger input
+		var in io.Reader = os.Stdin
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			defer tty.Close()
+			in = tty
+		}
+		if _, err := debug.NewRepl(corn, in, os.Stderr); err != nil {
+			panic(err)
+		}
+	}
+	if *fuzz {
+		cfg := usercorn.FuzzConfig{InputPath: *fuzzInput, Timeout: *fuzzTimeout}
+		if *fuzzAt != "" {
+			if cfg.Start, err = parseAddr(corn, *fuzzAt); err != nil {
+				panic(err)
+			}
+		}
+		err = corn.Fuzz(args, os.Environ(), cfg)
+	} else {
+		err = corn.Run(args, os.Environ())
+	}
+	if traceOut != nil {
+		traceOut.Flush()
+	}
+	if *coverage != "" {
+		if f, err := os.Create(*coverage); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			if err := corn.WriteDrcov(f); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			f.Close()
+		}
+	}
+	if *profile != "" {
+		format := "folded"
+		if strings.HasSuffix(*profile, ".pb.gz") || strings.HasSuffix(*profile, ".pprof") {
+			format = "pprof"
+		}
+		if f, err := os.Create(*profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			if err := corn.WriteProfile(f, format); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			f.Close()
+		}
+	}
+	if *callgraph != "" {
+		format := "dot"
+		if strings.HasSuffix(*callgraph, ".json") {
+			format = "json"
+		}
+		if f, err := os.Create(*callgraph); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			if err := corn.WriteCallGraph(f, format); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			f.Close()
+		}
+	}
+	if stub != nil {
+		stub.Exit(err)
+	}
 	if err != nil {
 		if e, ok := err.(models.ExitStatus); ok {
 			os.Exit(int(e))
+		} else if status, ok := err.(*usercorn.RunStatus); ok {
+			fmt.Fprintln(os.Stderr, status)
+			os.Exit(1)
 		} else {
 			panic(err)
 		}
 	}
 }
+
+// parseAddr accepts a number or a symbol name.
+func parseAddr(u *usercorn.Usercorn, s string) (uint64, error) {
+	if addr, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return addr, nil
+	}
+	return u.ResolveSymbol(s)
+}
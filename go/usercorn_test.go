@@ -0,0 +1,29 @@
+package usercorn
+
+import (
+	"testing"
+
+	"github.com/lunixbochs/usercorn/go/models"
+)
+
+func TestSegmentProts(t *testing.T) {
+	segments := []models.SegmentData{
+		{Addr: 0x10000, Size: 0x1800, Prot: 5},
+		{Addr: 0x11800, Size: 0x1000, Prot: 3},
+	}
+	merged := []*models.Segment{{0x10000, 0x14000, 0}}
+	runs := segmentProts(segments, merged)
+	expected := []models.Segment{
+		{0x10000, 0x11000, 5},
+		{0x11000, 0x12000, 7},
+		{0x12000, 0x14000, 3},
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("bad runs: %v", runs)
+	}
+	for i := range runs {
+		if runs[i] != expected[i] {
+			t.Fatalf("bad runs: %v", runs)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package usercorn
+
+import (
+	"fmt"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// auditWX logs pages that are writable and executable now, and any that become so later.
+func (u *Usercorn) auditWX() {
+	for _, m := range u.Mappings() {
+		u.reportWX(m.Addr, m.Size, m.Prot)
+	}
+	u.protWatch = u.reportWX
+}
+
+func (u *Usercorn) reportWX(addr, size uint64, prot int) {
+	wx := uc.PROT_WRITE | uc.PROT_EXEC
+	if prot&wx != wx {
+		return
+	}
+	desc := ""
+	if m := u.memory.find(addr); m != nil {
+		desc = m.Desc
+		if m.File != "" {
+			desc += " " + m.File
+		}
+	}
+	pc, _ := u.RegRead(u.arch.PC)
+	sym, _ := u.Symbolicate(pc)
+	if sym != "" {
+		sym = " " + sym
+	}
+	fmt.Fprintf(u.TraceOutput(), "[W^X] 0x%x-0x%x is writable and executable (%s) @0x%x%s\n", addr, addr+size, desc, pc, sym)
+}